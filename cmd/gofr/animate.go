@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// keyframeFlags collects keyframes given as -key flags, each like
+// "frame:Field=value,Field=value".
+type keyframeFlags []gofr.Keyframe
+
+func (kf *keyframeFlags) String() string {
+	return fmt.Sprint(*kf)
+}
+
+func (kf *keyframeFlags) Set(s string) error {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected frame:Field=value,...: %q", s)
+	}
+
+	frame, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid frame: %q", parts[0])
+	}
+
+	k := gofr.Keyframe{Frame: frame, Values: map[string]float64{}}
+	for _, assignment := range strings.Split(parts[1], ",") {
+		pair := strings.SplitN(assignment, "=", 2)
+		if len(pair) != 2 {
+			return fmt.Errorf("expected Field=value: %q", assignment)
+		}
+		v, err := strconv.ParseFloat(pair[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %q", pair[0], pair[1])
+		}
+		k.Values[strings.TrimSpace(pair[0])] = v
+	}
+
+	*kf = append(*kf, k)
+	return nil
+}
+
+// runAnimate renders an animation of any numeric parameters moving
+// between keyframes, like a Julia seed orbiting the main cardioid or a
+// multibrot exponent morphing, as numbered PNG frames or a Y4M video
+// stream.
+func runAnimate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("animate", flag.ExitOnError)
+	pf := addParameterFlags(fs)
+	var keys keyframeFlags
+	fs.Var(&keys, "key", "a keyframe like 0:Exponent=2,real(Seed)=-0.8; repeat for more")
+	frames := fs.Int("frames", 100, "number of frames")
+	interpolation := fs.String("interp", "cubic", "interpolation: cubic, linear, ease-in, ease-out or ease-in-out")
+	fps := fs.Int("fps", 25, "frames per second of a Y4M stream")
+	out := fs.String("o", "animate/frame%05d.png", "PNG file name pattern, or a .y4m file or - for a Y4M stream on stdout")
+	threads := fs.Int("threads", runtime.NumCPU(), "frames to render at once")
+	quiet := fs.Bool("q", false, "don't report progress")
+	fs.Parse(args)
+
+	p, err := pf.Parameters()
+	if err != nil {
+		return err
+	}
+
+	interpolate, err := gofr.InterpolationFromString(*interpolation)
+	if err != nil {
+		return err
+	}
+
+	a := gofr.Animation{
+		Start:         p,
+		Frames:        *frames,
+		Keyframes:     keys,
+		Interpolation: interpolate,
+	}
+	if err = a.Validate(); err != nil {
+		return err
+	}
+
+	fn, done, err := frameWriter(*out, int(p.Width), int(p.Height), *fps)
+	if err != nil {
+		return err
+	}
+
+	err = gofr.RenderAnimation(ctx, &a, *threads, progressPrinter(*quiet), fn)
+	if err != nil {
+		done()
+		return err
+	}
+	return done()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// writePNG writes an image to a new PNG file.
+func writePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err = png.Encode(w, img); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// runDZI renders a view as a Deep Zoom Image pyramid: name.dzi and the
+// tiles of every level under name_files, ready to publish with
+// OpenSeadragon.
+func runDZI(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dzi", flag.ExitOnError)
+	pf := addParameterFlags(fs)
+	out := fs.String("o", "gofr.dzi", "descriptor to write; tiles go in a _files directory next to it")
+	tileSize := fs.Int("tile", gofr.DefaultDeepZoom.TileSize, "tile width and height in pixels, without overlap")
+	overlap := fs.Int("overlap", gofr.DefaultDeepZoom.Overlap, "pixels each tile overlaps its neighbors")
+	threads := fs.Int("threads", runtime.NumCPU(), "threads to render with")
+	quiet := fs.Bool("q", false, "don't report progress")
+	fs.Parse(args)
+
+	p, err := pf.Parameters()
+	if err != nil {
+		return err
+	}
+
+	dz := gofr.DeepZoom{TileSize: *tileSize, Overlap: *overlap}
+	files := strings.TrimSuffix(*out, filepath.Ext(*out)) + "_files"
+
+	err = gofr.RenderDeepZoom(ctx, &p, dz, *threads, progressPrinter(*quiet), func(level, col, row int, img *image.NRGBA64) error {
+		dir := filepath.Join(files, fmt.Sprint(level))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return writePNG(filepath.Join(dir, fmt.Sprintf("%d_%d.png", col, row)), img)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write the descriptor last, so that a viewer never finds one
+	// without all of its tiles.
+	descriptor, err := dz.Descriptor(&p)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*out, descriptor, 0644)
+}
@@ -0,0 +1,201 @@
+// Command gofr renders fractals from the command line. Its flags are
+// named after the query parameters that gofrd accepts.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// Version is a semantic version for the package.
+const Version = "0.2.2"
+
+// command is one of gofr's subcommands.
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"render", "render a view to a PNG of any size, a band of rows at a time", runRender},
+	{"dzi", "render a view as a Deep Zoom Image pyramid of tiles", runDZI},
+	{"zoom", "render a zoom into a point as PNG frames or a Y4M video", runZoom},
+	{"animate", "render keyframed changes to a view as PNG frames or a Y4M video", runAnimate},
+	{"stats", "estimate the area of the set in a view and its escape times", runStats},
+}
+
+// parameterFlags are the flags every command uses to describe a view.
+type parameterFlags struct {
+	w, h, s, i, p          int
+	aa, aai                int
+	e, aat                 float64
+	rmin, rmax, imin, imax float64
+	x, po, a               float64
+	julia                  bool
+	sr, si                 float64
+	r, c, m, aspect        string
+	ov, oc, og, ra         string
+	os, zr, zi, es         float64
+}
+
+func addParameterFlags(fs *flag.FlagSet) *parameterFlags {
+	pf := &parameterFlags{}
+
+	fs.IntVar(&pf.w, "w", 1000, "width of the image in pixels")
+	fs.IntVar(&pf.h, "h", 1000, "height of the image in pixels")
+	fs.IntVar(&pf.s, "s", 1, "supersampling factor")
+	fs.IntVar(&pf.aa, "aa", 0, "adaptive anti-aliasing samples per axis, 0 for none")
+	fs.Float64Var(&pf.aat, "aat", gofr.DefaultAdaptiveThreshold, "color difference that adaptive anti-aliasing re-samples")
+	fs.IntVar(&pf.aai, "aai", 0, "iteration difference that adaptive anti-aliasing re-samples, 0 to ignore")
+	fs.IntVar(&pf.i, "i", 1000, "maximum iterations")
+	fs.IntVar(&pf.p, "p", 2, "power")
+	fs.Float64Var(&pf.e, "e", 4.0, "escape radius")
+	fs.Float64Var(&pf.x, "x", 0, "real exponent for RenderFuncs like multibrot, 0 for the power")
+	fs.Float64Var(&pf.po, "po", 0, "palette offset in iterations")
+	fs.BoolVar(&pf.julia, "julia", false, "render the Julia set of the seed")
+	fs.Float64Var(&pf.sr, "sr", 0, "real part of the Julia seed")
+	fs.Float64Var(&pf.si, "si", 0, "imaginary part of the Julia seed")
+	fs.Float64Var(&pf.rmin, "rmin", -2.1, "smallest real value")
+	fs.Float64Var(&pf.rmax, "rmax", 2.1, "largest real value")
+	fs.Float64Var(&pf.imin, "imin", -2.1, "smallest imaginary value")
+	fs.Float64Var(&pf.imax, "imax", 2.1, "largest imaginary value")
+	fs.Float64Var(&pf.a, "a", 0, "angle to turn the view anticlockwise about its center, in radians")
+	fs.StringVar(&pf.r, "r", "mandelbrot", "RenderFunc name")
+	fs.StringVar(&pf.c, "c", "smooth", "ColorFunc name")
+	fs.StringVar(&pf.m, "m", "#000000", "member color")
+	fs.StringVar(&pf.aspect, "aspect", "fit", "how to fit the view to the image: fit, fill or stretch")
+	fs.StringVar(&pf.ov, "ov", "", "overlay parts to draw, separated by commas: axes, grid, orbit, labels, scale, equipotentials and fieldlines")
+	fs.StringVar(&pf.oc, "oc", "", "overlay color as #rrggbb or #rrggbbaa, empty to invert")
+	fs.StringVar(&pf.og, "og", "", "grid color as #rrggbb or #rrggbbaa, empty for a faint overlay color")
+	fs.Float64Var(&pf.os, "os", 0, "grid spacing on the plane, 0 to pick one")
+	fs.Float64Var(&pf.zr, "zr", 0, "real part of the point whose orbit the overlay draws")
+	fs.Float64Var(&pf.zi, "zi", 0, "imaginary part of the point whose orbit the overlay draws")
+	fs.Float64Var(&pf.es, "es", 0, "smooth iterations between equipotentials, 0 for 1")
+	fs.StringVar(&pf.ra, "ra", "", "external ray angles for the overlay to draw, separated by commas, like 1/3 or 0.(01)")
+
+	return pf
+}
+
+// Parameters returns validated gofr.Parameters built from the flags.
+func (pf *parameterFlags) Parameters() (gofr.Parameters, error) {
+	w, h := pf.w, pf.h
+	if w < 0 {
+		w = 0
+	}
+	if h < 0 {
+		h = 0
+	}
+
+	p := gofr.Parameters{
+		Width:        uint(w),
+		Height:       uint(h),
+		ImageWidth:   w * pf.s,
+		ImageHeight:  h * pf.s,
+		Scaling:      pf.s,
+		MaxI:         pf.i,
+		EscapeRadius: pf.e,
+		Min:          complex(pf.rmin, pf.imin),
+		Max:          complex(pf.rmax, pf.imax),
+		RenderFunc:   pf.r,
+		ColorFunc:    pf.c,
+		MemberColor:  pf.m,
+		Power:        pf.p,
+
+		AdaptiveSamples:    pf.aa,
+		AdaptiveThreshold:  pf.aat,
+		AdaptiveIterations: pf.aai,
+
+		Julia:         pf.julia,
+		Seed:          complex(pf.sr, pf.si),
+		Exponent:      pf.x,
+		PaletteOffset: pf.po,
+		Angle:         pf.a,
+
+		Overlay: gofr.Overlay{
+			Color:     pf.oc,
+			GridColor: pf.og,
+			Spacing:   pf.os,
+			OrbitAt:   complex(pf.zr, pf.zi),
+
+			EquipotentialSpacing: pf.es,
+		},
+	}
+
+	aspect, err := gofr.AspectFromString(pf.aspect)
+	if err != nil {
+		return p, err
+	}
+
+	if err = p.Overlay.SetParts(pf.ov); err != nil {
+		return p, err
+	}
+	p.Overlay.SetRays(pf.ra)
+
+	if err = p.Validate(); err != nil {
+		return p, err
+	}
+	p.CorrectAspect(aspect)
+	return p, nil
+}
+
+// progressPrinter reports progress on stderr unless quiet.
+func progressPrinter(quiet bool) gofr.ProgressFunc {
+	if quiet {
+		return nil
+	}
+
+	return func(p gofr.Progress) {
+		fmt.Fprintf(os.Stderr, "\r%6.2f%% %v left   ", 100*p.Fraction(), p.Remaining.Round(1e9))
+		if p.PixelsDone == p.Pixels {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun %s <command> -h for a command's flags.\n", os.Args[0])
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		go func() {
+			<-interrupts
+			cancel()
+		}()
+
+		err := c.run(ctx, os.Args[2:])
+		cancel()
+		if err != nil {
+			log.Fatalf("%s: %v", c.name, err)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
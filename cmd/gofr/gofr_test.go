@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/musl/gofr/lib/gofr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion(t *testing.T) {
+	assert.Regexp(t, `\d+\.\d+\.\d+`, Version)
+}
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofr")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "render.png")
+	err = runRender(context.Background(), []string{"-q", "-w", "120", "-h", "90", "-s", "2", "-i", "100", "-band", "16", "-o", out})
+	assert.NoError(t, err)
+
+	f, err := os.Open(out)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 120, 90), img.Bounds())
+
+	err = runRender(context.Background(), []string{"-q", "-w", "120", "-h", "90", "-i", "100", "-ov", "axes,labels,equipotentials,fieldlines", "-es", "0.5", "-oc", "#ffffff", "-ra", "1/3,0.0(01)", "-o", out})
+	assert.NoError(t, err)
+
+	err = runRender(context.Background(), []string{"-q", "-ov", "axes,compass", "-o", out})
+	assert.Error(t, err)
+}
+
+func TestDZI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofr")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "view.dzi")
+	err = runDZI(context.Background(), []string{"-q", "-w", "300", "-h", "200", "-i", "100", "-tile", "128", "-o", out})
+	assert.NoError(t, err)
+
+	descriptor, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(descriptor), `<Size Width="300" Height="200">`)
+
+	// Level 9 is full size: three columns and two rows of tiles.
+	tiles, err := filepath.Glob(filepath.Join(dir, "view_files", "9", "*.png"))
+	assert.NoError(t, err)
+	assert.Len(t, tiles, 6)
+
+	f, err := os.Open(filepath.Join(dir, "view_files", "0", "0_0.png"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 1, 1), img.Bounds())
+}
+
+func TestStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofr")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "stats.json")
+	for _, method := range []string{"pixels", "montecarlo"} {
+		err = runStats(context.Background(), []string{"-q", "-w", "400", "-h", "400", "-method", method, "-samples", "100000", "-bins", "4", "-json", "-o", out})
+		assert.NoError(t, err)
+
+		body, err := ioutil.ReadFile(out)
+		assert.NoError(t, err)
+
+		a := gofr.AreaEstimate{}
+		assert.NoError(t, json.Unmarshal(body, &a))
+		assert.Equal(t, method, a.Method)
+		assert.InDelta(t, 1.5066, a.Area, a.Error)
+		assert.Len(t, a.Histogram, 4)
+	}
+
+	out = filepath.Join(dir, "stats.txt")
+	err = runStats(context.Background(), []string{"-q", "-w", "100", "-h", "100", "-i", "100", "-julia", "-o", out})
+	assert.NoError(t, err)
+
+	text, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(text), "boundary")
+	assert.Contains(t, string(text), "(0 by shortcut)")
+
+	err = runStats(context.Background(), []string{"-q", "-method", "guess", "-o", out})
+	assert.Error(t, err)
+}
+
+func TestZoom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofr")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	flags := []string{"-q", "-w", "64", "-h", "48", "-i", "100", "-frames", "4", "-mag", "10"}
+
+	err = runZoom(context.Background(), append(flags, "-o", filepath.Join(dir, "frames", "f%03d.png")))
+	assert.NoError(t, err)
+	frames, err := filepath.Glob(filepath.Join(dir, "frames", "f*.png"))
+	assert.NoError(t, err)
+	assert.Len(t, frames, 4)
+
+	out := filepath.Join(dir, "zoom.y4m")
+	err = runZoom(context.Background(), append(flags, "-o", out))
+	assert.NoError(t, err)
+
+	video, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	header := "YUV4MPEG2 W64 H48 F25:1 Ip A1:1 C444 XCOLORRANGE=FULL\n"
+	assert.True(t, strings.HasPrefix(string(video), header))
+	assert.Len(t, video, len(header)+4*(len("FRAME\n")+3*64*48))
+}
+
+func TestAnimate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofr")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "animate.y4m")
+	err = runAnimate(context.Background(), []string{
+		"-q", "-w", "32", "-h", "24", "-i", "100", "-frames", "6",
+		"-r", "multibrot", "-julia",
+		"-key", "0:Exponent=2,real(Seed)=-0.8",
+		"-key", "5:Exponent=3,real(Seed)=0.3,imag(Seed)=0.5",
+		"-o", out,
+	})
+	assert.NoError(t, err)
+
+	video, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Len(t, video, len("YUV4MPEG2 W32 H24 F25:1 Ip A1:1 C444 XCOLORRANGE=FULL\n")+6*(len("FRAME\n")+3*32*24))
+
+	err = runAnimate(context.Background(), []string{"-q", "-w", "32", "-h", "24", "-key", "0:Width=64", "-o", out})
+	assert.Error(t, err)
+
+	var keys keyframeFlags
+	assert.Error(t, keys.Set("Exponent=2"))
+	assert.Error(t, keys.Set("x:Exponent=2"))
+	assert.Error(t, keys.Set("1:Exponent"))
+}
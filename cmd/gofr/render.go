@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// create opens a file for writing, where "-" is stdout.
+func create(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(name)
+}
+
+// runRender streams a PNG of a view to a file one band of rows at a
+// time, so that poster-sized images don't need to fit in memory.
+func runRender(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	pf := addParameterFlags(fs)
+	out := fs.String("o", "-", "PNG file to write, or - for stdout")
+	band := fs.Int("band", gofr.DefaultBandHeight, "rows of the image to render at a time")
+	threads := fs.Int("threads", runtime.NumCPU(), "threads to render with")
+	quiet := fs.Bool("q", false, "don't report progress")
+	fs.Parse(args)
+
+	p, err := pf.Parameters()
+	if err != nil {
+		return err
+	}
+
+	f, err := create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	err = gofr.EncodePNG(ctx, w, &p, *threads, *band, progressPrinter(*quiet))
+	if err != nil {
+		return err
+	}
+
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
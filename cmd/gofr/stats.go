@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// writeStats writes an AreaEstimate for people to read.
+func writeStats(w io.Writer, a *gofr.AreaEstimate, maxI int) error {
+	_, err := fmt.Fprintf(w, "method     %s\narea       %.6g ± %.2g of %.6g\npoints     %d: %d members (%d by shortcut), %d escaped\n",
+		a.Method, a.Area, a.Error, a.ViewArea, a.Points, a.Members, a.Shortcuts, a.Escaped)
+	if err != nil {
+		return err
+	}
+	if a.Method == gofr.AreaPixels.String() {
+		if _, err = fmt.Fprintf(w, "boundary   %d pixels\n", a.Boundary); err != nil {
+			return err
+		}
+	}
+	if _, err = fmt.Fprintf(w, "escape     %.4g iterations on average, %d at most\nhistogram\n", a.MeanEscape, a.MaxEscape); err != nil {
+		return err
+	}
+
+	bins := len(a.Histogram)
+	for n, count := range a.Histogram {
+		from, to := n*maxI/bins, (n+1)*maxI/bins-1
+		if _, err = fmt.Fprintf(w, "  %6d-%-6d %d\n", from, to, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStats estimates the area of the set in a view and reports the
+// escape times of the points it iterates, as a check on renders that
+// should come out the same however they're done.
+func runStats(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	pf := addParameterFlags(fs)
+	out := fs.String("o", "-", "file to write the statistics to, or - for stdout")
+	method := fs.String("method", "pixels", "how to pick points: pixels or montecarlo")
+	samples := fs.Int("samples", 1000000, "random points to iterate with -method montecarlo")
+	seed := fs.Int64("seed", 1, "seed for -method montecarlo")
+	shortcuts := fs.Bool("shortcuts", true, "count points in the main cardioid and period 2 bulb without iterating them")
+	bins := fs.Int("bins", 10, "bins in the histogram of escape times")
+	asJSON := fs.Bool("json", false, "write the statistics as JSON")
+	threads := fs.Int("threads", runtime.NumCPU(), "threads to iterate with")
+	quiet := fs.Bool("q", false, "don't report progress")
+	fs.Parse(args)
+
+	p, err := pf.Parameters()
+	if err != nil {
+		return err
+	}
+
+	e := gofr.AreaEstimation{
+		Parameters: p,
+		Samples:    *samples,
+		Seed:       *seed,
+		Shortcuts:  *shortcuts,
+		Bins:       *bins,
+	}
+	e.Method, err = gofr.AreaMethodFromString(*method)
+	if err != nil {
+		return err
+	}
+
+	a, err := gofr.EstimateArea(ctx, &e, *threads, progressPrinter(*quiet))
+	if err != nil {
+		return err
+	}
+
+	f, err := create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if *asJSON {
+		err = json.NewEncoder(f).Encode(a)
+	} else {
+		err = writeStats(f, a, p.MaxI)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
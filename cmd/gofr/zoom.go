@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// frameWriter returns a FrameFunc that writes frames to out, which is
+// either a Y4M stream ("-" or a name ending in .y4m) or a printf
+// pattern for numbered PNG files. The returned func finishes writing.
+func frameWriter(out string, width, height, fps int) (gofr.FrameFunc, func() error, error) {
+	if out != "-" && !strings.HasSuffix(out, ".y4m") {
+		if dir := filepath.Dir(out); dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		fn := func(n int, img *image.NRGBA64) error {
+			return writePNG(fmt.Sprintf(out, n), img)
+		}
+		return fn, func() error { return nil }, nil
+	}
+
+	f, err := create(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := bufio.NewWriter(f)
+	y4m := gofr.NewY4MWriter(w, width, height, fps)
+	fn := func(n int, img *image.NRGBA64) error {
+		return y4m.WriteFrame(img)
+	}
+	done := func() error {
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return fn, done, nil
+}
+
+// runZoom renders a smooth exponential zoom from a view into a point as
+// numbered PNG frames or a Y4M video stream.
+func runZoom(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("zoom", flag.ExitOnError)
+	pf := addParameterFlags(fs)
+	cr := fs.Float64("cr", -0.743643887037151, "real part of the center of the last frame")
+	ci := fs.Float64("ci", 0.131825904205330, "imaginary part of the center of the last frame")
+	mag := fs.Float64("mag", 1000, "how many times bigger the last frame is than the first")
+	frames := fs.Int("frames", 250, "number of frames")
+	easing := fs.String("easing", "ease-in-out", "easing curve: linear, ease-in, ease-out or ease-in-out")
+	fps := fs.Int("fps", 25, "frames per second of a Y4M stream")
+	out := fs.String("o", "zoom/frame%05d.png", "PNG file name pattern, or a .y4m file or - for a Y4M stream on stdout")
+	threads := fs.Int("threads", runtime.NumCPU(), "threads to render with")
+	quiet := fs.Bool("q", false, "don't report progress")
+	fs.Parse(args)
+
+	p, err := pf.Parameters()
+	if err != nil {
+		return err
+	}
+
+	e, err := gofr.EasingFromString(*easing)
+	if err != nil {
+		return err
+	}
+
+	z := gofr.Zoom{
+		Start:         p,
+		Center:        complex(*cr, *ci),
+		Magnification: *mag,
+		Frames:        *frames,
+		Easing:        e,
+	}
+	if err = z.Validate(); err != nil {
+		return err
+	}
+
+	fn, done, err := frameWriter(*out, int(p.Width), int(p.Height), *fps)
+	if err != nil {
+		return err
+	}
+
+	err = gofr.RenderZoom(ctx, &z, *threads, progressPrinter(*quiet), fn)
+	if err != nil {
+		done()
+		return err
+	}
+	return done()
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cache is a least-recently-used cache of encoded images that holds at
+// most Limit bytes in memory. Zero Limit keeps nothing in memory. If Dir
+// is set, every image is also kept there, and images that have fallen
+// out of memory are read back from it. The files in Dir take up at most
+// DirLimit bytes; the oldest are removed to make room. Zero DirLimit
+// means no limit. Keys are gofr.Parameters hashes, so they're safe to
+// use as file names.
+type Cache struct {
+	sync.Mutex
+	Limit    uint64
+	Dir      string
+	DirLimit uint64
+	size     uint64
+	order    *list.List
+	items    map[string]*list.Element
+	scanned  string
+	dirSize  uint64
+	files    *list.List
+	onDisk   map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+}
+
+type cacheFile struct {
+	key  string
+	size uint64
+}
+
+// NewCache returns an empty Cache that holds at most limit bytes in
+// memory and nothing on disk.
+func NewCache(limit uint64) *Cache {
+	return &Cache{
+		Limit:  limit,
+		order:  list.New(),
+		items:  make(map[string]*list.Element),
+		files:  list.New(),
+		onDisk: make(map[string]*list.Element),
+	}
+}
+
+var renderCache = NewCache(256 << 20)
+
+// Get returns the value cached for key, if there is one, and marks it as
+// recently used.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.Lock()
+	e, ok := c.items[key]
+	if ok {
+		c.order.MoveToFront(e)
+		value := e.Value.(*cacheEntry).value
+		c.Unlock()
+		return value, true
+	}
+	dir := c.Dir
+	c.Unlock()
+
+	if dir == "" {
+		return nil, false
+	}
+
+	value, err := ioutil.ReadFile(c.path(dir, key))
+	if err != nil {
+		return nil, false
+	}
+
+	c.Lock()
+	c.put(key, value)
+	c.Unlock()
+	return value, true
+}
+
+// Put caches value for key, evicting the least recently used values
+// from memory to make room, and writes it to Dir if there is one,
+// removing the oldest files there to make room. Values larger than
+// Limit aren't kept in memory.
+func (c *Cache) Put(key string, value []byte) {
+	c.Lock()
+	c.put(key, value)
+	dir := c.Dir
+	c.Unlock()
+
+	if dir == "" {
+		return
+	}
+
+	err := c.write(c.path(dir, key), value)
+	if err != nil {
+		log.Printf("Unable to write %s to the cache: %v", key, err)
+		return
+	}
+
+	c.Lock()
+	stale := c.wrote(dir, key, uint64(len(value)))
+	c.Unlock()
+
+	for _, name := range stale {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			log.Printf("Unable to remove %s from the cache: %v", name, err)
+		}
+	}
+}
+
+// Len is how many values are cached in memory.
+func (c *Cache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache) put(key string, value []byte) {
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+
+	size := uint64(len(value))
+	if size > c.Limit {
+		return
+	}
+
+	for c.size+size > c.Limit {
+		c.remove(c.order.Back())
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key, value})
+	c.size += size
+}
+
+func (c *Cache) remove(e *list.Element) {
+	entry := c.order.Remove(e).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.size -= uint64(len(entry.value))
+}
+
+// wrote counts a file of size bytes just written to dir for key against
+// DirLimit, and returns the names of the oldest files to remove to make
+// room for it.
+func (c *Cache) wrote(dir, key string, size uint64) []string {
+	if c.DirLimit == 0 {
+		return nil
+	}
+	c.scan(dir)
+
+	if e, ok := c.onDisk[key]; ok {
+		c.forgetFile(e)
+	}
+	c.onDisk[key] = c.files.PushFront(&cacheFile{key, size})
+	c.dirSize += size
+
+	stale := []string{}
+	for c.dirSize > c.DirLimit {
+		f := c.forgetFile(c.files.Back())
+		stale = append(stale, c.path(dir, f.key))
+	}
+	return stale
+}
+
+// scan counts the files already in dir, oldest last, the first time
+// they're needed, so that files from before a restart are counted too.
+func (c *Cache) scan(dir string) {
+	if c.scanned == dir {
+		return
+	}
+	c.scanned = dir
+	c.files.Init()
+	c.onDisk = make(map[string]*list.Element)
+	c.dirSize = 0
+
+	infos := []os.FileInfo{}
+	filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() && strings.HasSuffix(name, ".png") {
+			infos = append(infos, info)
+		}
+		return nil
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		key := strings.TrimSuffix(info.Name(), ".png")
+		size := uint64(info.Size())
+		c.onDisk[key] = c.files.PushFront(&cacheFile{key, size})
+		c.dirSize += size
+	}
+}
+
+func (c *Cache) forgetFile(e *list.Element) *cacheFile {
+	f := c.files.Remove(e).(*cacheFile)
+	delete(c.onDisk, f.key)
+	c.dirSize -= f.size
+	return f
+}
+
+// path spreads cached files over subdirectories named for the first two
+// characters of their keys.
+func (c *Cache) path(dir, key string) string {
+	sub := "_"
+	if len(key) > 2 {
+		sub = key[:2]
+	}
+	return filepath.Join(dir, sub, key+".png")
+}
+
+// write writes a file whole or not at all, so that a reader never finds
+// part of an image.
+func (c *Cache) write(name string, value []byte) error {
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(value)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+// cacheMaxAge is how long clients may reuse a rendered image without
+// checking back. The same query always renders the same image, but
+// servers may be reconfigured or upgraded.
+const cacheMaxAge = "86400"
+
+// cacheHeaders lets clients cache a rendered image identified by key.
+// Only successful responses should have them.
+func cacheHeaders(w http.ResponseWriter, key string) {
+	w.Header().Set("ETag", `"`+key+`"`)
+	w.Header().Set("Cache-Control", "public, max-age="+cacheMaxAge)
+}
+
+// startCached answers r from the cache if it can: with HTTP 304 if the
+// client already has the image identified by key, or with the image
+// itself. It returns whether r has been answered.
+func startCached(w http.ResponseWriter, r *http.Request, key string) bool {
+	if matchesETag(r.Header.Get("If-None-Match"), `"`+key+`"`) {
+		cacheHeaders(w, key)
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	if body, ok := renderCache.Get(key); ok {
+		cacheHeaders(w, key)
+		w.Header().Set("X-Cache", "hit")
+		finishPNG(w, body)
+		return true
+	}
+
+	w.Header().Set("X-Cache", "miss")
+	return false
+}
+
+// matchesETag reports whether an If-None-Match header lists etag.
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image/png"
+	"net/http"
+	"runtime"
+
+	"github.com/google/uuid"
+	"github.com/musl/gofr/lib/gofr"
+)
+
+const (
+	// exploreLevels and exploreZoom are how deep /explore goes and how
+	// far it zooms in at each level unless asked otherwise.
+	exploreLevels = 4
+	exploreZoom   = 4
+
+	// exploreThumbnail is how long the longer side of each of /explore's
+	// thumbnails is unless asked otherwise.
+	exploreThumbnail = 128
+)
+
+type waypointResult struct {
+	nucleusView
+	Score     float64 `json:"score"`
+	Thumbnail string  `json:"thumbnail,omitempty"`
+}
+
+// routeExplore starts from the view of the same query parameters as
+// /png and zooms in on its most interesting part, then on that view's,
+// and so on. It returns each view it zooms to, how interesting it was
+// and a thumbnail of it as a data: URL.
+func routeExplore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	q := r.URL.Query()
+	qp := queryParser{q: q}
+
+	p, err := parametersFromQuery(q)
+	if err != nil {
+		errs, ok := err.(gofr.ValidationError)
+		if !ok {
+			finishInvalid(w, err)
+			return
+		}
+		qp.errs = errs
+	}
+
+	e := gofr.Exploration{
+		Start:         p,
+		Levels:        qp.optionalInt("levels", exploreLevels),
+		Zoom:          qp.optionalFloat("zoom", exploreZoom),
+		ThumbnailSize: qp.optionalInt("thumb", exploreThumbnail),
+	}
+	if !qp.failed("levels") && (e.Levels < 1 || e.Levels > gofr.MaxExploreLevels) {
+		qp.fail("levels", "must be between 1 and 64")
+	}
+	if !qp.failed("zoom") && !(e.Zoom >= 2 && e.Zoom <= 32) {
+		qp.fail("zoom", "must be between 2 and 32")
+	}
+	if !qp.failed("thumb") && (e.ThumbnailSize < 0 || e.ThumbnailSize > gofr.MaxThumbnailSize) {
+		qp.fail("thumb", "must be between 0 and 1024")
+	}
+	if name := q.Get("interest"); name != "" {
+		e.Interest, err = gofr.InterestFromString(name)
+		if err != nil {
+			qp.fail("interest", "must be entropy, boundary or variance")
+		}
+	}
+
+	if len(qp.errs) > 0 {
+		finishInvalid(w, qp.errs)
+		return
+	}
+	if err := e.Validate(); err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	renderID := uuid.New().String()
+	memory := e.EstimateMemory()
+	if jobMemory > 0 && memory > jobMemory {
+		finishTooLarge(w, memory, jobMemory)
+		return
+	}
+
+	ticket := enqueueBytes(w, r, memory)
+	if ticket == nil {
+		return
+	}
+	defer ticket.Release()
+
+	err = ticket.Wait(r.Context())
+	if err != nil {
+		finishRenderError(w, r, renderID, err)
+		return
+	}
+
+	// The render's time starts once it's out of the queue.
+	ctx, cancel := context.WithTimeout(r.Context(), renderTimeout)
+	defer cancel()
+
+	waypoints, err := gofr.Explore(ctx, &e, runtime.NumCPU())
+	if err != nil {
+		finishRenderError(w, r, renderID, err)
+		return
+	}
+
+	results := []waypointResult{}
+	for _, wp := range waypoints {
+		v := wp.View
+		result := waypointResult{
+			nucleusView: nucleusView{real(v.Center), imag(v.Center), v.Magnification, v.Angle},
+			Score:       wp.Score,
+		}
+		if wp.Thumbnail != nil {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, wp.Thumbnail); err != nil {
+				finishRenderError(w, r, renderID, err)
+				return
+			}
+			result.Thumbnail = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+		}
+		results = append(results, result)
+	}
+
+	finishJSON(w, http.StatusOK, results)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"image"
 	"image/png"
@@ -12,39 +15,42 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/musl/gofr/lib/gofr"
-	"github.com/nfnt/resize"
 )
 
 // Version is a semantic version for the package.
 const Version = "0.2.2"
 
-var renderJobs = make(map[string]RenderJob)
+var renderJobs = make(map[string]*RenderJob)
 var renderJobsMutex = &sync.Mutex{}
 
+// renderTimeout bounds how long a single render may run once it has
+// left the queue.
+var renderTimeout = 2 * time.Minute
+
 // RenderJob contains all information necessary to complete a Render.
 type RenderJob struct {
 	Parameters gofr.Parameters
-	Cancel     chan bool
+	Cancel     context.CancelFunc
+	Progress   gofr.ProgressFunc
 	Threads    int
 }
 
-// Render executes a RenderJob's unit of work.
-func (rj *RenderJob) Render() (image.Image, error) {
-	img := image.NewNRGBA64(image.Rect(0, 0, rj.Parameters.ImageWidth, rj.Parameters.ImageHeight))
-	contexts := gofr.MakeContexts(img, rj.Threads, &rj.Parameters)
-
-	err := gofr.Render(rj.Threads, contexts, rj.Cancel)
-	if err != nil {
-		return nil, err
-	}
+// Render executes a RenderJob's unit of work. It stops early and
+// returns ctx.Err() when ctx is done.
+func (rj *RenderJob) Render(ctx context.Context) (image.Image, error) {
+	return gofr.RenderImage(ctx, &rj.Parameters, rj.Threads, rj.Progress)
+}
 
-	image := resize.Resize(rj.Parameters.Width, rj.Parameters.Height, image.Image(img), resize.Lanczos3)
-	return image, nil
+// EncodePNG executes a RenderJob's unit of work, streaming it to w as a
+// PNG one band at a time so that the whole image is never in memory.
+func (rj *RenderJob) EncodePNG(ctx context.Context, w io.Writer) error {
+	return gofr.EncodePNG(ctx, w, &rj.Parameters, rj.Threads, gofr.DefaultBandHeight, rj.Progress)
 }
 
 // LogResponseWriter logs how long a response took and what it's
@@ -68,6 +74,13 @@ func (lrw *LogResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush implements http.Flusher when the wrapped ResponseWriter does.
+func (lrw *LogResponseWriter) Flush() {
+	if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 // Log writes out the time difference between being initialized and when
 // it is called.
 func (lrw LogResponseWriter) Log(message string) {
@@ -90,13 +103,20 @@ func wrapHandlerFunc(h http.HandlerFunc) http.Handler {
 }
 
 func finish(w http.ResponseWriter, status int, message string) {
-	l, err := io.WriteString(w, message)
-	if err != nil || l != len(message) {
+	w.WriteHeader(status)
+	io.WriteString(w, message)
+}
+
+func finishJSON(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
+	w.Write(body)
 }
 
 func makeSPARoute(docroot string) http.HandlerFunc {
@@ -108,13 +128,42 @@ func makeSPARoute(docroot string) http.HandlerFunc {
 	}
 }
 
+// registerRenderJob makes j the render for renderID, cancelling any
+// render already running for it. The returned func unregisters j.
+func registerRenderJob(renderID string, j *RenderJob) func() {
+	renderJobsMutex.Lock()
+	if previous, exists := renderJobs[renderID]; exists {
+		previous.Cancel()
+	}
+	renderJobs[renderID] = j
+	renderJobsMutex.Unlock()
+
+	return func() {
+		renderJobsMutex.Lock()
+		if renderJobs[renderID] == j {
+			delete(renderJobs, renderID)
+		}
+		renderJobsMutex.Unlock()
+	}
+}
+
+// finishRenderError reports why a render for a request didn't finish.
+func finishRenderError(w http.ResponseWriter, r *http.Request, renderID string, err error) {
+	switch {
+	case r.Context().Err() != nil:
+		log.Printf("Client went away, abandoning render %s: %v", renderID, err)
+	case err == context.DeadlineExceeded:
+		finish(w, http.StatusServiceUnavailable, "Render timed out.")
+	case err == context.Canceled:
+		finish(w, http.StatusTooManyRequests, "Render cancelled by a newer request.")
+	default:
+		finish(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 func routePNG(w http.ResponseWriter, r *http.Request) {
 	id := uuid.New()
 
-	// TODO either check a table for currently rendering IDs and return
-	// HTTP 429 (one request per id in flight), or cancel the existing,
-	// running request and continue this one.
-
 	if r.Method != "GET" {
 		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
 		return
@@ -122,118 +171,120 @@ func routePNG(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 
-	s, err := strconv.Atoi(q.Get("s"))
+	p, err := parametersFromQuery(q)
 	if err != nil {
-		s = 1
-	}
-
-	e, err := strconv.Atoi(q.Get("p"))
-	if err != nil {
-		e = 1
+		finishInvalid(w, err)
+		return
 	}
 
-	width, err := strconv.Atoi(q.Get("w"))
-	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid width")
+	renderID := q.Get("render-id")
+	if renderID == "" {
+		finishInvalid(w, gofr.ValidationError{{Field: "render-id", Message: "is required"}})
 		return
 	}
 
-	height, err := strconv.Atoi(q.Get("h"))
-	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid height")
-		return
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	j := &RenderJob{
+		Parameters: p,
+		Threads:    runtime.NumCPU(),
+		Cancel:     cancel,
+		Progress: func(progress gofr.Progress) {
+			progressHub.Publish(renderID, progress)
+		},
 	}
 
-	iterations, err := strconv.Atoi(q.Get("i"))
-	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid i")
+	defer registerRenderJob(renderID, j)()
+
+	// Bookmarks and permalinks ask for the same views over and over.
+	key := p.Hash()
+	if startCached(w, r, key) {
 		return
 	}
 
-	er, err := strconv.ParseFloat(q.Get("e"), 64)
-	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid e")
+	ticket, stream := enqueue(w, r, &p)
+	if ticket == nil {
 		return
 	}
+	defer ticket.Release()
 
-	rmin, err := strconv.ParseFloat(q.Get("rmin"), 64)
+	err = ticket.Wait(ctx)
 	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid rmin")
+		finishRenderError(w, r, renderID, err)
 		return
 	}
 
-	imin, err := strconv.ParseFloat(q.Get("imin"), 64)
-	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid rmin")
+	// The render's time starts once it's out of the queue.
+	ctx, cancelRender := context.WithTimeout(ctx, renderTimeout)
+	defer cancelRender()
+
+	if stream {
+		// Once the image starts streaming, the status can't change, so
+		// a failure can only cut the response short.
+		cacheHeaders(w, key)
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Render-Job-ID", id.String())
+		w.WriteHeader(http.StatusOK)
+
+		err = j.EncodePNG(ctx, w)
+		if err != nil {
+			log.Printf("Unable to stream render %s: %v", renderID, err)
+		}
 		return
 	}
 
-	rmax, err := strconv.ParseFloat(q.Get("rmax"), 64)
+	image, err := j.Render(ctx)
 	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid rmax")
+		finishRenderError(w, r, renderID, err)
 		return
 	}
 
-	imax, err := strconv.ParseFloat(q.Get("imax"), 64)
+	var buf bytes.Buffer
+	err = png.Encode(&buf, image)
 	if err != nil {
-		finish(w, http.StatusUnprocessableEntity, "Invalid rmin")
+		finish(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	renderCache.Put(key, buf.Bytes())
 
-	j := RenderJob{
-		Parameters: gofr.Parameters{
-			Width:        uint(width),
-			Height:       uint(height),
-			ImageWidth:   width * s,
-			ImageHeight:  height * s,
-			MaxI:         iterations,
-			EscapeRadius: er,
-			Min:          complex(rmin, imin),
-			Max:          complex(rmax, imax),
-			RenderFunc:   q.Get("r"),
-			ColorFunc:    q.Get("c"),
-			MemberColor:  q.Get("m"),
-			Power:        e,
-		},
-		Threads: runtime.NumCPU(),
-		Cancel:  make(chan bool),
-	}
+	cacheHeaders(w, key)
+	w.Header().Set("X-Render-Job-ID", id.String())
+	finishPNG(w, buf.Bytes())
+}
 
-	renderID := q.Get("render-id")
-	if renderID == "" {
-		finish(w, http.StatusUnprocessableEntity, "Missing render-id")
+func routeFunctions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
 		return
 	}
 
-	defer func() {
-		renderJobsMutex.Lock()
-		delete(renderJobs, renderID)
-		renderJobsMutex.Unlock()
-	}()
+	finishJSON(w, http.StatusOK, struct {
+		RenderFuncs []gofr.RenderFuncInfo `json:"render"`
+		ColorFuncs  []gofr.ColorFuncInfo  `json:"color"`
+	}{
+		gofr.RenderFuncs(),
+		gofr.ColorFuncs(),
+	})
+}
 
-	renderJobsMutex.Lock()
-	if _, exists := renderJobs[renderID]; exists {
-		close(renderJobs[renderID].Cancel)
-		delete(renderJobs, renderID)
+// parseComplex reads a complex number written as "real,imag".
+func parseComplex(s string) (complex128, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("Invalid complex number, expected real,imag: %#v", s)
 	}
-	renderJobs[renderID] = j
-	renderJobsMutex.Unlock()
 
-	image, err := j.Render()
+	r, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
 	if err != nil {
-		finish(w, http.StatusTooManyRequests, err.Error())
-		return
+		return 0, err
 	}
-
-	err = png.Encode(w, image)
+	i, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return 0, err
 	}
 
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("X-Render-Job-ID", id.String())
-	w.WriteHeader(http.StatusOK)
+	return complex(r, i), nil
 }
 
 func routeStatus(w http.ResponseWriter, r *http.Request) {
@@ -263,8 +314,121 @@ func main() {
 	}
 	log.Printf("Listening on: %s\n", bindAddr)
 
+	if value = os.Getenv("GOFR_RENDER_TIMEOUT"); value != "" {
+		renderTimeout, err = time.ParseDuration(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Render timeout: %v\n", renderTimeout)
+
+	if value = os.Getenv("GOFR_MAX_RENDERS"); value != "" {
+		renderQueue.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if value = os.Getenv("GOFR_MAX_QUEUE"); value != "" {
+		renderQueue.MaxDepth, err = strconv.Atoi(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Render queue: %d at once, %d waiting\n", renderQueue.Limit, renderQueue.MaxDepth)
+
+	if value = os.Getenv("GOFR_JOB_MEMORY"); value != "" {
+		jobMemory, err = gofr.ParseByteSize(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if value = os.Getenv("GOFR_MEMORY"); value != "" {
+		renderQueue.Memory, err = gofr.ParseByteSize(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Memory budget: %s per render, %s in all\n", gofr.PrintByteSize(jobMemory), gofr.PrintByteSize(renderQueue.Memory))
+
+	if value = os.Getenv("GOFR_JOB_TIMEOUT"); value != "" {
+		jobManager.Timeout, err = time.ParseDuration(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Job timeout: %v\n", jobManager.Timeout)
+
+	if value = os.Getenv("GOFR_JOB_RETENTION"); value != "" {
+		jobManager.Retention, err = time.ParseDuration(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Job retention: %v\n", jobManager.Retention)
+
+	if value = os.Getenv("GOFR_MAX_JOBS"); value != "" {
+		jobManager.MaxJobs, err = strconv.Atoi(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if value = os.Getenv("GOFR_JOB_RESULTS"); value != "" {
+		jobManager.ResultMemory, err = gofr.ParseByteSize(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Jobs: %d kept, %s of images\n", jobManager.MaxJobs, gofr.PrintByteSize(jobManager.ResultMemory))
+
+	if value = os.Getenv("GOFR_TILE_ORIGIN"); value != "" {
+		tileOrigin, err = parseComplex(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if value = os.Getenv("GOFR_TILE_SPAN"); value != "" {
+		tileSpan, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Tiles: %g wide around %v\n", tileSpan, tileOrigin)
+
+	if value = os.Getenv("GOFR_CACHE"); value != "" {
+		renderCache.Limit, err = gofr.ParseByteSize(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	renderCache.Dir = os.Getenv("GOFR_CACHE_DIR")
+	renderCache.DirLimit = 4 << 30
+	if value = os.Getenv("GOFR_CACHE_DIR_LIMIT"); value != "" {
+		renderCache.DirLimit, err = gofr.ParseByteSize(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("Render cache: %s in memory, %s on disk in %#v\n", gofr.PrintByteSize(renderCache.Limit), gofr.PrintByteSize(renderCache.DirLimit), renderCache.Dir)
+
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			jobManager.Expire(now)
+		}
+	}()
+
 	http.Handle("/", wrapHandlerFunc(makeSPARoute(staticDir)))
 	http.Handle("/png", wrapHandlerFunc(routePNG))
+	http.Handle("/progressive", wrapHandlerFunc(routeProgressive))
+	http.Handle("/tiles/", wrapHandlerFunc(routeTile))
+	http.Handle("/functions", wrapHandlerFunc(routeFunctions))
+	http.Handle("/orbit", wrapHandlerFunc(routeOrbit))
+	http.Handle("/nuclei", wrapHandlerFunc(routeNuclei))
+	http.Handle("/ray", wrapHandlerFunc(routeRay))
+	http.Handle("/misiurewicz", wrapHandlerFunc(routeMisiurewicz))
+	http.Handle("/explore", wrapHandlerFunc(routeExplore))
+	http.Handle("/progress", wrapHandlerFunc(routeProgress))
+	http.Handle("/jobs", wrapHandlerFunc(routeJobs))
+	http.Handle("/jobs/", wrapHandlerFunc(routeJob))
 	http.Handle("/status", wrapHandlerFunc(routeStatus))
 
 	/* Run the thing. */
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/musl/gofr/lib/gofr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +55,892 @@ func TestRoutePNGQuery(t *testing.T) {
 	assert.Equal(t, http.StatusOK, response.StatusCode)
 	assert.Equal(t, []byte{0x89, 0x50, 0x4e, 0x47}, body[0:4])
 }
+
+func TestRoutePNGAdaptive(t *testing.T) {
+	target := "http:///png?i=100&w=100&h=100&e=4&m=%23444444&c=smooth&r=mandelbrot&aa=4&aat=0.05&p=2&rmin=-2&rmax=2&imin=-2&imax=2&render-id=5c7d0a54-8f0e-4d1a-9d0f-2f6b1e3a7c44"
+	response, body, err := testHandlerFunc(routePNG, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []byte{0x89, 0x50, 0x4e, 0x47}, body[0:4])
+
+	response, _, err = testHandlerFunc(routePNG, "GET", target+"&s=2", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+}
+
+func TestRoutePNGJulia(t *testing.T) {
+	target := "http:///png?i=100&w=64&h=64&e=4&m=%23000000&c=smooth&r=multibrot&x=2.5&julia=1&sr=-0.8&si=0.156&po=3&rmin=-2&rmax=2&imin=-2&imax=2&render-id=0b8e4f6a-1c2d-4e3f-9a5b-6c7d8e9f0a1b"
+	response, body, err := testHandlerFunc(routePNG, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []byte{0x89, 0x50, 0x4e, 0x47}, body[0:4])
+
+	response, body, err = testHandlerFunc(routePNG, "GET", strings.NewReplacer("r=multibrot", "r=mandelbrot", "julia=1", "julia=maybe").Replace(target), nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Contains(t, string(body), `"field":"x"`)
+	assert.Contains(t, string(body), `"field":"julia"`)
+}
+
+func TestRoutePNGOverlay(t *testing.T) {
+	target := "http:///png?i=100&w=96&h=64&e=4&m=%23000000&c=mono&r=mandelbrot&cr=-0.5&ci=0&mag=1&ov=axes,grid,labels,scale&oc=%23ff0000&og=%2300ff0080&render-id=3e5f7a9c-2b4d-4f6a-8c1e-5d7b9f1a3c5e"
+	response, body, err := testHandlerFunc(routePNG, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	img, err := png.Decode(bytes.NewReader(body))
+	assert.NoError(t, err)
+
+	// mono only draws black and white, so anything red is the overlay.
+	red := 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, g, _, _ := img.At(x, y).RGBA(); r == 0xffff && g == 0 {
+				red++
+			}
+		}
+	}
+	assert.True(t, red > 64+96, "only %d pixels of the overlay are drawn", red)
+
+	response, body, err = testHandlerFunc(routePNG, "GET", strings.NewReplacer("ov=axes,grid", "ov=axes,compass", "oc=%23ff0000", "oc=red", "mag=1", "mag=1&os=-1&ra=1/3,0.(2)&es=-1").Replace(target), nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Contains(t, string(body), `"field":"ov"`)
+	assert.Contains(t, string(body), `"field":"oc"`)
+	assert.Contains(t, string(body), `"field":"os"`)
+	assert.Contains(t, string(body), `"field":"ra"`)
+	assert.Contains(t, string(body), `"field":"es"`)
+}
+
+func TestRouteOrbit(t *testing.T) {
+	base := "http:///orbit?i=100&w=3&h=3&e=4&m=%23000000&c=smooth&r=mandelbrot&rmin=-2&rmax=0&imin=-1&imax=1"
+	result := struct {
+		Z []struct {
+			Re, Im, Abs float64
+		}
+		Escaped   bool
+		Iteration int
+		Period    int
+		Color     string
+	}{}
+
+	for _, point := range []string{"&zr=-1&zi=0", "&px=1&py=1"} {
+		response, body, err := testHandlerFunc(routeOrbit, "GET", base+point, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.NoError(t, json.Unmarshal(body, &result))
+		assert.False(t, result.Escaped)
+		assert.Equal(t, 100, result.Iteration)
+		assert.Equal(t, 2, result.Period)
+		assert.Equal(t, "#000000", result.Color)
+		assert.InDelta(t, -1, result.Z[0].Re, 1e-12)
+	}
+
+	response, body, err := testHandlerFunc(routeOrbit, "GET", base+"&zr=1&n=5", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.True(t, result.Escaped)
+	assert.Len(t, result.Z, 3)
+
+	response, _, err = testHandlerFunc(routeOrbit, "GET", base+"&zr=1&n=16001", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+
+	response, body, err = testHandlerFunc(routeOrbit, "GET", base+"&px=x&py=1&n=0", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Contains(t, string(body), `"field":"px"`)
+	assert.Contains(t, string(body), `"field":"n"`)
+}
+
+func TestRouteNuclei(t *testing.T) {
+	base := "http:///nuclei?i=100&w=100&h=100&e=4&m=%23000000&c=smooth&r=mandelbrot&cr=-1.76&ci=0&mag=20"
+	results := []struct {
+		Re, Im float64
+		Period int
+		Size   float64
+		View   struct {
+			CR, CI, Mag, A float64
+		}
+	}{}
+
+	for _, period := range []string{"", "&period=3"} {
+		response, body, err := testHandlerFunc(routeNuclei, "GET", base+period, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.NoError(t, json.Unmarshal(body, &results))
+		if assert.NotEmpty(t, results) {
+			assert.InDelta(t, -1.7548776662466927, results[0].Re, 1e-12)
+			assert.Equal(t, 3, results[0].Period)
+			assert.True(t, results[0].View.Mag > 20)
+		}
+	}
+
+	response, body, err := testHandlerFunc(routeNuclei, "GET", base+"&period=-1", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Contains(t, string(body), `"field":"period"`)
+
+	// Searches time out like renders.
+	timeout := renderTimeout
+	renderTimeout = time.Nanosecond
+	defer func() { renderTimeout = timeout }()
+
+	response, _, err = testHandlerFunc(routeNuclei, "GET", base+"&period=3", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func TestRouteExplore(t *testing.T) {
+	base := "http:///explore?i=200&w=160&h=120&e=4&m=%23000000&c=smooth&r=mandelbrot&cr=-0.5&ci=0&mag=1"
+	results := []struct {
+		CR, CI, Mag, Score float64
+		Thumbnail          string
+	}{}
+
+	response, body, err := testHandlerFunc(routeExplore, "GET", base+"&levels=3&zoom=8&interest=boundary&thumb=32", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &results))
+	if assert.Len(t, results, 3) {
+		assert.InDelta(t, 512, results[2].Mag, 1e-9)
+		assert.True(t, results[2].Score > 0)
+		assert.True(t, strings.HasPrefix(results[2].Thumbnail, "data:image/png;base64,"))
+	}
+
+	response, body, err = testHandlerFunc(routeExplore, "GET", base+"&levels=1&thumb=0", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	results = nil
+	assert.NoError(t, json.Unmarshal(body, &results))
+	if assert.Len(t, results, 1) {
+		assert.Empty(t, results[0].Thumbnail)
+	}
+
+	for key, value := range map[string]string{"levels": "0", "zoom": "1", "thumb": "x", "interest": "pretty"} {
+		response, body, err = testHandlerFunc(routeExplore, "GET", base+"&"+key+"="+value, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+		assert.Contains(t, string(body), `"field":"`+key+`"`)
+	}
+}
+
+func TestRouteRay(t *testing.T) {
+	base := "http:///ray?i=100&w=100&h=100&e=4&m=%23000000&c=smooth&r=mandelbrot&cr=0&ci=0&mag=1"
+	result := struct {
+		Angle             string
+		Preperiod, Period int
+		Points            []struct{ Re, Im float64 }
+		Landing           *struct{ Re, Im float64 }
+	}{}
+
+	response, body, err := testHandlerFunc(routeRay, "GET", base+"&angle=0.0(01)", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, "1/6", result.Angle)
+	assert.Equal(t, 1, result.Preperiod)
+	assert.Equal(t, 2, result.Period)
+	if assert.NotNil(t, result.Landing) {
+		assert.InDelta(t, 0, result.Landing.Re, 1e-9)
+		assert.InDelta(t, 1, result.Landing.Im, 1e-9)
+	}
+
+	response, body, err = testHandlerFunc(routeRay, "GET", base+"&angle=third&depth=0", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Contains(t, string(body), `"field":"angle"`)
+	assert.Contains(t, string(body), `"field":"depth"`)
+
+	// Traces time out like renders.
+	timeout := renderTimeout
+	renderTimeout = time.Nanosecond
+	defer func() { renderTimeout = timeout }()
+
+	response, _, err = testHandlerFunc(routeRay, "GET", base+"&angle=1/3", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func TestRouteMisiurewicz(t *testing.T) {
+	base := "http:///misiurewicz?i=100&w=100&h=100&e=4&m=%23000000&c=smooth&r=mandelbrot&cr=0&ci=1&mag=40"
+	results := []struct{ Re, Im float64 }{}
+
+	response, body, err := testHandlerFunc(routeMisiurewicz, "GET", base+"&preperiod=2&period=2", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &results))
+	if assert.Len(t, results, 1) {
+		assert.InDelta(t, 0, results[0].Re, 1e-12)
+		assert.InDelta(t, 1, results[0].Im, 1e-12)
+	}
+
+	response, body, err = testHandlerFunc(routeMisiurewicz, "GET", base+"&preperiod=1", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Contains(t, string(body), `"field":"preperiod"`)
+	assert.Contains(t, string(body), `"field":"period"`)
+
+	// Searches time out like renders.
+	timeout := renderTimeout
+	renderTimeout = time.Nanosecond
+	defer func() { renderTimeout = timeout }()
+
+	response, _, err = testHandlerFunc(routeMisiurewicz, "GET", base+"&preperiod=2&period=2", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func TestParametersFromView(t *testing.T) {
+	base := "i=100&w=200&h=100&e=4&m=%23444444&c=mono&r=mandelbrot&p=2"
+
+	corners, _ := url.ParseQuery(base + "&rmin=-2&rmax=2&imin=-1&imax=1&a=0.5")
+	want, err := parametersFromQuery(corners)
+	assert.NoError(t, err)
+
+	center, _ := url.ParseQuery(base + "&cr=0&ci=0&mag=2&a=0.5")
+	p, err := parametersFromQuery(center)
+	assert.NoError(t, err)
+	assert.InDelta(t, real(want.Min), real(p.Min), 1e-12)
+	assert.InDelta(t, imag(want.Max), imag(p.Max), 1e-12)
+	assert.Equal(t, 0.5, p.Angle)
+
+	// Corners that don't fit the image are corrected to square pixels
+	// unless they're stretched.
+	for aspect, span := range map[string]complex128{"": complex(4, 2), "fit": complex(4, 2), "fill": complex(2, 1), "stretch": complex(2, 2)} {
+		query, _ := url.ParseQuery(base + "&rmin=-1&rmax=1&imin=-1&imax=1&aspect=" + aspect)
+		p, err := parametersFromQuery(query)
+		assert.NoError(t, err)
+		assert.InDelta(t, real(span), real(p.Max-p.Min), 1e-12, aspect)
+		assert.InDelta(t, imag(span), imag(p.Max-p.Min), 1e-12, aspect)
+		assert.Equal(t, aspect != "stretch", p.SquarePixels(), aspect)
+	}
+
+	fill, _ := url.ParseQuery(base + "&cr=0&ci=0&mag=2&aspect=fill")
+	p, err = parametersFromQuery(fill)
+	assert.NoError(t, err)
+	assert.InDelta(t, 2, real(p.Max-p.Min), 1e-12)
+	assert.InDelta(t, 1, imag(p.Max-p.Min), 1e-12)
+
+	affine, _ := url.ParseQuery(base + "&cr=0&ci=0&mag=2&affine=1,0.5,0,1,0.25,0")
+	p, err = parametersFromQuery(affine)
+	assert.NoError(t, err)
+	assert.Equal(t, &gofr.Affine{XX: 1, XY: 0.5, YX: 0, YY: 1, Offset: 0.25}, p.Affine)
+
+	invalid, _ := url.ParseQuery(base + "&cr=x&ci=0&mag=0&affine=1,2,3&aspect=squash")
+	_, err = parametersFromQuery(invalid)
+	fields := []string{}
+	for _, e := range err.(gofr.ValidationError) {
+		fields = append(fields, e.Field)
+	}
+	assert.ElementsMatch(t, []string{"cr", "mag", "affine", "aspect"}, fields)
+
+	target := "http:///png?" + base + "&cr=-0.75&ci=0.1&mag=20&a=1&render-id=1f2e3d4c-5b6a-4978-8695-a4b3c2d1e0f9"
+	response, body, err := testHandlerFunc(routePNG, "GET", target, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []byte{0x89, 0x50, 0x4e, 0x47}, body[0:4])
+}
+
+func TestRoutePNGInvalid(t *testing.T) {
+	target := "http:///png?i=100&w=0&h=100&e=1&m=&c=mono&r=mandelbrot&rmin=2&rmax=-2&imin=-2&imax=x&render-id=7d1b6c0e-7a2d-4b5e-a0a4-6c3c1f9a2b10"
+	response, body, err := testHandlerFunc(routePNG, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+
+	result := struct {
+		Errors []struct{ Field, Message string }
+	}{}
+	assert.NoError(t, json.Unmarshal(body, &result))
+
+	fields := []string{}
+	for _, e := range result.Errors {
+		fields = append(fields, e.Field)
+	}
+	assert.ElementsMatch(t, []string{"imax", "w", "e", "m", "rmax"}, fields)
+}
+
+func TestRoutePNGTimeout(t *testing.T) {
+	timeout := renderTimeout
+	renderTimeout = time.Nanosecond
+	defer func() { renderTimeout = timeout }()
+
+	target := "http:///png?i=100000&w=100&h=100&e=4&m=%23444444&c=mono&r=mandelbrot&s=2&p=2&rmin=-2&rmax=2&imin=-2&imax=2&render-id=3e0f7e4c-43b5-4d6b-9b55-0a8a1b4c0f25"
+	response, _, err := testHandlerFunc(routePNG, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func TestRoutePNGQueuedTimeout(t *testing.T) {
+	queue := renderQueue
+	renderQueue = NewRenderQueue(1, 4, 0)
+	defer func() { renderQueue = queue }()
+
+	timeout := renderTimeout
+	renderTimeout = 200 * time.Millisecond
+	defer func() { renderTimeout = timeout }()
+
+	// Waiting in line longer than the render timeout doesn't use it up.
+	busy, err := renderQueue.Enqueue("other", 0)
+	assert.NoError(t, err)
+	wait := 2 * renderTimeout
+	go func() {
+		time.Sleep(wait)
+		busy.Release()
+	}()
+
+	target := "http:///png?i=100&w=50&h=50&e=4&m=%23444444&c=mono&r=mandelbrot&p=2&rmin=-2&rmax=2&imin=-2&imax=2&render-id=9b2e6c1d-7a4f-4e0b-8c3d-5f6a7b8c9d0e"
+	response, _, err := testHandlerFunc(routePNG, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestRouteFunctions(t *testing.T) {
+	response, body, err := testHandlerFunc(routeFunctions, "GET", "http:///functions", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+	functions := struct {
+		Render []struct{ Name string }
+		Color  []struct{ Name string }
+	}{}
+	assert.NoError(t, json.Unmarshal(body, &functions))
+	assert.Equal(t, "mandelbrot", functions.Render[0].Name)
+	assert.Equal(t, "mono", functions.Color[0].Name)
+}
+
+func TestRouteProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(routeProgress))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/progress?render-id=progress-test")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				progressHub.Publish("progress-test", gofr.Progress{Tiles: 4, TilesDone: 1, Pixels: 100, PixelsDone: 25})
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(response.Body)
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, "event: progress", scanner.Text())
+	assert.True(t, scanner.Scan())
+	assert.Contains(t, scanner.Text(), `"pixels_done":25`)
+}
+
+func TestRouteJobs(t *testing.T) {
+	form := "i=100&w=100&h=100&e=4&m=%23444444&c=mono&r=mandelbrot&s=1&p=2&rmin=-2&rmax=2&imin=-2&imax=2"
+	r := httptest.NewRequest("POST", "http:///jobs", strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	routeJobs(w, r)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	status := JobStatus{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "/jobs/"+status.ID, w.Header().Get("Location"))
+
+	for !status.State.Finished() {
+		time.Sleep(10 * time.Millisecond)
+		response, body, err := testHandlerFunc(routeJob, "GET", "http:///jobs/"+status.ID, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.NoError(t, json.Unmarshal(body, &status))
+	}
+	assert.Equal(t, JobDone, status.State)
+
+	response, body, err := testHandlerFunc(routeJob, "GET", "http://"+status.Result, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []byte{0x89, 0x50, 0x4e, 0x47}, body[0:4])
+
+	jobManager.Expire(time.Now().Add(jobManager.Retention + time.Second))
+	response, _, err = testHandlerFunc(routeJob, "GET", "http:///jobs/"+status.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestRouteJobsStream(t *testing.T) {
+	form := "i=100&w=200&h=150&e=4&m=%23444444&c=mono&r=mandelbrot&s=2&p=2&rmin=-2&rmax=2&imin=-1.5&imax=1.5"
+	values, _ := url.ParseQuery(form)
+	p, err := parametersFromQuery(values)
+	assert.NoError(t, err)
+
+	// Jobs stream their images, so they only need the memory of a band.
+	queue := renderQueue
+	renderQueue = NewRenderQueue(1, 4, p.EstimateStreamMemory(gofr.DefaultBandHeight))
+	defer func() { renderQueue = queue }()
+
+	r := httptest.NewRequest("POST", "http:///jobs", strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	routeJobs(w, r)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	status := JobStatus{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	jobManager.Cancel(status.ID)
+}
+
+func TestRouteJobCancel(t *testing.T) {
+	p, err := parametersFromQuery(map[string][]string{
+		"i": {"1000000"}, "w": {"1000"}, "h": {"1000"}, "e": {"4"}, "m": {"#444444"},
+		"c": {"mono"}, "r": {"mandelbrot"}, "rmin": {"-1"}, "rmax": {"0"}, "imin": {"-0.5"}, "imax": {"0.5"},
+	})
+	assert.NoError(t, err)
+	ticket, err := renderQueue.Enqueue("test", p.EstimateStreamMemory(gofr.DefaultBandHeight))
+	assert.NoError(t, err)
+	j, err := jobManager.Submit(p, ticket)
+	assert.NoError(t, err)
+
+	response, body, err := testHandlerFunc(routeJob, "DELETE", "http:///jobs/"+j.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	status := JobStatus{}
+	assert.NoError(t, json.Unmarshal(body, &status))
+	assert.Equal(t, JobCancelled, status.State)
+
+	response, _, err = testHandlerFunc(routeJob, "GET", "http:///jobs/"+j.ID+"/png", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+}
+
+func TestJobManagerLimits(t *testing.T) {
+	p, err := parametersFromQuery(map[string][]string{
+		"i": {"100"}, "w": {"64"}, "h": {"64"}, "e": {"4"}, "m": {"#444444"},
+		"c": {"mono"}, "r": {"mandelbrot"}, "rmin": {"-2"}, "rmax": {"2"}, "imin": {"-2"}, "imax": {"2"},
+	})
+	assert.NoError(t, err)
+
+	// wait polls until the JobManager has finished with every job.
+	wait := func(jm *JobManager, jobs ...*Job) {
+		for n := 0; n < 500; n++ {
+			jm.Lock()
+			total := uint64(0)
+			for _, j := range jm.jobs {
+				total += uint64(len(j.result))
+			}
+			settled := total == jm.results
+			jm.Unlock()
+
+			done := true
+			for _, j := range jobs {
+				done = done && j.Status().State.Finished()
+			}
+			if settled && done {
+				time.Sleep(10 * time.Millisecond)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("Jobs didn't finish.")
+	}
+
+	// Jobs waiting in line take up room until they finish, however long
+	// they wait.
+	rq := NewRenderQueue(1, 4, 0)
+	busy, _ := rq.Enqueue("other", 0)
+	jm := NewJobManager(time.Hour, 50*time.Millisecond, 2, 0)
+
+	ticket, _ := rq.Enqueue("test", 0)
+	a, err := jm.Submit(p, ticket)
+	assert.NoError(t, err)
+	ticket, _ = rq.Enqueue("test", 0)
+	b, err := jm.Submit(p, ticket)
+	assert.NoError(t, err)
+
+	ticket, _ = rq.Enqueue("test", 0)
+	_, err = jm.Submit(p, ticket)
+	assert.Equal(t, ErrTooManyJobs, err)
+	ticket.Release()
+
+	// Nor can jobs submitted at the same time take more room than
+	// there is.
+	racing := NewJobManager(time.Hour, time.Hour, 2, 0)
+	held := NewRenderQueue(1, 8, 0)
+	hold, _ := held.Enqueue("other", 0)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	start := make(chan struct{})
+	submitted := []*Job{}
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticket, _ := held.Enqueue("racing", 0)
+			<-start
+			j, err := racing.Submit(p, ticket)
+			if err != nil {
+				ticket.Release()
+				return
+			}
+			mu.Lock()
+			submitted = append(submitted, j)
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	assert.Equal(t, 2, len(submitted))
+	for _, j := range submitted {
+		racing.Cancel(j.ID)
+	}
+	hold.Release()
+
+	time.Sleep(100 * time.Millisecond)
+	busy.Release()
+	wait(jm, a, b)
+	assert.Equal(t, JobDone, a.Status().State)
+
+	// Then the job that finished first makes room.
+	ticket, _ = rq.Enqueue("test", 0)
+	c, err := jm.Submit(p, ticket)
+	assert.NoError(t, err)
+	wait(jm, c)
+	_, ok := jm.Get(a.ID)
+	assert.False(t, ok)
+
+	// Images are kept until they take up too much memory.
+	result, _ := c.Result()
+	jm = NewJobManager(time.Hour, time.Minute, 0, uint64(3*len(result)/2))
+	ticket, _ = rq.Enqueue("test", 0)
+	a, _ = jm.Submit(p, ticket)
+	wait(jm, a)
+	ticket, _ = rq.Enqueue("test", 0)
+	b, _ = jm.Submit(p, ticket)
+	wait(jm, b)
+
+	_, ok = jm.Get(a.ID)
+	assert.False(t, ok)
+	_, ok = b.Result()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(len(result)), jm.results)
+
+	jm.ResultMemory = 1
+	ticket, _ = rq.Enqueue("test", 0)
+	c, _ = jm.Submit(p, ticket)
+	wait(jm, c)
+	assert.Equal(t, JobFailed, c.Status().State)
+}
+
+func TestRenderQueue(t *testing.T) {
+	rq := NewRenderQueue(1, 3, 0)
+
+	running, err := rq.Enqueue("a", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, running.Wait(context.Background()))
+
+	a1, _ := rq.Enqueue("a", 0)
+	a2, _ := rq.Enqueue("a", 0)
+	b1, _ := rq.Enqueue("b", 0)
+	_, err = rq.Enqueue("c", 0)
+	assert.Equal(t, ErrQueueFull, err)
+
+	// Client b gets a turn before client a's second render.
+	order := []*Ticket{a1, b1, a2}
+	running.Release()
+	for _, next := range order {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		assert.NoError(t, next.Wait(ctx))
+		cancel()
+		next.Release()
+	}
+
+	// A ticket that gives up while waiting leaves the queue.
+	running, _ = rq.Enqueue("a", 0)
+	waiting, _ := rq.Enqueue("b", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, waiting.Wait(ctx))
+	waiting.Release()
+	running.Release()
+	assert.Equal(t, 0, rq.waiting)
+	assert.Equal(t, 0, rq.running)
+}
+
+func TestRenderQueueMemory(t *testing.T) {
+	rq := NewRenderQueue(4, 4, 100)
+
+	_, err := rq.Enqueue("a", 101)
+	assert.Equal(t, ErrTooLarge, err)
+
+	big, _ := rq.Enqueue("a", 80)
+	assert.NoError(t, big.Wait(context.Background()))
+
+	// Slots are free but memory isn't, so this has to wait.
+	small, _ := rq.Enqueue("b", 30)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, small.Wait(ctx))
+	cancel()
+
+	big.Release()
+	assert.NoError(t, small.Wait(context.Background()))
+	small.Release()
+	assert.Equal(t, uint64(0), rq.memory)
+}
+
+func TestRenderQueueWithdrawHead(t *testing.T) {
+	rq := NewRenderQueue(4, 4, 100)
+
+	running, _ := rq.Enqueue("a", 60)
+	assert.NoError(t, running.Wait(context.Background()))
+
+	// The head of the line doesn't fit, so it holds up the small render
+	// behind it until it's withdrawn.
+	head, _ := rq.Enqueue("b", 50)
+	small, _ := rq.Enqueue("c", 30)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, small.Wait(ctx))
+	cancel()
+
+	head.Release()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	assert.NoError(t, small.Wait(ctx))
+	cancel()
+
+	small.Release()
+	running.Release()
+	assert.Equal(t, uint64(0), rq.memory)
+	assert.Equal(t, 0, rq.waiting)
+}
+
+func TestRoutePNGTooLarge(t *testing.T) {
+	target := "http:///png?i=100&w=200000&h=200000&e=4&m=%23444444&c=mono&r=mandelbrot&s=8&p=2&rmin=-2&rmax=2&imin=-2&imax=2&render-id=c0a3d2a4-5e7b-4c36-9a43-0f1e0b6d7c11"
+	response, body, err := testHandlerFunc(routePNG, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode)
+	assert.Contains(t, string(body), "memory")
+}
+
+func TestRoutePNGStream(t *testing.T) {
+	query := "i=100&w=200&h=150&e=4&m=%23444444&c=mono&r=mandelbrot&s=2&p=2&rmin=-2&rmax=2&imin=-1.5&imax=1.5&render-id=5a1f0c9e-2b7d-4f6a-8e3c-9d4b2a7c6e01"
+	values, _ := url.ParseQuery(query)
+	p, err := parametersFromQuery(values)
+	assert.NoError(t, err)
+
+	// Too big to render whole, but not to stream.
+	memory := jobMemory
+	jobMemory = p.EstimateStreamMemory(gofr.DefaultBandHeight)
+	defer func() { jobMemory = memory }()
+
+	response, body, err := testHandlerFunc(routePNG, "GET", "http:///png?"+query, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	img, err := png.Decode(bytes.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 150), img.Bounds())
+}
+
+func TestRouteProgressive(t *testing.T) {
+	cache := renderCache
+	renderCache = NewCache(1 << 20)
+	defer func() { renderCache = cache }()
+
+	target := "http:///progressive?i=100&w=200&h=150&e=4&m=%23444444&c=mono&r=mandelbrot&s=1&p=2&rmin=-2&rmax=2&imin=-1.5&imax=1.5&render-id=0b8e6f2a-4c1d-4e7b-9a3f-6d2c8e1b5a47"
+	passes := func() []string {
+		response, body, err := testHandlerFunc(routeProgressive, "GET", target, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		assert.Equal(t, "multipart/x-mixed-replace", mediaType)
+
+		blocks := []string{}
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+
+			img, err := png.Decode(part)
+			assert.NoError(t, err)
+			assert.Equal(t, image.Rect(0, 0, 200, 150), img.Bounds())
+			blocks = append(blocks, part.Header.Get("X-Render-Block"))
+		}
+		return blocks
+	}
+
+	assert.Equal(t, []string{"8", "4", "2", "1"}, passes())
+
+	// Once it's cached, only the final pass is needed.
+	assert.Equal(t, []string{"1"}, passes())
+}
+
+func TestRouteTile(t *testing.T) {
+	cache := renderCache
+	renderCache = NewCache(1 << 20)
+	defer func() { renderCache = cache }()
+
+	target := "http:///tiles/mandelbrot/2/1/2.png?i=100&c=mono"
+	response, body, err := testHandlerFunc(routeTile, "GET", target, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "miss", response.Header.Get("X-Cache"))
+
+	img, err := png.Decode(bytes.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, gofr.TileSize, gofr.TileSize), img.Bounds())
+
+	response, cached, err := testHandlerFunc(routeTile, "GET", target, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "hit", response.Header.Get("X-Cache"))
+	assert.Equal(t, body, cached)
+
+	for _, target := range []string{
+		"http:///tiles/mandelbrot/2/4/0.png",
+		"http:///tiles/mandelbrot/2/1.png",
+		"http:///tiles/mandelbrot/x/1/2.png",
+	} {
+		response, _, err = testHandlerFunc(routeTile, "GET", target, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode, target)
+	}
+
+	response, _, err = testHandlerFunc(routeTile, "GET", "http:///tiles/nope/0/0/0.png", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+
+	// Tiles are rendered whole, so they aren't let in on the memory of
+	// streaming them.
+	fractal, tile, _ := parseTilePath("/tiles/mandelbrot/2/1/3.png")
+	p, err := tileParametersFromQuery(fractal, tile, url.Values{"i": {"100"}, "c": {"mono"}})
+	assert.NoError(t, err)
+	memory := jobMemory
+	jobMemory = p.EstimateMemory() - 1
+	defer func() { jobMemory = memory }()
+
+	response, _, err = testHandlerFunc(routeTile, "GET", "http:///tiles/mandelbrot/2/1/3.png?i=100&c=mono", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode)
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(10)
+	c.Put("a", []byte("aaaa"))
+	c.Put("b", []byte("bbbb"))
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used, so it makes room for c.
+	c.Put("c", []byte("cccc"))
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+
+	c.Put("d", []byte("too big to cache"))
+	_, ok = c.Get("d")
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestRoutePNGCache(t *testing.T) {
+	cache := renderCache
+	renderCache = NewCache(1 << 20)
+	defer func() { renderCache = cache }()
+
+	target := "http:///png?i=100&w=64&h=48&e=4&m=%23444444&c=mono&r=mandelbrot&p=2&rmin=-2&rmax=2&imin=-1.5&imax=1.5&render-id=6f4c2a1e-9b3d-4c8a-b7e5-1d0f3a2c9e68"
+	response, body, err := testHandlerFunc(routePNG, "GET", target, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "miss", response.Header.Get("X-Cache"))
+	etag := response.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Contains(t, response.Header.Get("Cache-Control"), "max-age=")
+
+	// Only the render-id differs, so it's the same image.
+	response, cached, err := testHandlerFunc(routePNG, "GET", strings.Replace(target, "6f4c", "7a5d", 1), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "hit", response.Header.Get("X-Cache"))
+	assert.Equal(t, etag, response.Header.Get("ETag"))
+	assert.Equal(t, body, cached)
+
+	r := httptest.NewRequest("GET", target, nil)
+	r.Header.Set("If-None-Match", `"other", `+etag)
+	w := httptest.NewRecorder()
+	routePNG(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestCacheDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofrd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := NewCache(1 << 10)
+	c.Dir = dir
+	c.Put("0123abcd", []byte("image"))
+
+	// A new cache, as after a restart, finds it on disk.
+	c = NewCache(1 << 10)
+	c.Dir = dir
+	value, ok := c.Get("0123abcd")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("image"), value)
+	assert.Equal(t, 1, c.Len())
+
+	_, ok = c.Get("4567cdef")
+	assert.False(t, ok)
+
+	// Files are removed, oldest first, to keep to DirLimit, counting
+	// the ones from before the restart.
+	c.DirLimit = 12
+	c.Put("89abef01", []byte("image"))
+	c.Put("cdef2345", []byte("image"))
+	c = NewCache(0)
+	c.Dir = dir
+	_, ok = c.Get("0123abcd")
+	assert.False(t, ok)
+	for _, key := range []string{"89abef01", "cdef2345"} {
+		_, ok = c.Get(key)
+		assert.True(t, ok, key)
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// JobState is where a Job is in its life.
+type JobState string
+
+// The states a Job can be in. Done, failed and cancelled jobs are
+// finished and expire after the JobManager's retention period.
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Finished reports whether a job in this state will never change state
+// again.
+func (js JobState) Finished() bool {
+	return js == JobDone || js == JobFailed || js == JobCancelled
+}
+
+// Job is a RenderJob that runs in the background and keeps its result
+// around to be fetched later.
+type Job struct {
+	sync.Mutex
+	ID        string
+	RenderJob *RenderJob
+	State     JobState
+	Progress  gofr.Progress
+	Error     string
+	Created   time.Time
+	Started   time.Time
+	Finished  time.Time
+	result    []byte
+}
+
+// JobStatus is the JSON representation of a Job.
+type JobStatus struct {
+	ID       string        `json:"id"`
+	State    JobState      `json:"state"`
+	Progress gofr.Progress `json:"progress"`
+	Error    string        `json:"error,omitempty"`
+	Created  time.Time     `json:"created"`
+	Started  *time.Time    `json:"started,omitempty"`
+	Finished *time.Time    `json:"finished,omitempty"`
+	Result   string        `json:"result,omitempty"`
+}
+
+// Status returns a snapshot of a Job.
+func (j *Job) Status() JobStatus {
+	j.Lock()
+	defer j.Unlock()
+
+	s := JobStatus{
+		ID:       j.ID,
+		State:    j.State,
+		Progress: j.Progress,
+		Error:    j.Error,
+		Created:  j.Created,
+	}
+	if !j.Started.IsZero() {
+		started := j.Started
+		s.Started = &started
+	}
+	if !j.Finished.IsZero() {
+		finished := j.Finished
+		s.Finished = &finished
+	}
+	if j.State == JobDone {
+		s.Result = "/jobs/" + j.ID + "/png"
+	}
+
+	return s
+}
+
+// Result returns the encoded PNG of a job that's done.
+func (j *Job) Result() ([]byte, bool) {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.result, j.State == JobDone
+}
+
+// finish records the outcome of a job unless it already has one.
+func (j *Job) finish(state JobState, message string, result []byte) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.State.Finished() {
+		return
+	}
+
+	j.State = state
+	j.Error = message
+	j.Finished = time.Now()
+	j.result = result
+}
+
+// run renders the job and records the outcome.
+func (j *Job) run(ctx context.Context) {
+	j.Lock()
+	if j.State.Finished() {
+		j.Unlock()
+		return
+	}
+	j.State = JobRunning
+	j.Started = time.Now()
+	j.Unlock()
+
+	// Only the encoded image is kept, so it never needs to exist whole.
+	buf := &bytes.Buffer{}
+	err := j.RenderJob.EncodePNG(ctx, buf)
+	if err == nil {
+		j.finish(JobDone, "", buf.Bytes())
+		return
+	}
+
+	message := err.Error()
+	if err == context.DeadlineExceeded {
+		message = "Render timed out."
+	}
+	j.finish(JobFailed, message, nil)
+}
+
+// ErrTooManyJobs is returned when a JobManager already has as many
+// unfinished jobs as it keeps.
+var ErrTooManyJobs = errors.New("Too many jobs.")
+
+// JobManager keeps track of background render jobs and forgets them
+// once they have been finished for longer than Retention. It keeps at
+// most MaxJobs jobs, and the images of those that are done take up at
+// most ResultMemory bytes between them; to make room, the jobs that
+// finished first are forgotten first. Zero means no limit.
+type JobManager struct {
+	sync.Mutex
+	jobs         map[string]*Job
+	results      uint64
+	Retention    time.Duration
+	Timeout      time.Duration
+	MaxJobs      int
+	ResultMemory uint64
+}
+
+// NewJobManager returns a JobManager with no jobs.
+func NewJobManager(retention, timeout time.Duration, maxJobs int, resultMemory uint64) *JobManager {
+	return &JobManager{
+		jobs:         make(map[string]*Job),
+		Retention:    retention,
+		Timeout:      timeout,
+		MaxJobs:      maxJobs,
+		ResultMemory: resultMemory,
+	}
+}
+
+var jobManager = NewJobManager(time.Hour, time.Hour, 64, 1<<30)
+
+// Submit renders p in the background once ticket is granted and
+// returns its Job. The job releases the ticket when it's finished, and
+// has Timeout to render from then on. It returns ErrTooManyJobs,
+// without the ticket, if there's no room for another job.
+func (jm *JobManager) Submit(p gofr.Parameters, ticket *Ticket) (*Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	j := &Job{
+		ID:      uuid.New().String(),
+		State:   JobQueued,
+		Created: time.Now(),
+	}
+	j.RenderJob = &RenderJob{
+		Parameters: p,
+		Threads:    runtime.NumCPU(),
+		Cancel:     cancel,
+		Progress: func(progress gofr.Progress) {
+			j.Lock()
+			j.Progress = progress
+			j.Unlock()
+			progressHub.Publish(j.ID, progress)
+		},
+	}
+
+	// Making room and taking it happen together, so that jobs submitted
+	// at the same time can't both take the last place.
+	jm.Lock()
+	for jm.MaxJobs > 0 && len(jm.jobs) >= jm.MaxJobs {
+		if !jm.forgetOldest(nil) {
+			jm.Unlock()
+			cancel()
+			return nil, ErrTooManyJobs
+		}
+	}
+	jm.jobs[j.ID] = j
+	jm.Unlock()
+
+	go func() {
+		defer cancel()
+		defer ticket.Release()
+
+		// Only a cancelled job stops waiting.
+		if err := ticket.Wait(ctx); err != nil {
+			j.finish(JobCancelled, "", nil)
+			return
+		}
+
+		ctx, cancelRender := context.WithTimeout(ctx, jm.Timeout)
+		defer cancelRender()
+		j.run(ctx)
+		jm.keep(j)
+	}()
+
+	return j, nil
+}
+
+// keep counts the image of a job that's done against ResultMemory,
+// forgetting the jobs that finished before it to make room. An image
+// that could never fit fails the job instead.
+func (jm *JobManager) keep(j *Job) {
+	jm.Lock()
+	defer jm.Unlock()
+
+	j.Lock()
+	size := uint64(len(j.result))
+	if jm.ResultMemory > 0 && size > jm.ResultMemory {
+		j.State = JobFailed
+		j.Error = "Image is larger than the server keeps."
+		j.result = nil
+		size = 0
+	}
+	j.Unlock()
+
+	if _, ok := jm.jobs[j.ID]; !ok {
+		return
+	}
+	jm.results += size
+	for jm.ResultMemory > 0 && jm.results > jm.ResultMemory {
+		if !jm.forgetOldest(j) {
+			break
+		}
+	}
+}
+
+// forgetOldest forgets the job other than except that finished first,
+// if any have. The JobManager must be locked.
+func (jm *JobManager) forgetOldest(except *Job) bool {
+	var oldest *Job
+	var finished time.Time
+	for _, j := range jm.jobs {
+		j.Lock()
+		done, at := j.State.Finished(), j.Finished
+		j.Unlock()
+
+		if j != except && done && (oldest == nil || at.Before(finished)) {
+			oldest, finished = j, at
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+
+	jm.forget(oldest)
+	return true
+}
+
+// forget removes a job and stops counting its image. The JobManager
+// must be locked.
+func (jm *JobManager) forget(j *Job) {
+	j.Lock()
+	jm.results -= uint64(len(j.result))
+	j.Unlock()
+	delete(jm.jobs, j.ID)
+}
+
+// Get returns the job with the given ID.
+func (jm *JobManager) Get(id string) (*Job, bool) {
+	jm.Lock()
+	defer jm.Unlock()
+
+	j, ok := jm.jobs[id]
+	return j, ok
+}
+
+// Cancel stops a job that hasn't finished yet. The job is kept, in the
+// cancelled state, until it expires.
+func (jm *JobManager) Cancel(id string) (*Job, bool) {
+	j, ok := jm.Get(id)
+	if !ok {
+		return nil, false
+	}
+
+	j.finish(JobCancelled, "", nil)
+	j.RenderJob.Cancel()
+
+	return j, true
+}
+
+// Expire forgets every job that finished more than Retention before
+// now.
+func (jm *JobManager) Expire(now time.Time) {
+	jm.Lock()
+	defer jm.Unlock()
+
+	for _, j := range jm.jobs {
+		j.Lock()
+		expired := j.State.Finished() && now.Sub(j.Finished) > jm.Retention
+		j.Unlock()
+
+		if expired {
+			jm.forget(j)
+		}
+	}
+}
+
+// routeJobs creates jobs from POSTed form or query parameters, the same
+// ones that /png accepts.
+func routeJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		finish(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p, err := parametersFromQuery(r.Form)
+	if err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	// Jobs always stream their images, so they never need them whole.
+	ticket := enqueueStream(w, r, &p)
+	if ticket == nil {
+		return
+	}
+
+	j, err := jobManager.Submit(p, ticket)
+	if err != nil {
+		ticket.Release()
+		finish(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	finishJSON(w, http.StatusAccepted, j.Status())
+}
+
+// routeJob serves /jobs/{id} and /jobs/{id}/png.
+func routeJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "png") {
+		finish(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	j, ok := jobManager.Get(parts[0])
+	if !ok {
+		finish(w, http.StatusNotFound, "No such job.")
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != "GET" {
+			finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+			return
+		}
+
+		result, ok := j.Result()
+		if !ok {
+			finishJSON(w, http.StatusConflict, j.Status())
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		w.Write(result)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		finishJSON(w, http.StatusOK, j.Status())
+	case "DELETE":
+		jobManager.Cancel(j.ID)
+		finishJSON(w, http.StatusOK, j.Status())
+	default:
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// nucleusView is a view of a nucleus' component in the query
+// parameters that show it.
+type nucleusView struct {
+	CR  float64 `json:"cr"`
+	CI  float64 `json:"ci"`
+	Mag float64 `json:"mag"`
+	A   float64 `json:"a"`
+}
+
+type nucleusResult struct {
+	Re          float64     `json:"re"`
+	Im          float64     `json:"im"`
+	Period      int         `json:"period"`
+	Size        float64     `json:"size"`
+	Orientation float64     `json:"orientation"`
+	View        nucleusView `json:"view"`
+}
+
+// routeNuclei returns the nuclei of hyperbolic components in the view
+// of the same query parameters as /png, nearest its center first, each
+// with a view that zooms to it. They have the given period, or the
+// lowest that any in the view has if it's 0 or missing. The search
+// takes a turn in the render queue like a render.
+func routeNuclei(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	q := r.URL.Query()
+	qp := queryParser{q: q}
+
+	p, err := parametersFromQuery(q)
+	if err != nil {
+		errs, ok := err.(gofr.ValidationError)
+		if !ok {
+			finishInvalid(w, err)
+			return
+		}
+		qp.errs = errs
+	}
+
+	period := qp.optionalInt("period", 0)
+	if period < 0 || period > gofr.MaxNucleusPeriod {
+		qp.fail("period", "must be between 0 and 4096")
+	}
+
+	if len(qp.errs) > 0 {
+		finishInvalid(w, qp.errs)
+		return
+	}
+
+	renderID := uuid.New().String()
+	ticket := enqueueBytes(w, r, 0)
+	if ticket == nil {
+		return
+	}
+	defer ticket.Release()
+
+	err = ticket.Wait(r.Context())
+	if err != nil {
+		finishRenderError(w, r, renderID, err)
+		return
+	}
+
+	// The search's time starts once it's out of the queue.
+	ctx, cancel := context.WithTimeout(r.Context(), renderTimeout)
+	defer cancel()
+
+	nuclei, err := gofr.FindNuclei(ctx, &p, period)
+	if ctx.Err() != nil {
+		finishRenderError(w, r, renderID, ctx.Err())
+		return
+	}
+	if err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	results := []nucleusResult{}
+	for _, n := range nuclei {
+		v := n.View()
+		results = append(results, nucleusResult{
+			Re:          real(n.C),
+			Im:          imag(n.C),
+			Period:      n.Period,
+			Size:        n.Size,
+			Orientation: n.Orientation,
+			View:        nucleusView{real(v.Center), imag(v.Center), v.Magnification, v.Angle},
+		})
+	}
+
+	finishJSON(w, http.StatusOK, results)
+}
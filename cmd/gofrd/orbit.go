@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// orbitLimit is how many points of an orbit /orbit returns unless n
+// asks for more or fewer, up to maxOrbitLimit, which keeps a response
+// to about a megabyte of JSON.
+const (
+	orbitLimit    = 10000
+	maxOrbitLimit = 16 * gofr.OrbitSteps
+)
+
+// routeOrbit returns the orbit of a single point as JSON, followed
+// exactly as the same query parameters as /png render it. The point is
+// zr and zi, or the center of pixel px, py of the w by h image, counting
+// from its top left corner.
+func routeOrbit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	q := r.URL.Query()
+	qp := queryParser{q: q}
+
+	p, err := parametersFromQuery(q)
+	if err != nil {
+		errs, ok := err.(gofr.ValidationError)
+		if !ok {
+			finishInvalid(w, err)
+			return
+		}
+		qp.errs = errs
+	}
+
+	z := p.Overlay.OrbitAt
+	if q.Get("px") != "" || q.Get("py") != "" {
+		x, y := qp.requiredInt("px"), qp.requiredInt("py")
+		t := gofr.NewTransform(p.Min, p.Max, int(p.Width), int(p.Height), p.Angle, p.Affine)
+		z = t.PixelToPoint(float64(x)+0.5, float64(y)+0.5)
+	}
+
+	limit := qp.optionalInt("n", orbitLimit)
+	if limit < 1 || limit > maxOrbitLimit {
+		qp.fail("n", fmt.Sprintf("must be between 1 and %d", maxOrbitLimit))
+	}
+
+	if len(qp.errs) > 0 {
+		finishInvalid(w, qp.errs)
+		return
+	}
+
+	o, err := gofr.TraceOrbit(&p, z, limit)
+	if err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	finishJSON(w, http.StatusOK, o)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// queryKeys maps the fields named in a gofr.ValidationError to the
+// query parameters that set them.
+var queryKeys = map[string]string{
+	"Width":        "w",
+	"Height":       "h",
+	"ImageWidth":   "w",
+	"ImageHeight":  "h",
+	"MaxI":         "i",
+	"EscapeRadius": "e",
+	"MemberColor":  "m",
+	"ColorFunc":    "c",
+	"RenderFunc":   "r",
+	"Power":        "p",
+	"Scaling":      "s",
+	"real(Min)":    "rmin",
+	"imag(Min)":    "imin",
+	"real(Max)":    "rmax",
+	"imag(Max)":    "imax",
+
+	"AdaptiveSamples":    "aa",
+	"AdaptiveThreshold":  "aat",
+	"AdaptiveIterations": "aai",
+
+	"Julia":         "julia",
+	"real(Seed)":    "sr",
+	"imag(Seed)":    "si",
+	"Exponent":      "x",
+	"PaletteOffset": "po",
+
+	"Angle":         "a",
+	"Affine":        "affine",
+	"real(Center)":  "cr",
+	"imag(Center)":  "ci",
+	"Magnification": "mag",
+	"Aspect":        "aspect",
+
+	"Overlay.Color":     "oc",
+	"Overlay.GridColor": "og",
+	"Overlay.Spacing":   "os",
+
+	"Overlay.Orbit":         "ov",
+	"real(Overlay.OrbitAt)": "zr",
+	"imag(Overlay.OrbitAt)": "zi",
+	"Overlay.Rays":          "ra",
+
+	"Overlay.Equipotentials":       "ov",
+	"Overlay.FieldLines":           "ov",
+	"Overlay.EquipotentialSpacing": "es",
+}
+
+// corner is the query keys of the corner form of a view.
+var corner = map[string]bool{"rmin": true, "imin": true, "rmax": true, "imax": true}
+
+// queryParser collects a FieldError for every query parameter that
+// can't be parsed, so that they can all be reported at once.
+type queryParser struct {
+	q    url.Values
+	errs gofr.ValidationError
+}
+
+func (qp *queryParser) fail(key, message string) {
+	qp.errs = append(qp.errs, gofr.FieldError{Field: key, Message: message})
+}
+
+func (qp *queryParser) failed(key string) bool {
+	for _, e := range qp.errs {
+		if e.Field == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (qp *queryParser) requiredInt(key string) int {
+	v, err := strconv.Atoi(qp.q.Get(key))
+	if err != nil {
+		qp.fail(key, "must be an integer")
+	}
+	return v
+}
+
+func (qp *queryParser) optionalInt(key string, fallback int) int {
+	if qp.q.Get(key) == "" {
+		return fallback
+	}
+	return qp.requiredInt(key)
+}
+
+func (qp *queryParser) requiredFloat(key string) float64 {
+	v, err := strconv.ParseFloat(qp.q.Get(key), 64)
+	if err != nil {
+		qp.fail(key, "must be a number")
+	}
+	return v
+}
+
+func (qp *queryParser) optionalFloat(key string, fallback float64) float64 {
+	if qp.q.Get(key) == "" {
+		return fallback
+	}
+	return qp.requiredFloat(key)
+}
+
+func (qp *queryParser) optionalBool(key string) bool {
+	if qp.q.Get(key) == "" {
+		return false
+	}
+	v, err := strconv.ParseBool(qp.q.Get(key))
+	if err != nil {
+		qp.fail(key, "must be true or false")
+	}
+	return v
+}
+
+// optionalAffine reads an Affine written as "xx,xy,yx,yy", optionally
+// followed by ",re,im" for its offset.
+func (qp *queryParser) optionalAffine(key string) *gofr.Affine {
+	if qp.q.Get(key) == "" {
+		return nil
+	}
+
+	parts := strings.Split(qp.q.Get(key), ",")
+	v := make([]float64, 6)
+	if len(parts) != 4 && len(parts) != 6 {
+		qp.fail(key, "must be 4 or 6 numbers separated by commas")
+		return nil
+	}
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			qp.fail(key, "must be 4 or 6 numbers separated by commas")
+			return nil
+		}
+		v[i] = f
+	}
+
+	return &gofr.Affine{XX: v[0], XY: v[1], YX: v[2], YY: v[3], Offset: complex(v[4], v[5])}
+}
+
+// parametersFromQuery builds and validates gofr.Parameters from the
+// query parameters that the browser sends. Any error it returns is a
+// gofr.ValidationError whose fields are named by query key.
+func parametersFromQuery(q url.Values) (gofr.Parameters, error) {
+	qp := queryParser{q: q}
+
+	s := qp.optionalInt("s", 1)
+	if s < 1 {
+		qp.fail("s", "must be at least 1")
+		s = 1
+	}
+
+	width := qp.requiredInt("w")
+	height := qp.requiredInt("h")
+	if width < 0 {
+		width = 0
+	}
+	if height < 0 {
+		height = 0
+	}
+
+	p := gofr.Parameters{
+		Width:        uint(width),
+		Height:       uint(height),
+		ImageWidth:   width * s,
+		ImageHeight:  height * s,
+		Scaling:      s,
+		MaxI:         qp.requiredInt("i"),
+		EscapeRadius: qp.requiredFloat("e"),
+		RenderFunc:   q.Get("r"),
+		ColorFunc:    q.Get("c"),
+		MemberColor:  q.Get("m"),
+		Power:        qp.optionalInt("p", 2),
+
+		AdaptiveSamples:    qp.optionalInt("aa", 0),
+		AdaptiveThreshold:  qp.optionalFloat("aat", gofr.DefaultAdaptiveThreshold),
+		AdaptiveIterations: qp.optionalInt("aai", 0),
+
+		Julia:         qp.optionalBool("julia"),
+		Seed:          complex(qp.optionalFloat("sr", 0), qp.optionalFloat("si", 0)),
+		Exponent:      qp.optionalFloat("x", 0),
+		PaletteOffset: qp.optionalFloat("po", 0),
+
+		Angle:  qp.optionalFloat("a", 0),
+		Affine: qp.optionalAffine("affine"),
+
+		Overlay: gofr.Overlay{
+			Color:     q.Get("oc"),
+			GridColor: q.Get("og"),
+			Spacing:   qp.optionalFloat("os", 0),
+			OrbitAt:   complex(qp.optionalFloat("zr", 0), qp.optionalFloat("zi", 0)),
+
+			EquipotentialSpacing: qp.optionalFloat("es", 0),
+		},
+	}
+
+	if err := p.Overlay.SetParts(q.Get("ov")); err != nil {
+		qp.fail("ov", "must be a list of axes, grid, orbit, labels, scale, equipotentials or fieldlines")
+	}
+	p.Overlay.SetRays(q.Get("ra"))
+
+	aspect := gofr.AspectFit
+	if q.Get("aspect") != "" {
+		a, err := gofr.AspectFromString(q.Get("aspect"))
+		if err != nil {
+			qp.fail("aspect", "must be fit, fill or stretch")
+		}
+		aspect = a
+	}
+
+	// A view is either its corners or its center and magnification.
+	// Either way, pixels are square unless it's stretched.
+	if q.Get("mag") != "" {
+		v := gofr.View{
+			Center:        complex(qp.requiredFloat("cr"), qp.requiredFloat("ci")),
+			Magnification: qp.requiredFloat("mag"),
+			Angle:         p.Angle,
+			Aspect:        aspect,
+		}
+		if errs, ok := v.Validate().(gofr.ValidationError); ok {
+			for _, e := range errs {
+				if key := queryKeys[e.Field]; !qp.failed(key) {
+					qp.fail(key, e.Message)
+				}
+			}
+		}
+		p.SetView(v)
+	} else {
+		p.Min = complex(qp.requiredFloat("rmin"), qp.requiredFloat("imin"))
+		p.Max = complex(qp.requiredFloat("rmax"), qp.requiredFloat("imax"))
+		if width > 0 && height > 0 && real(p.Max) > real(p.Min) && imag(p.Max) > imag(p.Min) {
+			p.CorrectAspect(aspect)
+		}
+	}
+
+	// Anything that didn't parse is already reported; only add what
+	// Validate finds about the rest.
+	failed := map[string]bool{}
+	for _, e := range qp.errs {
+		failed[e.Field] = true
+	}
+
+	if errs, ok := p.Validate().(gofr.ValidationError); ok {
+		for _, e := range errs {
+			key, ok := queryKeys[e.Field]
+			if !ok {
+				key = e.Field
+			}
+			// Corners made from a center are wrong because of the
+			// magnification or the size.
+			if corner[key] && q.Get("mag") != "" {
+				if failed["w"] || failed["h"] {
+					continue
+				}
+				key = "mag"
+			}
+			if failed[key] {
+				continue
+			}
+			failed[key] = true
+			qp.fail(key, e.Message)
+		}
+	}
+
+	if len(qp.errs) > 0 {
+		return p, qp.errs
+	}
+	return p, nil
+}
+
+// finishInvalid reports a gofr.ValidationError as JSON with HTTP 422.
+// Any other error is reported as a single error without a field.
+func finishInvalid(w http.ResponseWriter, err error) {
+	errs, ok := err.(gofr.ValidationError)
+	if !ok {
+		errs = gofr.ValidationError{{Message: err.Error()}}
+	}
+
+	finishJSON(w, http.StatusUnprocessableEntity, struct {
+		Errors gofr.ValidationError `json:"errors"`
+	}{errs})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// ProgressHub fans progress reports out to anyone listening for a
+// given render-id.
+type ProgressHub struct {
+	sync.Mutex
+	subscribers map[string]map[chan gofr.Progress]bool
+}
+
+// NewProgressHub returns an empty ProgressHub.
+func NewProgressHub() *ProgressHub {
+	return &ProgressHub{subscribers: make(map[string]map[chan gofr.Progress]bool)}
+}
+
+var progressHub = NewProgressHub()
+
+// Subscribe returns a channel that receives the latest progress of
+// renders for id. Slow readers only miss intermediate reports.
+func (ph *ProgressHub) Subscribe(id string) chan gofr.Progress {
+	ph.Lock()
+	defer ph.Unlock()
+
+	ch := make(chan gofr.Progress, 1)
+	if ph.subscribers[id] == nil {
+		ph.subscribers[id] = make(map[chan gofr.Progress]bool)
+	}
+	ph.subscribers[id][ch] = true
+
+	return ch
+}
+
+// Unsubscribe stops delivering progress to a channel returned by
+// Subscribe.
+func (ph *ProgressHub) Unsubscribe(id string, ch chan gofr.Progress) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	delete(ph.subscribers[id], ch)
+	if len(ph.subscribers[id]) == 0 {
+		delete(ph.subscribers, id)
+	}
+}
+
+// Publish sends progress to everyone subscribed to id, replacing any
+// report they haven't read yet.
+func (ph *ProgressHub) Publish(id string, p gofr.Progress) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	for ch := range ph.subscribers[id] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- p
+	}
+}
+
+// routeProgress streams the progress of renders for a render-id as
+// Server-Sent Events until the client goes away.
+func routeProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	renderID := r.URL.Query().Get("render-id")
+	if renderID == "" {
+		finishInvalid(w, gofr.ValidationError{{Field: "render-id", Message: "is required"}})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		finish(w, http.StatusInternalServerError, "Streaming unsupported.")
+		return
+	}
+
+	ch := progressHub.Subscribe(renderID)
+	defer progressHub.Unsubscribe(renderID, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case p := <-ch:
+			data, err := json.Marshal(p)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"runtime"
+	"strconv"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// progressiveBoundary separates the passes of a progressive render.
+const progressiveBoundary = "gofr-pass"
+
+// RenderProgressive executes a RenderJob's unit of work coarsely first
+// and then more finely, handing each pass to fn.
+func (rj *RenderJob) RenderProgressive(ctx context.Context, fn gofr.PassFunc) error {
+	return gofr.RenderProgressive(ctx, &rj.Parameters, rj.Threads, rj.Progress, fn)
+}
+
+// writePart writes one pass of a progressive render, already encoded as
+// a PNG, as a part of a multipart response and flushes it to the client.
+func writePart(w http.ResponseWriter, mw *multipart.Writer, body []byte, block int, final bool) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "image/png")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Set("X-Render-Block", strconv.Itoa(block))
+	header.Set("X-Render-Final", strconv.FormatBool(final))
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(body)
+	if err != nil {
+		return err
+	}
+
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// routeProgressive renders the same views as routePNG, but streams a
+// coarse image right away and then finer ones as they're done, as
+// multipart/x-mixed-replace. Each part is a whole PNG.
+func routeProgressive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	q := r.URL.Query()
+
+	p, err := parametersFromQuery(q)
+	if err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	renderID := q.Get("render-id")
+	if renderID == "" {
+		finishInvalid(w, gofr.ValidationError{{Field: "render-id", Message: "is required"}})
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(progressiveBoundary)
+	start := func() {
+		w.Header().Set("Content-Type", fmt.Sprintf("multipart/x-mixed-replace; boundary=%s", progressiveBoundary))
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// A view that's already been rendered needs only its final pass.
+	key := p.Hash()
+	if body, ok := renderCache.Get(key); ok {
+		w.Header().Set("X-Cache", "hit")
+		start()
+		writePart(w, mw, body, 1, true)
+		mw.Close()
+		return
+	}
+
+	memory := p.EstimateProgressiveMemory()
+	if jobMemory > 0 && memory > jobMemory {
+		finishTooLarge(w, memory, jobMemory)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	j := &RenderJob{
+		Parameters: p,
+		Threads:    runtime.NumCPU(),
+		Cancel:     cancel,
+		Progress: func(progress gofr.Progress) {
+			progressHub.Publish(renderID, progress)
+		},
+	}
+	defer registerRenderJob(renderID, j)()
+
+	ticket := enqueueBytes(w, r, memory)
+	if ticket == nil {
+		return
+	}
+	defer ticket.Release()
+
+	err = ticket.Wait(ctx)
+	if err != nil {
+		finishRenderError(w, r, renderID, err)
+		return
+	}
+
+	// The render's time starts once it's out of the queue.
+	ctx, cancelRender := context.WithTimeout(ctx, renderTimeout)
+	defer cancelRender()
+
+	// Once the first pass is sent, the status can't change, so a failure
+	// can only cut the response short.
+	started := false
+	err = j.RenderProgressive(ctx, func(pass gofr.Pass) error {
+		var buf bytes.Buffer
+		err := png.Encode(&buf, pass.Image)
+		if err != nil {
+			return err
+		}
+		if pass.Final {
+			renderCache.Put(key, buf.Bytes())
+		}
+
+		if !started {
+			start()
+			started = true
+		}
+		return writePart(w, mw, buf.Bytes(), pass.Block, pass.Final)
+	})
+
+	switch {
+	case err == nil:
+		mw.Close()
+	case !started:
+		finishRenderError(w, r, renderID, err)
+	default:
+		log.Printf("Unable to finish progressive render %s: %v", renderID, err)
+	}
+}
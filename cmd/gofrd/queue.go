@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// ErrQueueFull is returned when a RenderQueue can't take any more
+// waiting renders.
+var ErrQueueFull = errors.New("Render queue is full.")
+
+// ErrTooLarge is returned when a render needs more memory than a
+// RenderQueue will ever have free.
+var ErrTooLarge = errors.New("Render needs more memory than the server allows.")
+
+// RenderQueue limits how many renders run at once across the whole
+// server, and how much memory they may use between them. Renders that
+// can't start right away wait in per-client queues that are served
+// round-robin, so one busy client can't starve the others.
+type RenderQueue struct {
+	sync.Mutex
+	Limit    int
+	MaxDepth int
+	Memory   uint64
+	running  int
+	waiting  int
+	memory   uint64
+	clients  []string
+	queues   map[string][]*Ticket
+	average  time.Duration
+}
+
+// Ticket is a place in a RenderQueue. Every Ticket must be released.
+type Ticket struct {
+	rq       *RenderQueue
+	client   string
+	bytes    uint64
+	ready    chan struct{}
+	granted  bool
+	released bool
+	start    time.Time
+}
+
+// NewRenderQueue returns a RenderQueue that runs at most limit renders
+// using at most memory bytes at once, with at most depth more waiting.
+// Zero memory means no limit.
+func NewRenderQueue(limit, depth int, memory uint64) *RenderQueue {
+	return &RenderQueue{
+		Limit:    limit,
+		MaxDepth: depth,
+		Memory:   memory,
+		queues:   make(map[string][]*Ticket),
+		average:  time.Second,
+	}
+}
+
+var renderQueue = NewRenderQueue(2, 32, 4<<30)
+
+// clientKey identifies the client that made a request for the
+// purposes of fair scheduling.
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Enqueue takes a place in line for a render by client that needs the
+// given number of bytes. The Ticket is granted right away if a render
+// slot and the memory are free and nobody is waiting. It returns
+// ErrQueueFull if the queue is already at MaxDepth, or ErrTooLarge if
+// the render could never fit in Memory.
+func (rq *RenderQueue) Enqueue(client string, bytes uint64) (*Ticket, error) {
+	rq.Lock()
+	defer rq.Unlock()
+
+	if rq.Memory > 0 && bytes > rq.Memory {
+		return nil, ErrTooLarge
+	}
+
+	t := &Ticket{rq: rq, client: client, bytes: bytes, ready: make(chan struct{})}
+
+	if rq.running < rq.Limit && rq.waiting == 0 && rq.fits(t) {
+		rq.grant(t)
+		return t, nil
+	}
+
+	if rq.waiting >= rq.MaxDepth {
+		return nil, ErrQueueFull
+	}
+
+	if len(rq.queues[client]) == 0 {
+		rq.clients = append(rq.clients, client)
+	}
+	rq.queues[client] = append(rq.queues[client], t)
+	rq.waiting++
+
+	return t, nil
+}
+
+// RetryAfter estimates how long a client turned away with ErrQueueFull
+// should wait before trying again.
+func (rq *RenderQueue) RetryAfter() time.Duration {
+	rq.Lock()
+	defer rq.Unlock()
+
+	limit := rq.Limit
+	if limit < 1 {
+		limit = 1
+	}
+	turns := math.Ceil(float64(rq.waiting+1) / float64(limit))
+	return time.Duration(turns) * rq.average
+}
+
+func (rq *RenderQueue) fits(t *Ticket) bool {
+	return rq.Memory == 0 || rq.memory+t.bytes <= rq.Memory
+}
+
+func (rq *RenderQueue) grant(t *Ticket) {
+	t.granted = true
+	t.start = time.Now()
+	rq.running++
+	rq.memory += t.bytes
+	close(t.ready)
+}
+
+// dispatch grants waiting tickets, one client at a time, until every
+// slot is taken or nobody is waiting. A ticket that doesn't fit in the
+// memory that's left holds up the line rather than be starved by
+// smaller renders behind it.
+func (rq *RenderQueue) dispatch() {
+	for rq.running < rq.Limit && rq.waiting > 0 {
+		client := rq.clients[0]
+		t := rq.queues[client][0]
+		if !rq.fits(t) {
+			break
+		}
+
+		rq.clients = rq.clients[1:]
+		rq.queues[client] = rq.queues[client][1:]
+		rq.waiting--
+
+		if len(rq.queues[client]) > 0 {
+			rq.clients = append(rq.clients, client)
+		} else {
+			delete(rq.queues, client)
+		}
+
+		rq.grant(t)
+	}
+}
+
+// withdraw removes a waiting ticket from its client's queue.
+func (rq *RenderQueue) withdraw(t *Ticket) {
+	queue := rq.queues[t.client]
+	for i, other := range queue {
+		if other == t {
+			rq.queues[t.client] = append(queue[:i], queue[i+1:]...)
+			rq.waiting--
+			break
+		}
+	}
+
+	if len(rq.queues[t.client]) == 0 {
+		delete(rq.queues, t.client)
+		for i, client := range rq.clients {
+			if client == t.client {
+				rq.clients = append(rq.clients[:i], rq.clients[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Wait blocks until the ticket is granted a render slot or ctx is done.
+func (t *Ticket) Wait(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release gives up the ticket's render slot, or its place in line if it
+// was never granted one. It's safe to call more than once.
+func (t *Ticket) Release() {
+	rq := t.rq
+	rq.Lock()
+	defer rq.Unlock()
+
+	if t.released {
+		return
+	}
+	t.released = true
+
+	if !t.granted {
+		// It may have been holding up the line for smaller renders.
+		rq.withdraw(t)
+		rq.dispatch()
+		return
+	}
+
+	// Keep a moving average of how long renders hold a slot for
+	// RetryAfter.
+	rq.average = (3*rq.average + time.Since(t.start)) / 4
+	rq.running--
+	rq.memory -= t.bytes
+	rq.dispatch()
+}
+
+// jobMemory is the most memory a single render may use. Zero means no
+// limit.
+var jobMemory uint64 = 1 << 30
+
+// enqueue takes a place in the render queue for p on behalf of the
+// client that made r. If p is too big to render whole within jobMemory
+// but small enough to stream one band at a time, stream is true and it
+// must be rendered with RenderJob.EncodePNG. If it can't be queued at
+// all, enqueue reports why and returns a nil Ticket.
+func enqueue(w http.ResponseWriter, r *http.Request, p *gofr.Parameters) (ticket *Ticket, stream bool) {
+	bytes := p.EstimateMemory()
+	if jobMemory > 0 && bytes > jobMemory {
+		return enqueueStream(w, r, p), true
+	}
+
+	return enqueueBytes(w, r, bytes), false
+}
+
+// enqueueStream takes a place in the render queue for p, to be rendered
+// with RenderJob.EncodePNG one band at a time, on behalf of the client
+// that made r. If it can't be queued, enqueueStream reports why and
+// returns nil.
+func enqueueStream(w http.ResponseWriter, r *http.Request, p *gofr.Parameters) *Ticket {
+	bytes := p.EstimateStreamMemory(gofr.DefaultBandHeight)
+	if jobMemory > 0 && bytes > jobMemory {
+		finishTooLarge(w, bytes, jobMemory)
+		return nil
+	}
+
+	return enqueueBytes(w, r, bytes)
+}
+
+// enqueueBytes takes a place in the render queue for a render that needs
+// the given number of bytes on behalf of the client that made r. If it
+// can't be queued, enqueueBytes reports why and returns nil.
+func enqueueBytes(w http.ResponseWriter, r *http.Request, bytes uint64) *Ticket {
+	ticket, err := renderQueue.Enqueue(clientKey(r), bytes)
+	switch err {
+	case nil:
+		return ticket
+	case ErrTooLarge:
+		finishTooLarge(w, bytes, renderQueue.Memory)
+	default:
+		finishQueueFull(w)
+	}
+
+	return nil
+}
+
+// finishTooLarge turns a client away with HTTP 413 because a render
+// needs more memory than the budget allows.
+func finishTooLarge(w http.ResponseWriter, bytes, budget uint64) {
+	message := fmt.Sprintf("Render needs %s of memory, more than the %s allowed.",
+		strings.TrimSpace(gofr.PrintByteSize(bytes)),
+		strings.TrimSpace(gofr.PrintByteSize(budget)))
+
+	finishJSON(w, http.StatusRequestEntityTooLarge, struct {
+		Errors gofr.ValidationError `json:"errors"`
+	}{gofr.ValidationError{{Message: message}}})
+}
+
+// finishQueueFull turns a client away with HTTP 429.
+func finishQueueFull(w http.ResponseWriter) {
+	seconds := int(math.Ceil(renderQueue.RetryAfter().Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	finish(w, http.StatusTooManyRequests, ErrQueueFull.Error())
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// rayDepth is how many iterations in /ray follows a ray unless depth
+// asks for more or fewer.
+const rayDepth = 64
+
+// routeRay returns the external ray of angle, as a fraction like 1/3 or
+// in binary like 0.(01), under the same query parameters as /png, with
+// where it lands, as JSON. Tracing takes a turn in the render queue like
+// a render.
+func routeRay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	q := r.URL.Query()
+	qp := queryParser{q: q}
+
+	p, err := parametersFromQuery(q)
+	if err != nil {
+		errs, ok := err.(gofr.ValidationError)
+		if !ok {
+			finishInvalid(w, err)
+			return
+		}
+		qp.errs = errs
+	}
+
+	angle, err := gofr.ParseAngle(q.Get("angle"))
+	if err != nil {
+		qp.fail("angle", "must be a fraction like 1/3 or binary like 0.(01)")
+	}
+
+	depth := qp.optionalInt("depth", rayDepth)
+	if depth < 1 || depth > gofr.MaxRayDepth {
+		qp.fail("depth", "must be between 1 and 4096")
+	}
+
+	if len(qp.errs) > 0 {
+		finishInvalid(w, qp.errs)
+		return
+	}
+
+	renderID := uuid.New().String()
+	ticket := enqueueBytes(w, r, 0)
+	if ticket == nil {
+		return
+	}
+	defer ticket.Release()
+
+	err = ticket.Wait(r.Context())
+	if err != nil {
+		finishRenderError(w, r, renderID, err)
+		return
+	}
+
+	// The trace's time starts once it's out of the queue.
+	ctx, cancel := context.WithTimeout(r.Context(), renderTimeout)
+	defer cancel()
+
+	ray, err := gofr.TraceRay(ctx, &p, angle, depth)
+	if ctx.Err() != nil {
+		finishRenderError(w, r, renderID, ctx.Err())
+		return
+	}
+	if err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	finishJSON(w, http.StatusOK, ray)
+}
+
+// routeMisiurewicz returns the Misiurewicz points in the view of the
+// same query parameters as /png whose critical orbit falls after
+// preperiod steps into a cycle of period period, nearest its center
+// first, as JSON. The search takes a turn in the render queue like a
+// render.
+func routeMisiurewicz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	q := r.URL.Query()
+	qp := queryParser{q: q}
+
+	p, err := parametersFromQuery(q)
+	if err != nil {
+		errs, ok := err.(gofr.ValidationError)
+		if !ok {
+			finishInvalid(w, err)
+			return
+		}
+		qp.errs = errs
+	}
+
+	preperiod, period := qp.requiredInt("preperiod"), qp.requiredInt("period")
+	if !qp.failed("preperiod") && preperiod < 2 {
+		qp.fail("preperiod", "must be at least 2")
+	}
+	if !qp.failed("period") && period < 1 {
+		qp.fail("period", "must be at least 1")
+	}
+	if !qp.failed("preperiod") && !qp.failed("period") && preperiod+period > gofr.MaxNucleusPeriod {
+		qp.fail("period", "must be at most 4096 with the preperiod")
+	}
+
+	if len(qp.errs) > 0 {
+		finishInvalid(w, qp.errs)
+		return
+	}
+
+	renderID := uuid.New().String()
+	ticket := enqueueBytes(w, r, 0)
+	if ticket == nil {
+		return
+	}
+	defer ticket.Release()
+
+	err = ticket.Wait(r.Context())
+	if err != nil {
+		finishRenderError(w, r, renderID, err)
+		return
+	}
+
+	// The search's time starts once it's out of the queue.
+	ctx, cancel := context.WithTimeout(r.Context(), renderTimeout)
+	defer cancel()
+
+	points, err := gofr.FindMisiurewiczPoints(ctx, &p, preperiod, period)
+	if ctx.Err() != nil {
+		finishRenderError(w, r, renderID, ctx.Err())
+		return
+	}
+	if err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	results := []gofr.OrbitPoint{}
+	for _, m := range points {
+		results = append(results, gofr.OrbitPoint(m))
+	}
+	finishJSON(w, http.StatusOK, results)
+}
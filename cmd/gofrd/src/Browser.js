@@ -18,16 +18,26 @@ export default Ractive.extend({
 			view: {},
 			default_bookmarks: {},
 			bookmarks: {},
+			functions: {render: [], color: []},
+			progress: {percent: 0, remaining: 0},
 			render_id: "",
+			waypoints: [],
 		};
 	},
 	on: {
 		render: function() {
-			var marks, view, render_id;
+			var marks, view, render_id, self;
+
+			self = this;
+			fetch("/functions").then(function(response) {
+				return response.json();
+			}).then(function(functions) {
+				self.set("functions", functions);
+			});
 
 			view = JSON.parse(Gofr.storage.getItem("gofr.browser.view"));
 			if(view) {
-				this.set("view", view);
+				this.set("view", this.center_view(view));
 			} else {
 				this.deep_copy("default_bookmarks.mandelbrot", "view");
 			}
@@ -57,7 +67,7 @@ export default Ractive.extend({
 				//
 				// TODO: Impose a delayed queue to coalesce edits or show a ui
 				// element to indicate that the user needs to call for a refresh
-				if(keypath.match(/\.(i|e|s|p|w|h)$/)) return;
+				if(keypath.match(/\.(i|e|s|aa|p|w|h)$/)) return;
 
 				Gofr.storage.setItem("gofr.browser.view", this.json("view"));
 				this.update_view();
@@ -69,19 +79,26 @@ export default Ractive.extend({
 
 			this.observe("render_id", function() {
 				Gofr.storage.setItem("gofr.browser.render-id", this.json("render_id"));
+				this.watch_progress();
 			});
 		},
 		move_up: function() {
-			this.translate_view(0.0, -0.0625 * (this.get("view.imax") - this.get("view.imin")));
+			this.translate_view(0.0, -0.0625);
 		},
 		move_down: function() {
-			this.translate_view(0.0, 0.0625 * (this.get("view.imax") - this.get("view.imin")));
+			this.translate_view(0.0, 0.0625);
 		},
 		move_left: function() {
-			this.translate_view(-0.0625 * (this.get("view.rmax") - this.get("view.rmin")), 0.0);
+			this.translate_view(-0.0625, 0.0);
 		},
 		move_right: function() {
-			this.translate_view(0.0625 * (this.get("view.rmax") - this.get("view.rmin")), 0.0);
+			this.translate_view(0.0625, 0.0);
+		},
+		rotate_left: function() {
+			this.rotate_view(Math.PI / 12);
+		},
+		rotate_right: function() {
+			this.rotate_view(-Math.PI / 12);
 		},
 		zoom_in: function() {
 			this.scale_view(0.9);
@@ -98,12 +115,31 @@ export default Ractive.extend({
 		update_view: function() {
 			this.update_view();
 		},
+		zoom_to_minibrot: function() {
+			this.zoom_to_minibrot();
+		},
+		explore: function() {
+			this.explore();
+		},
+		go_to_waypoint: function(event) {
+			var view, waypoint;
+
+			waypoint = this.get("waypoints")[event.node.dataset.waypoint];
+			if(!waypoint) { return; }
+			view = this.get("view");
+			view.cr = waypoint.cr;
+			view.ci = waypoint.ci;
+			view.mag = waypoint.mag;
+			view.a = waypoint.a;
+			this.update("view");
+		},
 		go_to_bookmark: function(event) {
 			var name;
 
 			name = event.node.dataset.bookmark;
 			if(!(name in this.get("bookmarks"))) { return; }
 			this.deep_copy("bookmarks." + name, "view");
+			this.set("view", this.center_view(this.get("view")));
 		},
 		add_bookmark: function() {
 			var name;
@@ -143,7 +179,13 @@ export default Ractive.extend({
 			editor.fire("edit", "bookmarks", this.json("bookmarks"));
 		},
 		"Editor.saved": function(context, key, text) {
-			this.set(key, JSON.parse(text));
+			var value;
+
+			value = JSON.parse(text);
+			if(key === "view") {
+				value = this.center_view(value);
+			}
+			this.set(key, value);
 		},
 		/*
 		 * TODO: Implement a control with handles and a cancel button so
@@ -164,7 +206,7 @@ export default Ractive.extend({
 			y1 = y0;
 
 			handler = function handler(e) {
-				var cancel, clear, ch, cw, dr, di, h, i, r, v, w;
+				var cancel, center, clear, ch, cw, v;
 
 				cw = self.canvas.width;
 				ch = self.canvas.height;
@@ -191,23 +233,32 @@ export default Ractive.extend({
 					cancel();
 
 					v = self.get("view");
+					center = self.point((x0 + x1) / 2, (y0 + y1) / 2);
 
-					r = v.rmin;
-					i = v.imin;
-					w = v.rmax - r;
-					h = v.imax - i;
-					dr = w / cw;
-					di = h / ch;
-
-					v.rmin = r + dr * x0;
-					v.imin = i + di * y0;
-					v.rmax = r + dr * x1;
-					v.imax = i + di * y1;
+					v.cr = center[0];
+					v.ci = center[1];
+					v.mag *= cw / Math.abs(x1 - x0);
 					self.update("view");
 
 					return;
 				}
 
+				// A click without a drag picks the point whose orbit
+				// the overlay draws.
+				if(e.type === "mouseup") {
+					cancel();
+
+					if((self.get("view.ov") || []).indexOf("orbit") >= 0) {
+						v = self.get("view");
+						center = self.point(x0 + 0.5, y0 + 0.5);
+						v.zr = center[0];
+						v.zi = center[1];
+						self.update("view");
+					}
+
+					return;
+				}
+
 				x1 = e.offsetX;
 				y1 = y0 + ((x1 - x0) * (ch / cw));
 
@@ -239,57 +290,297 @@ export default Ractive.extend({
 			"&c=" +    encodeURIComponent(this.get("view.c")) +
 			"&r=" +    encodeURIComponent(this.get("view.r")) +
 			"&s=" +    encodeURIComponent(this.get("view.s")) +
+			"&aa=" +   encodeURIComponent(this.get("view.aa") || 0) +
 			"&p=" +    encodeURIComponent(this.get("view.p")) +
-			"&rmin=" + encodeURIComponent(this.get("view.rmin")) +
-			"&rmax=" + encodeURIComponent(this.get("view.rmax")) +
-			"&imin=" + encodeURIComponent(this.get("view.imin")) +
-			"&imax=" + encodeURIComponent(this.get("view.imax")) +
-			"&render-id=" + this.get("render-id");
+			"&cr=" +   encodeURIComponent(this.get("view.cr")) +
+			"&ci=" +   encodeURIComponent(this.get("view.ci")) +
+			"&mag=" +  encodeURIComponent(this.get("view.mag")) +
+			"&a=" +    encodeURIComponent(this.get("view.a") || 0) +
+			"&aspect=" + encodeURIComponent(this.get("view.aspect") || "fit") +
+			"&ov=" +   encodeURIComponent((this.get("view.ov") || []).join(",")) +
+			"&oc=" +   encodeURIComponent(this.get("view.oc") || "") +
+			"&zr=" +   encodeURIComponent(this.get("view.zr") || 0) +
+			"&zi=" +   encodeURIComponent(this.get("view.zi") || 0) +
+			"&ra=" +   encodeURIComponent(this.get("view.ra") || "") +
+			"&render-id=" + encodeURIComponent(this.get("render_id"));
 		return url;
 	},
+	watch_progress: function() {
+		var self;
+
+		self = this;
+		if(this.progress_source) {
+			this.progress_source.close();
+		}
+
+		this.progress_source = new EventSource("/progress?render-id=" + encodeURIComponent(this.get("render_id")));
+		this.progress_source.addEventListener("progress", function(event) {
+			var p;
+
+			p = JSON.parse(event.data);
+			self.set("progress", {
+				percent: p.pixels > 0 ? Math.floor(100 * p.pixels_done / p.pixels) : 0,
+				remaining: Math.ceil(p.remaining / 1e9),
+			});
+		});
+	},
+	/*
+	 * Zoom to the minibrot, or other hyperbolic component, nearest the
+	 * center: first of those in the middle of the view, then of those
+	 * anywhere in it.
+	 */
+	zoom_to_minibrot: function() {
+		var find, mag, self;
+
+		self = this;
+		mag = this.get("view.mag");
+		find = function(zoom) {
+			var url;
+
+			url = self.view_url().replace(/^\/png\?/, "/nuclei?").
+				replace(/&mag=[^&]*/, "&mag=" + encodeURIComponent(mag * zoom));
+			return fetch(url).then(function(response) {
+				if(!response.ok) { throw new Error(response.statusText); }
+				return response.json();
+			});
+		};
+
+		find(4).then(function(nuclei) {
+			return nuclei.length > 0 ? nuclei : find(1);
+		}).then(function(nuclei) {
+			var view;
+
+			if(nuclei.length === 0) { return; }
+			view = self.get("view");
+			view.cr = nuclei[0].view.cr;
+			view.ci = nuclei[0].view.ci;
+			view.mag = nuclei[0].view.mag;
+			view.a = nuclei[0].view.a;
+			self.update("view");
+		}).catch(function() {
+			// Leave the view alone if there's nothing to zoom to.
+		});
+	},
+	/*
+	 * Zoom in on the most interesting part of the view a few times over,
+	 * and list the views along the way to pick from.
+	 */
+	explore: function() {
+		var url, self;
+
+		self = this;
+		url = this.view_url().replace(/^\/png\?/, "/explore?") + "&thumb=96";
+		this.set("waypoints", []);
+		fetch(url).then(function(response) {
+			if(!response.ok) { throw new Error(response.statusText); }
+			return response.json();
+		}).then(function(waypoints) {
+			self.set("waypoints", waypoints);
+		}).catch(function() {
+			// Leave the list empty if the exploration failed.
+		});
+	},
+	progressive_url: function() {
+		return this.view_url().replace(/^\/png\?/, "/progressive?");
+	},
+	/*
+	 * Read a multipart/x-mixed-replace response one part at a time,
+	 * calling fn with a Blob of each part as soon as it has arrived.
+	 * Every part must have a Content-Length.
+	 */
+	read_parts: function(response, fn) {
+		var reader, buffer, type;
+
+		reader = response.body.getReader();
+		buffer = new Uint8Array(0);
+		type = "application/octet-stream";
+
+		function headers_end() {
+			var i;
+
+			for(i = 0; i + 3 < buffer.length; i++) {
+				if(buffer[i] == 13 && buffer[i+1] == 10 && buffer[i+2] == 13 && buffer[i+3] == 10) {
+					return i;
+				}
+			}
+			return -1;
+		}
+
+		function take_parts() {
+			var end, headers, length, match;
+
+			for(;;) {
+				end = headers_end();
+				if(end < 0) return;
+
+				headers = new TextDecoder().decode(buffer.slice(0, end));
+				match = headers.match(/content-length:\s*(\d+)/i);
+				if(!match) return;
+				length = parseInt(match[1], 10);
+				if(buffer.length < end + 4 + length) return;
+
+				match = headers.match(/content-type:\s*([^\r\n]+)/i);
+				if(match) type = match[1];
+
+				fn(new Blob([buffer.slice(end + 4, end + 4 + length)], {type: type}));
+				buffer = buffer.slice(end + 4 + length);
+			}
+		}
+
+		function pump() {
+			return reader.read().then(function(result) {
+				var next;
+
+				if(result.done) return;
+
+				next = new Uint8Array(buffer.length + result.value.length);
+				next.set(buffer);
+				next.set(result.value, buffer.length);
+				buffer = next;
+
+				take_parts();
+				return pump();
+			});
+		}
+
+		return pump();
+	},
 	update_view: function() {
-		var i, image, ring, self;
+		var image, progress, self;
 
 		self = this;
 		image = this.find("div#image");
-		ring = this.find("div#ring");
-
-		i = new Image();
-		i.onload = function() {
-			image.style.background = "url(" + self.view_url() + ")";
-			image.style.width = self.get("view.w") + "px";
-			image.style.height = self.get("view.h") + "px";
-			ring.hidden = true;
-		};
-		ring.hidden = false;
-		i.src = this.view_url();
+		progress = this.find("div#progress");
+
+		if(this.render_abort) {
+			this.render_abort.abort();
+		}
+		this.render_abort = new AbortController();
+
+		this.set("progress", {percent: 0, remaining: 0});
+		progress.hidden = false;
+
+		image.style.width = this.get("view.w") + "px";
+		image.style.height = this.get("view.h") + "px";
+
+		// Show each pass as soon as it arrives, coarse ones first.
+		fetch(this.progressive_url(), {signal: this.render_abort.signal}).then(function(response) {
+			if(!response.ok) {
+				throw new Error("render failed: " + response.status);
+			}
+			return self.read_parts(response, function(blob) {
+				var url;
+
+				url = URL.createObjectURL(blob);
+				if(self.pass_url) {
+					URL.revokeObjectURL(self.pass_url);
+				}
+				self.pass_url = url;
+				image.style.background = "url(" + url + ")";
+			});
+		}).then(function() {
+			progress.hidden = true;
+		}).catch(function(error) {
+			if(error.name != "AbortError") {
+				progress.hidden = true;
+			}
+		});
 	},
-	translate_view: function(r, i) {
-		var view;
+	/*
+	 * Views used to be their corners. Convert any that are still stored
+	 * that way to a center, a magnification and an angle, fitted to the
+	 * image.
+	 */
+	center_view: function(view) {
+		var unit;
+
+		view.aspect = view.aspect || "fit";
+		view.ov = view.ov || [];
+		if(view.mag !== undefined) {
+			return view;
+		}
+
+		unit = Math.max((view.rmax - view.rmin) / view.w, (view.imax - view.imin) / view.h);
+		view.cr = (view.rmin + view.rmax) / 2;
+		view.ci = (view.imin + view.imax) / 2;
+		view.mag = 4.0 / (unit * Math.min(view.w, view.h));
+		view.a = 0.0;
+
+		delete view.rmin;
+		delete view.rmax;
+		delete view.imin;
+		delete view.imax;
+
+		return view;
+	},
+	/*
+	 * The width and height of a pixel on the complex plane. A
+	 * magnification of 1 shows 4 units across the shorter side of the
+	 * image if the view fits it, across the longer side if the view fills
+	 * it, and across both if it's stretched.
+	 */
+	unit: function() {
+		var span, view;
+
+		view = this.get("view");
+		span = 4.0 / view.mag;
+
+		switch(view.aspect) {
+		case "fill":
+			return [span / Math.max(view.w, view.h), span / Math.max(view.w, view.h)];
+		case "stretch":
+			return [span / view.w, span / view.h];
+		default:
+			return [span / Math.min(view.w, view.h), span / Math.min(view.w, view.h)];
+		}
+	},
+	/*
+	 * Map a position on the canvas onto the complex plane, turned about
+	 * the center of the view by its angle. Like gofr.Transform, the top
+	 * of the canvas is at the largest imaginary values.
+	 */
+	point: function(x, y) {
+		var a, dr, di, unit, view;
+
+		view = this.get("view");
+		unit = this.unit();
+		a = view.a || 0;
+		dr = (x - view.w / 2) * unit[0];
+		di = (view.h / 2 - y) * unit[1];
+
+		return [
+			view.cr + dr * Math.cos(a) - di * Math.sin(a),
+			view.ci + dr * Math.sin(a) + di * Math.cos(a),
+		];
+	},
+	/*
+	 * Move the view by fractions of its width and height, along the
+	 * edges of the image however it's turned.
+	 */
+	translate_view: function(x, y) {
+		var center, view;
 
 		view = this.get("view");
+		center = this.point((0.5 + x) * view.w, (0.5 + y) * view.h);
 
-		view.rmin += r;
-		view.imin += i;
-		view.rmax += r;
-		view.imax += i;
+		view.cr = center[0];
+		view.ci = center[1];
 
 		this.update("view");
 	},
 	scale_view: function(factor) {
-		var rw, iw, rmid, imid, view;
+		var view;
 
 		view = this.get("view");
+		view.mag /= factor;
 
-		rw = (view.rmax - view.rmin) / 2.0;
-		iw = (view.imax - view.imin) / 2.0;
-		rmid = view.rmin + rw;
-		imid = view.imin + iw;
+		this.update("view");
+	},
+	rotate_view: function(angle) {
+		var view;
 
-		view.rmin = rmid - (rw * factor);
-		view.imin = imid - (iw * factor);
-		view.rmax = rmid + (rw * factor);
-		view.imax = imid + (iw * factor);
+		view = this.get("view");
+		view.a = ((view.a || 0) + angle) % (2 * Math.PI);
 
 		this.update("view");
 	},
@@ -12,10 +12,10 @@ export default {
         r: 'mandelbrot',
         s: 2.0,
         p: 2,
-        rmin: -2.1,
-        rmax: 2.1,
-        imin: -2.1,
-        imax: 2.1,
+        cr: 0.0,
+        ci: 0.0,
+        mag: 0.9523809523809523,
+        a: 0.0,
       },
       three: {
         editable: false,
@@ -28,10 +28,10 @@ export default {
         r: 'mandelbrot',
         s: 2.0,
         p: 3,
-        rmin: -1.4,
-        rmax: 1.4,
-        imin: -1.4,
-        imax: 1.4,
+        cr: 0.0,
+        ci: 0.0,
+        mag: 1.4285714285714286,
+        a: 0.0,
       },
       four: {
         editable: false,
@@ -44,10 +44,10 @@ export default {
         r: 'mandelbrot',
         s: 2.0,
         p: 4,
-        rmin: -1.625,
-        rmax: 1.175,
-        imin: -1.4,
-        imax: 1.4,
+        cr: -0.225,
+        ci: 0.0,
+        mag: 1.4285714285714286,
+        a: 0.0,
       },
       five: {
         editable: false,
@@ -60,10 +60,10 @@ export default {
         r: 'mandelbrot',
         s: 2.0,
         p: 5,
-        rmin: -1.0,
-        rmax: 1.0,
-        imin: -1.0,
-        imax: 1.0,
+        cr: 0.0,
+        ci: 0.0,
+        mag: 2.0,
+        a: 0.0,
       },
     },
   },
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/musl/gofr/lib/gofr"
+)
+
+// tileOrigin and tileSpan place the single tile at zoom level 0 on the
+// complex plane.
+var tileOrigin = complex(-0.5, 0)
+var tileSpan = 4.0
+
+// tileDefaults fill in the query parameters that a tile URL may leave
+// out.
+var tileDefaults = url.Values{
+	"i": {"1000"},
+	"e": {"4"},
+	"c": {"smooth"},
+	"m": {"#000000"},
+}
+
+// parseTilePath reads the fractal and Tile out of a path like
+// /tiles/{fractal}/{z}/{x}/{y}.png.
+func parseTilePath(p string) (string, gofr.Tile, bool) {
+	parts := strings.Split(strings.TrimPrefix(p, "/tiles/"), "/")
+	if len(parts) != 4 || parts[0] == "" || !strings.HasSuffix(parts[3], ".png") {
+		return "", gofr.Tile{}, false
+	}
+
+	var n [3]int
+	for i, part := range []string{parts[1], parts[2], strings.TrimSuffix(parts[3], ".png")} {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return "", gofr.Tile{}, false
+		}
+		n[i] = v
+	}
+
+	tile := gofr.Tile{Z: n[0], X: n[1], Y: n[2]}
+	return parts[0], tile, tile.Validate() == nil
+}
+
+// tileParametersFromQuery builds the Parameters for a tile of a fractal
+// from the same query parameters as /png, except for the bounds and
+// size, which come from the tile.
+func tileParametersFromQuery(fractal string, tile gofr.Tile, q url.Values) (gofr.Parameters, error) {
+	full := url.Values{}
+	for key, values := range tileDefaults {
+		full[key] = values
+	}
+	for key, values := range q {
+		full[key] = values
+	}
+
+	min, max := tile.Bounds(tileOrigin, tileSpan)
+	for _, key := range []string{"cr", "ci", "mag"} {
+		full.Del(key)
+	}
+	full.Set("r", fractal)
+	full.Set("w", strconv.Itoa(gofr.TileSize))
+	full.Set("h", strconv.Itoa(gofr.TileSize))
+	full.Set("rmin", strconv.FormatFloat(real(min), 'g', -1, 64))
+	full.Set("imin", strconv.FormatFloat(imag(min), 'g', -1, 64))
+	full.Set("rmax", strconv.FormatFloat(real(max), 'g', -1, 64))
+	full.Set("imax", strconv.FormatFloat(imag(max), 'g', -1, 64))
+
+	return parametersFromQuery(full)
+}
+
+// routeTile renders XYZ tiles for slippy map viewers, like
+// /tiles/mandelbrot/3/4/2.png?c=smooth&i=500. Tiles are cached like any
+// other render.
+func routeTile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		finish(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	fractal, tile, ok := parseTilePath(r.URL.Path)
+	if !ok {
+		finish(w, http.StatusNotFound, "No such tile.")
+		return
+	}
+
+	p, err := tileParametersFromQuery(fractal, tile, r.URL.Query())
+	if err != nil {
+		finishInvalid(w, err)
+		return
+	}
+
+	key := p.Hash()
+	if startCached(w, r, key) {
+		return
+	}
+
+	// Tiles are cached whole, so they're never streamed.
+	memory := p.EstimateMemory()
+	if jobMemory > 0 && memory > jobMemory {
+		finishTooLarge(w, memory, jobMemory)
+		return
+	}
+
+	ticket := enqueueBytes(w, r, memory)
+	if ticket == nil {
+		return
+	}
+	defer ticket.Release()
+
+	err = ticket.Wait(r.Context())
+	if err != nil {
+		finishRenderError(w, r, key, err)
+		return
+	}
+
+	// The render's time starts once it's out of the queue.
+	ctx, cancel := context.WithTimeout(r.Context(), renderTimeout)
+	defer cancel()
+
+	img, err := gofr.RenderImage(ctx, &p, runtime.NumCPU(), nil)
+	if err != nil {
+		finishRenderError(w, r, key, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		finish(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	renderCache.Put(key, buf.Bytes())
+	cacheHeaders(w, key)
+	finishPNG(w, buf.Bytes())
+}
+
+// finishPNG sends an encoded PNG with HTTP 200.
+func finishPNG(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
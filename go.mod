@@ -5,6 +5,5 @@ go 1.12
 require (
 	github.com/google/uuid v1.1.1
 	github.com/lucasb-eyer/go-colorful v1.0.2
-	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/stretchr/testify v1.3.0
 )
@@ -0,0 +1,235 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+/*
+ * DefaultAdaptiveThreshold is a color difference, as a fraction of full
+ * scale in any channel, past which adaptive anti-aliasing re-samples a
+ * pixel. It's a good starting point for most ColorFuncs.
+ */
+const DefaultAdaptiveThreshold = 0.1
+
+/*
+ * MaxAdaptiveSamples is the largest AdaptiveSamples that Validate
+ * accepts.
+ */
+const MaxAdaptiveSamples = 16
+
+/*
+ * sampler evaluates single points of a Context for renderers that take
+ * more than one sample per pixel. ColorFuncs draw into a one pixel
+ * scratch image so that the sample can be read back.
+ */
+type sampler struct {
+	c         Context
+	transform Transform
+	escape    EscapeFunc
+}
+
+func newSampler(c *Context, escape EscapeFunc) *sampler {
+	s := &sampler{c: *c, transform: c.Transform(), escape: escape}
+	s.c.Image = image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	return s
+}
+
+/*
+ * sample evaluates the point at a position in pixel coordinates.
+ */
+func (self *sampler) sample(x, y float64) (int, color.NRGBA64) {
+	i, z := self.escape(&self.c, self.transform.PixelToPoint(x, y), self.c.MaxI)
+	self.c.ColorFunc(&self.c, z, 0, 0, i, self.c.MaxI)
+	return i, self.c.Image.NRGBA64At(0, 0)
+}
+
+/*
+ * jitter is a repeatable pseudo-random number in [0, 1) for subsample k
+ * of pixel x, y, so that the same Parameters always render the same
+ * image.
+ */
+func jitter(x, y, k int) float64 {
+	h := uint64(x)*0x9e3779b97f4a7c15 ^ uint64(y)*0xc2b2ae3d27d4eb4f ^ uint64(k)*0x165667b19e3779f9
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return float64(h>>11) / (1 << 53)
+}
+
+/*
+ * supersample averages an n by n grid of stratified, jittered samples
+ * across pixel x, y in linear light.
+ */
+func (self *sampler) supersample(x, y, n int) color.NRGBA64 {
+	var sum linearSum
+	for sy := 0; sy < n; sy++ {
+		for sx := 0; sx < n; sx++ {
+			k := sy*n + sx
+			u := (float64(sx) + jitter(x, y, 2*k)) / float64(n)
+			v := (float64(sy) + jitter(x, y, 2*k+1)) / float64(n)
+			_, c := self.sample(float64(x)+u, float64(y)+v)
+			sum.add(c)
+		}
+	}
+	return sum.average()
+}
+
+/*
+ * colorDistance is the largest difference between any channel of two
+ * colors, as a fraction of full scale.
+ */
+func colorDistance(a, b color.NRGBA64) float64 {
+	d := 0
+	for _, c := range [][2]uint16{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}, {a.A, b.A}} {
+		e := int(c[0]) - int(c[1])
+		if e < 0 {
+			e = -e
+		}
+		if e > d {
+			d = e
+		}
+	}
+	return float64(d) / 0xffff
+}
+
+/*
+ * adaptiveRaster is a 1x render with the iteration count of each pixel.
+ */
+type adaptiveRaster struct {
+	image *image.NRGBA64
+	iters []int32
+}
+
+func (self *adaptiveRaster) offset(x, y int) int {
+	b := self.image.Bounds()
+	return (y-b.Min.Y)*b.Dx() + (x - b.Min.X)
+}
+
+/*
+ * edge reports whether pixel x, y differs enough from any of its eight
+ * neighbors to need re-sampling.
+ */
+func (self *adaptiveRaster) edge(x, y int, p *Parameters) bool {
+	b := self.image.Bounds()
+	k := self.image.NRGBA64At(x, y)
+	i := self.iters[self.offset(x, y)]
+
+	for ny := y - 1; ny <= y+1; ny++ {
+		for nx := x - 1; nx <= x+1; nx++ {
+			if !(image.Point{nx, ny}.In(b)) || (nx == x && ny == y) {
+				continue
+			}
+
+			if colorDistance(k, self.image.NRGBA64At(nx, ny)) > p.AdaptiveThreshold {
+				return true
+			}
+
+			if p.AdaptiveIterations > 0 {
+				d := int(i - self.iters[self.offset(nx, ny)])
+				if d < 0 {
+					d = -d
+				}
+				if d > p.AdaptiveIterations {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+ * adaptiveEscape is the EscapeFunc that adaptive anti-aliasing and other
+ * point by point renderers use for a set of Parameters.
+ */
+func adaptiveEscape(p *Parameters) (EscapeFunc, error) {
+	info, ok := LookupRenderFunc(p.RenderFunc)
+	if !ok || info.Escape == nil {
+		return nil, fmt.Errorf("RenderFunc %#v can't be sampled point by point.", p.RenderFunc)
+	}
+	return info.Escape, nil
+}
+
+/*
+ * refine re-samples the pixels of band that differ from their neighbors
+ * in the raster. band must start out as a copy of those rows of the
+ * raster.
+ */
+func (self *adaptiveRaster) refine(ctx context.Context, p *Parameters, threads int, escape EscapeFunc, band *image.NRGBA64) error {
+	contexts, err := MakeContexts(band, gridSize(threads, band.Bounds()), p)
+	if err != nil {
+		return err
+	}
+	for _, c := range contexts {
+		c.RenderFunc = func(ctx context.Context, c *Context) error {
+			s := newSampler(c, escape)
+			return c.EachPoint(ctx, func(x, y int, z complex128) {
+				if self.edge(x, y, p) {
+					c.Image.SetNRGBA64(x, y, s.supersample(x, y, p.AdaptiveSamples))
+				}
+			})
+		}
+	}
+
+	return RenderProgress(ctx, threads, contexts, nil)
+}
+
+/*
+ * renderAdaptiveBand is RenderBand with adaptive anti-aliasing. It
+ * renders one sample per pixel, with an extra row above and below so
+ * that edges between bands are found, then re-samples only the pixels
+ * that differ from their neighbors.
+ */
+func renderAdaptiveBand(ctx context.Context, p *Parameters, threads, y0, y1 int, fn ProgressFunc) (*image.NRGBA64, error) {
+	escape, err := adaptiveEscape(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m0, m1 := y0-1, y1+1
+	if m0 < 0 {
+		m0 = 0
+	}
+	if m1 > p.ImageHeight {
+		m1 = p.ImageHeight
+	}
+
+	raster := &adaptiveRaster{image: image.NewNRGBA64(image.Rect(0, m0, p.ImageWidth, m1))}
+	raster.iters = make([]int32, raster.image.Bounds().Dx()*raster.image.Bounds().Dy())
+
+	contexts, err := MakeContexts(raster.image, gridSize(threads, raster.image.Bounds()), p)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contexts {
+		c.RenderFunc = func(ctx context.Context, c *Context) error {
+			return c.EachPoint(ctx, func(x, y int, z complex128) {
+				i, zn := escape(c, z, c.MaxI)
+				raster.iters[raster.offset(x, y)] = int32(i)
+				c.ColorFunc(c, zn, x, y, i, c.MaxI)
+			})
+		}
+	}
+
+	err = RenderProgress(ctx, threads, contexts, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	band := image.NewNRGBA64(image.Rect(0, y0, p.ImageWidth, y1))
+	draw.Draw(band, band.Bounds(), raster.image, band.Bounds().Min, draw.Src)
+
+	err = raster.refine(ctx, p, threads, escape, band)
+	if err != nil {
+		return nil, err
+	}
+
+	return band, nil
+}
@@ -0,0 +1,390 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Keyframe fixes some numeric fields of Parameters at one frame of an
+ * Animation. Values are keyed by field name, with complex fields by
+ * part, like FieldErrors: "Power", "PaletteOffset", "real(Seed)".
+ */
+type Keyframe struct {
+	Frame  int
+	Values map[string]float64
+}
+
+/*
+ * Interpolation finds the value t of the way from keyframe value a to
+ * keyframe value b. before and after are the values of the keyframes
+ * either side of them, or a and b at the ends, for curves that pass
+ * smoothly through every keyframe.
+ */
+type Interpolation func(before, a, b, after, t float64) float64
+
+/*
+ * Cubic is a Catmull-Rom spline through the keyframes, so that values
+ * change speed smoothly rather than all at once at each keyframe.
+ */
+func Cubic(before, a, b, after, t float64) float64 {
+	t2 := t * t
+	t3 := t2 * t
+	return 0.5 * (2*a +
+		(b-before)*t +
+		(2*before-5*a+4*b-after)*t2 +
+		(3*a-before-3*b+after)*t3)
+}
+
+/*
+ * InterpolationFromString looks up an Interpolation by name: "cubic",
+ * or the name of one of Easings, which eases from each keyframe to the
+ * next.
+ */
+func InterpolationFromString(name string) (Interpolation, error) {
+	if name == "cubic" {
+		return Cubic, nil
+	}
+
+	e, ok := Easings[name]
+	if !ok {
+		names := []string{"cubic"}
+		for n := range Easings {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Invalid interpolation name: %#v, expected one of %v", name, names)
+	}
+
+	return func(before, a, b, after, t float64) float64 {
+		return a + (b-a)*e(t)
+	}, nil
+}
+
+/*
+ * fixedFields are the fields of Parameters that set the size of a frame,
+ * which every frame of an Animation must share.
+ */
+var fixedFields = map[string]bool{
+	"Width":       true,
+	"Height":      true,
+	"ImageWidth":  true,
+	"ImageHeight": true,
+	"Scaling":     true,
+}
+
+/*
+ * parameterField is a numeric field of some Parameters, or one part of a
+ * complex field.
+ */
+type parameterField struct {
+	v    reflect.Value
+	part string
+}
+
+/*
+ * lookupField finds a field of p by the name a Keyframe knows it by.
+ */
+func lookupField(p *Parameters, name string) (parameterField, error) {
+	field, part := name, ""
+	for _, prefix := range []string{"real", "imag"} {
+		if strings.HasPrefix(name, prefix+"(") && strings.HasSuffix(name, ")") {
+			field, part = name[len(prefix)+1:len(name)-1], prefix
+		}
+	}
+
+	if fixedFields[field] {
+		return parameterField{}, fmt.Errorf("%s can't be animated", name)
+	}
+
+	v := reflect.ValueOf(p).Elem().FieldByName(field)
+	if !v.IsValid() || !v.CanSet() {
+		return parameterField{}, fmt.Errorf("%s isn't a field of Parameters", name)
+	}
+
+	switch v.Kind() {
+	case reflect.Complex128:
+		if part == "" {
+			return parameterField{}, fmt.Errorf("%s is complex; animate real(%s) and imag(%s)", name, name, name)
+		}
+	case reflect.Int, reflect.Float64:
+		if part != "" {
+			return parameterField{}, fmt.Errorf("%s isn't complex", field)
+		}
+	default:
+		return parameterField{}, fmt.Errorf("%s isn't numeric", name)
+	}
+
+	return parameterField{v, part}, nil
+}
+
+func (self parameterField) set(f float64) {
+	switch self.v.Kind() {
+	case reflect.Int:
+		self.v.SetInt(int64(math.Floor(f + 0.5)))
+	case reflect.Float64:
+		self.v.SetFloat(f)
+	case reflect.Complex128:
+		z := self.v.Complex()
+		if self.part == "real" {
+			self.v.SetComplex(complex(f, imag(z)))
+		} else {
+			self.v.SetComplex(complex(real(z), f))
+		}
+	}
+}
+
+/*
+ * Animation moves any numeric fields of Parameters from keyframe to
+ * keyframe over Frames frames. Each field follows its own keyframes, and
+ * holds still before the first and after the last of them; fields
+ * without keyframes stay as they are in Start.
+ */
+type Animation struct {
+	Start         Parameters
+	Frames        int
+	Keyframes     []Keyframe
+	Interpolation Interpolation
+}
+
+/*
+ * Validate returns an error if an Animation can't be rendered.
+ */
+func (self *Animation) Validate() error {
+	if self.Frames < 1 {
+		return fmt.Errorf("An animation needs at least one frame: %d", self.Frames)
+	}
+
+	seen := map[string]bool{}
+	p := self.Start
+	for _, k := range self.Keyframes {
+		if k.Frame < 0 || k.Frame >= self.Frames {
+			return fmt.Errorf("Keyframe %d is outside of frames 0 to %d", k.Frame, self.Frames-1)
+		}
+		for name, v := range k.Values {
+			if _, err := lookupField(&p, name); err != nil {
+				return fmt.Errorf("Keyframe %d: %v", k.Frame, err)
+			}
+			key := fmt.Sprint(k.Frame, name)
+			if seen[key] {
+				return fmt.Errorf("Keyframe %d sets %s more than once", k.Frame, name)
+			}
+			seen[key] = true
+			if !finite(v) {
+				return fmt.Errorf("Keyframe %d: %s must be finite", k.Frame, name)
+			}
+		}
+	}
+
+	if err := self.Start.Validate(); err != nil {
+		return err
+	}
+
+	// Every frame must render, including those where a cubic curve
+	// overshoots between keyframes, so that an animation can't fail
+	// partway through.
+	keyframes := map[int]bool{}
+	for _, k := range self.Keyframes {
+		keyframes[k.Frame] = true
+	}
+	tracks := self.tracks()
+	for n := 0; n < self.Frames; n++ {
+		p := self.frame(tracks, n)
+		if err := p.Validate(); err != nil {
+			if keyframes[n] {
+				return fmt.Errorf("Keyframe %d: %v", n, err)
+			}
+			return fmt.Errorf("Frame %d, between keyframes: %v", n, err)
+		}
+	}
+
+	return nil
+}
+
+/*
+ * animationKey is one keyframe of a single field.
+ */
+type animationKey struct {
+	frame int
+	value float64
+}
+
+/*
+ * tracks gathers the keyframes of each field in order of frame.
+ */
+func (self *Animation) tracks() map[string][]animationKey {
+	tracks := map[string][]animationKey{}
+	for _, k := range self.Keyframes {
+		for name, v := range k.Values {
+			tracks[name] = append(tracks[name], animationKey{k.Frame, v})
+		}
+	}
+	for _, keys := range tracks {
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].frame < keys[j].frame
+		})
+	}
+	return tracks
+}
+
+/*
+ * value is where a track of keys is at frame n.
+ */
+func (self *Animation) value(keys []animationKey, n int) float64 {
+	last := len(keys) - 1
+	if n <= keys[0].frame {
+		return keys[0].value
+	}
+	if n >= keys[last].frame {
+		return keys[last].value
+	}
+
+	i := sort.Search(len(keys), func(i int) bool {
+		return keys[i].frame > n
+	}) - 1
+	a, b := keys[i], keys[i+1]
+	before, after := a, b
+	if i > 0 {
+		before = keys[i-1]
+	}
+	if i+2 <= last {
+		after = keys[i+2]
+	}
+
+	interpolate := self.Interpolation
+	if interpolate == nil {
+		interpolate = Cubic
+	}
+	t := float64(n-a.frame) / float64(b.frame-a.frame)
+	return interpolate(before.value, a.value, b.value, after.value, t)
+}
+
+/*
+ * Frame is the Parameters of frame n, counting from 0. Fields that don't
+ * name a numeric field of Parameters are ignored; Validate reports them.
+ */
+func (self *Animation) Frame(n int) Parameters {
+	return self.frame(self.tracks(), n)
+}
+
+/*
+ * frame is the Parameters of frame n given the Animation's tracks.
+ */
+func (self *Animation) frame(tracks map[string][]animationKey, n int) Parameters {
+	p := self.Start
+	for name, keys := range tracks {
+		f, err := lookupField(&p, name)
+		if err != nil {
+			continue
+		}
+		f.set(self.value(keys, n))
+	}
+	return p
+}
+
+type animationFrame struct {
+	n   int
+	img *image.NRGBA64
+	err error
+}
+
+/*
+ * RenderAnimation renders every frame of an Animation and hands each to
+ * fn in order. Frames don't depend on each other, so each of threads
+ * workers renders whole frames by itself, and frames that finish early
+ * wait for fn. At most two frames per thread are held at once.
+ */
+func RenderAnimation(ctx context.Context, a *Animation, threads int, progress ProgressFunc, fn FrameFunc) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	frames := make(chan int)
+	results := make(chan animationFrame, threads)
+	window := make(chan struct{}, 2*threads)
+
+	go func() {
+		defer close(frames)
+		for n := 0; n < a.Frames; n++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case frames <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range frames {
+				p := a.Frame(n)
+				img, err := RenderImage(ctx, &p, 1, nil)
+				select {
+				case results <- animationFrame{n, img, err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	pixels := int64(a.Start.ImageWidth) * int64(a.Start.ImageHeight)
+	report := Progress{Tiles: a.Frames, Pixels: int64(a.Frames) * pixels}
+	start := time.Now()
+
+	pending := map[int]*image.NRGBA64{}
+	for next := 0; next < a.Frames; {
+		var r animationFrame
+		select {
+		case r = <-results:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if r.err != nil {
+			return r.err
+		}
+		pending[r.n] = r.img
+
+		report.TilesDone++
+		report.PixelsDone += pixels
+		if progress != nil {
+			report.estimate(start)
+			progress(report)
+		}
+
+		for img, ok := pending[next]; ok; img, ok = pending[next] {
+			delete(pending, next)
+			if err := fn(next, img); err != nil {
+				return err
+			}
+			<-window
+			next++
+		}
+	}
+
+	return nil
+}
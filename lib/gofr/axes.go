@@ -1,166 +1,261 @@
 package gofr
 
 import (
+	"image"
 	"image/color"
 	"math"
 )
 
-func DrawAxesInv(c *Context) {
-	var x, y int
-	context_min := c.Image.Bounds().Min
-	context_max := c.Image.Bounds().Max
-
-	zmin := c.Min
-	zmax := c.Max
-
-	zw := real(zmax) - real(zmin)
-	zh := imag(zmax) - imag(zmin)
-
-	dx := float64(c.ImageWidth) / zw
-	dy := float64(c.ImageHeight) / zh
+/*
+ * canvas is an image to draw overlays on, which may be only a band or a
+ * Context's part of a whole width by height image that transform maps
+ * onto the plane. Everything is laid out on the whole image and clipped
+ * to the part, so the parts of an overlay drawn separately line up.
+ */
+type canvas struct {
+	image         *image.NRGBA64
+	width, height int
+	transform     Transform
+}
 
-	x = int(math.Max(math.Abs(real(zmin))*dx, 0))
-	y = int(math.Max(math.Abs(imag(zmin))*dy, 0.0))
+/*
+ * contextCanvas is the canvas of a Context's part of its render.
+ */
+func contextCanvas(c *Context) canvas {
+	return canvas{c.Image, c.ImageWidth, c.ImageHeight, c.Transform()}
+}
 
-	for ay := context_min.Y; ay < context_max.Y; ay++ {
-		inv := c.Image.At(x, ay).(color.NRGBA64)
-		c.Image.Set(x, ay, color.NRGBA64{^inv.R, ^inv.G, ^inv.B, 0xffff})
+/*
+ * plotFunc marks one pixel of an overlay.
+ */
+type plotFunc func(x, y int)
+
+/*
+ * blend returns a plotFunc that moves the pixels it marks toward the
+ * color that to gives for them, by alpha out of 0xffff.
+ */
+func (self canvas) blend(alpha uint16, to func(color.NRGBA64) color.NRGBA64) plotFunc {
+	a := uint32(alpha)
+	mix := func(x, y uint16) uint16 {
+		return uint16((uint32(x)*a + uint32(y)*(0xffff-a)) / 0xffff)
 	}
 
-	for ax := context_min.X; ax < context_max.X; ax++ {
-		inv := c.Image.At(ax, y).(color.NRGBA64)
-		c.Image.Set(ax, y, color.NRGBA64{^inv.R, ^inv.G, ^inv.B, 0xffff})
+	return func(x, y int) {
+		if !(image.Point{x, y}.In(self.image.Bounds())) {
+			return
+		}
+		bg := self.image.NRGBA64At(x, y)
+		k := to(bg)
+		self.image.SetNRGBA64(x, y, color.NRGBA64{mix(k.R, bg.R), mix(k.G, bg.G), mix(k.B, bg.B), 0xffff})
 	}
 }
 
-func DrawAxesColor(c *Context, k color.NRGBA64) {
-	var x, y int
-	context_min := c.Image.Bounds().Min
-	context_max := c.Image.Bounds().Max
-
-	zmin := c.Min
-	zmax := c.Max
-
-	zw := real(zmax) - real(zmin)
-	zh := imag(zmax) - imag(zmin)
-
-	dx := float64(c.ImageWidth) / zw
-	dy := float64(c.ImageHeight) / zh
+func (self canvas) invert() plotFunc {
+	return self.blend(0xffff, func(k color.NRGBA64) color.NRGBA64 {
+		return color.NRGBA64{^k.R, ^k.G, ^k.B, 0xffff}
+	})
+}
 
-	x = int(math.Max(math.Abs(real(zmin))*dx, 0))
-	y = int(math.Max(math.Abs(imag(zmin))*dy, 0.0))
+/*
+ * paint marks pixels with k, blended over what's there by its alpha.
+ */
+func (self canvas) paint(k color.NRGBA64) plotFunc {
+	return self.blend(k.A, func(color.NRGBA64) color.NRGBA64 {
+		return k
+	})
+}
 
-	for ay := context_min.Y; ay < context_max.Y; ay++ {
-		c.Image.Set(x, ay, k)
+/*
+ * line marks the pixels along the line through pixel position p in
+ * direction d, one for each column or row, whichever there are more of
+ * along it.
+ */
+func (self canvas) line(p, d [2]float64, plot plotFunc) {
+	major, minor := 0, 1
+	if math.Abs(d[1]) > math.Abs(d[0]) {
+		major, minor = 1, 0
 	}
-
-	for ax := context_min.X; ax < context_max.X; ax++ {
-		c.Image.Set(ax, y, k)
+	if d[major] == 0 {
+		return
 	}
-}
-
-func DrawTicksColor(c *Context, tl int, unit float64, k color.NRGBA64) {
-	var x, y, i int
-	var n float64
-
-	zmin := c.Min
-	zmax := c.Max
-
-	zw := real(zmax) - real(zmin)
-	zh := imag(zmax) - imag(zmin)
-
-	dx := float64(c.ImageWidth) / zw
-	dy := float64(c.ImageHeight) / zh
-
-	x = int(math.Max(math.Abs(real(zmin))*dx, 0))
-	y = int(math.Max(math.Abs(imag(zmin))*dy, 0.0))
 
-	for n = 0.0; n <= real(zmax); n += unit {
-		tx := x + int(n*dx)
-		for i = -1 * tl; i <= tl; i++ {
-			ty := y + i
-			c.Image.Set(tx, ty, k)
+	b := self.image.Bounds()
+	lo := [2]int{b.Min.X, b.Min.Y}
+	hi := [2]int{b.Max.X, b.Max.Y}
+	slope := d[minor] / d[major]
+
+	for k := lo[major]; k < hi[major]; k++ {
+		var pt [2]int
+		pt[major] = k
+		pt[minor] = int(math.Floor(p[minor] + (float64(k)+0.5-p[major])*slope))
+		if pt[minor] >= lo[minor] && pt[minor] < hi[minor] {
+			plot(pt[0], pt[1])
 		}
 	}
+}
 
-	for n = 0.0; n >= real(zmin); n -= unit {
-		tx := x + int(n*dx)
-		for i = -1 * tl; i <= tl; i++ {
-			ty := y + i
-			c.Image.Set(tx, ty, k)
+/*
+ * segment marks the pixels along the line from pixel position a to b,
+ * one for each column or row between them, whichever there are more of.
+ */
+func (self canvas) segment(a, b [2]float64, plot plotFunc) {
+	for _, v := range []float64{a[0], a[1], b[0], b[1]} {
+		if !finite(v) {
+			return
 		}
 	}
 
-	for n = 0.0; n <= imag(zmax); n += unit {
-		ty := y + int(n*dy)
-		for i = -1 * tl; i <= tl; i++ {
-			tx := x + i
-			c.Image.Set(tx, ty, k)
-		}
+	d := [2]float64{b[0] - a[0], b[1] - a[1]}
+	major, minor := 0, 1
+	if math.Abs(d[1]) > math.Abs(d[0]) {
+		major, minor = 1, 0
+	}
+	if d[major] == 0 {
+		plot(int(math.Floor(a[0])), int(math.Floor(a[1])))
+		return
 	}
 
-	for n = 0.0; n >= imag(zmin); n -= unit {
-		ty := y + int(n*dy)
-		for i = -1 * tl; i <= tl; i++ {
-			tx := x + i
-			c.Image.Set(tx, ty, k)
+	r := self.image.Bounds()
+	lo := [2]int{r.Min.X, r.Min.Y}
+	hi := [2]int{r.Max.X, r.Max.Y}
+	from := math.Max(float64(lo[major]), math.Ceil(math.Min(a[major], b[major])-0.5))
+	to := math.Min(float64(hi[major]-1), math.Floor(math.Max(a[major], b[major])-0.5))
+	if from > to {
+		return
+	}
+	slope := d[minor] / d[major]
+
+	for k := int(from); float64(k) <= to; k++ {
+		var pt [2]int
+		pt[major] = k
+		pt[minor] = int(math.Floor(a[minor] + (float64(k)+0.5-a[major])*slope))
+		if pt[minor] >= lo[minor] && pt[minor] < hi[minor] {
+			plot(pt[0], pt[1])
 		}
 	}
 }
 
-func DrawTicksInv(c *Context, tl int, unit float64) {
-	var x, y, i int
-	var n float64
+func (self canvas) pixel(z complex128) [2]float64 {
+	x, y := self.transform.PointToPixel(z)
+	return [2]float64{x, y}
+}
 
-	zmin := c.Min
-	zmax := c.Max
+func (self canvas) direction(a, b complex128) [2]float64 {
+	dx, dy := self.transform.Direction(a, b)
+	return [2]float64{dx, dy}
+}
 
-	zw := real(zmax) - real(zmin)
-	zh := imag(zmax) - imag(zmin)
+/*
+ * visible is the box on the plane around where the corners of the whole
+ * image land, which everything in view is inside.
+ */
+func (self canvas) visible() (lo, hi complex128) {
+	w, h := float64(self.width), float64(self.height)
+	lo, hi = complex(math.Inf(1), math.Inf(1)), complex(math.Inf(-1), math.Inf(-1))
+	for _, corner := range [][2]float64{{0, 0}, {w, 0}, {0, h}, {w, h}} {
+		z := self.transform.PixelToPoint(corner[0], corner[1])
+		lo = complex(math.Min(real(lo), real(z)), math.Min(imag(lo), imag(z)))
+		hi = complex(math.Max(real(hi), real(z)), math.Max(imag(hi), imag(z)))
+	}
+	return
+}
 
-	dx := float64(c.ImageWidth) / zw
-	dy := float64(c.ImageHeight) / zh
+/*
+ * multiples are the whole numbers of units between lo and hi, or none
+ * if there are more than limit of them.
+ */
+func multiples(lo, hi, unit float64, limit int) []float64 {
+	if unit <= 0 || (hi-lo)/unit > float64(limit) {
+		return nil
+	}
+
+	ks := []float64{}
+	for k := math.Ceil(lo / unit); k <= math.Floor(hi/unit); k++ {
+		ks = append(ks, k)
+	}
+	return ks
+}
 
-	x = int(math.Max(math.Abs(real(zmin))*dx, 0))
-	y = int(math.Max(math.Abs(imag(zmin))*dy, 0.0))
+/*
+ * maxLines is how many grid lines or ticks along each axis a canvas
+ * draws at most; any more would be less than a pixel apart.
+ */
+func (self canvas) maxLines() int {
+	return 2 * (self.width + self.height)
+}
 
-	for n = 0.0; n <= real(zmax); n += unit {
-		tx := x + int(n*dx)
-		for i = -1 * tl; i <= tl; i++ {
-			ty := y + i
+/*
+ * axes marks the real and imaginary axes, wherever and however they
+ * cross the view.
+ */
+func (self canvas) axes(plot plotFunc) {
+	o := self.pixel(0)
+	self.line(o, self.direction(0, 1), plot)
+	self.line(o, self.direction(0, 1i), plot)
+}
 
-			inv := c.Image.At(tx, ty).(color.NRGBA64)
-			c.Image.Set(tx, ty, color.NRGBA64{^inv.R, ^inv.G, ^inv.B, 0xffff})
+/*
+ * ticks marks every multiple of unit along each axis with a tick tl
+ * pixels long on either side.
+ */
+func (self canvas) ticks(tl int, unit float64, plot plotFunc) {
+	lo, hi := self.visible()
+
+	tick := func(z complex128, across [2]float64) {
+		p := self.pixel(z)
+		length := math.Hypot(across[0], across[1])
+		for i := -tl; i <= tl; i++ {
+			plot(
+				int(math.Floor(p[0]+float64(i)*across[0]/length)),
+				int(math.Floor(p[1]+float64(i)*across[1]/length)),
+			)
 		}
 	}
 
-	for n = 0.0; n >= real(zmin); n -= unit {
-		tx := x + int(n*dx)
-		for i = -1 * tl; i <= tl; i++ {
-			ty := y + i
+	across := self.direction(0, 1i)
+	for _, k := range multiples(real(lo), real(hi), unit, self.maxLines()) {
+		tick(complex(k*unit, 0), across)
+	}
 
-			inv := c.Image.At(tx, ty).(color.NRGBA64)
-			c.Image.Set(tx, ty, color.NRGBA64{^inv.R, ^inv.G, ^inv.B, 0xffff})
-		}
+	across = self.direction(0, 1)
+	for _, k := range multiples(imag(lo), imag(hi), unit, self.maxLines()) {
+		tick(complex(0, k*unit), across)
 	}
+}
 
-	for n = 0.0; n <= imag(zmax); n += unit {
-		ty := y + int(n*dy)
-		for i = -1 * tl; i <= tl; i++ {
-			tx := x + i
+/*
+ * grid marks lines along every multiple of unit on each axis.
+ */
+func (self canvas) grid(unit float64, plot plotFunc) {
+	lo, hi := self.visible()
 
-			inv := c.Image.At(tx, ty).(color.NRGBA64)
-			c.Image.Set(tx, ty, color.NRGBA64{^inv.R, ^inv.G, ^inv.B, 0xffff})
-		}
+	along := self.direction(0, 1i)
+	for _, k := range multiples(real(lo), real(hi), unit, self.maxLines()) {
+		self.line(self.pixel(complex(k*unit, 0)), along, plot)
 	}
 
-	for n = 0.0; n >= imag(zmin); n -= unit {
-		ty := y + int(n*dy)
-		for i = -1 * tl; i <= tl; i++ {
-			tx := x + i
-
-			inv := c.Image.At(tx, ty).(color.NRGBA64)
-			c.Image.Set(tx, ty, color.NRGBA64{^inv.R, ^inv.G, ^inv.B, 0xffff})
-		}
+	along = self.direction(0, 1)
+	for _, k := range multiples(imag(lo), imag(hi), unit, self.maxLines()) {
+		self.line(self.pixel(complex(0, k*unit)), along, plot)
 	}
 }
+
+func DrawAxesInv(c *Context) {
+	cv := contextCanvas(c)
+	cv.axes(cv.invert())
+}
+
+func DrawAxesColor(c *Context, k color.NRGBA64) {
+	cv := contextCanvas(c)
+	cv.axes(cv.paint(k))
+}
+
+func DrawTicksColor(c *Context, tl int, unit float64, k color.NRGBA64) {
+	cv := contextCanvas(c)
+	cv.ticks(tl, unit, cv.paint(k))
+}
+
+func DrawTicksInv(c *Context, tl int, unit float64) {
+	cv := contextCanvas(c)
+	cv.ticks(tl, unit, cv.invert())
+}
@@ -0,0 +1,326 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"time"
+)
+
+/*
+ * DefaultBandHeight is how many rows of output RenderImage and
+ * BandedImage render at a time.
+ */
+const DefaultBandHeight = 64
+
+/*
+ * Samples is the supersampling factor: how many pixels of the
+ * ImageWidth by ImageHeight render go across and down each pixel of the
+ * Width by Height result. Without Scaling, the two sizes must be whole
+ * multiples of each other.
+ */
+func (self *Parameters) Samples() (int, error) {
+	if self.Scaling > 0 {
+		return self.Scaling, nil
+	}
+
+	w := int(self.Width)
+	h := int(self.Height)
+	if w > 0 && h > 0 && self.ImageWidth%w == 0 && self.ImageWidth/w == self.ImageHeight/h && self.ImageHeight%h == 0 {
+		return self.ImageWidth / w, nil
+	}
+
+	return 0, fmt.Errorf("ImageWidth and ImageHeight must be the same whole multiple of Width and Height.")
+}
+
+/*
+ * RenderBand renders rows y0 through y1-1 of the Width by Height result,
+ * supersampling each pixel and averaging the samples as it goes. The
+ * returned image has the same bounds as those rows of the result, with
+ * the Overlay drawn over them.
+ */
+func RenderBand(ctx context.Context, p *Parameters, threads, y0, y1 int, fn ProgressFunc) (*image.NRGBA64, error) {
+	band, err := renderBand(ctx, p, threads, y0, y1, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := traceOverlay(ctx, p, threads).draw(band, p, true); err != nil {
+		return nil, err
+	}
+	return band, nil
+}
+
+/*
+ * renderBand is RenderBand without the Overlay.
+ */
+func renderBand(ctx context.Context, p *Parameters, threads, y0, y1 int, fn ProgressFunc) (*image.NRGBA64, error) {
+	if p.AdaptiveSamples > 0 {
+		return renderAdaptiveBand(ctx, p, threads, y0, y1, fn)
+	}
+
+	s, err := p.Samples()
+	if err != nil {
+		return nil, err
+	}
+
+	raster := image.NewNRGBA64(image.Rect(0, y0*s, p.ImageWidth, y1*s))
+
+	contexts, err := MakeContexts(raster, gridSize(threads, raster.Bounds()), p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = RenderProgress(ctx, threads, contexts, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == 1 {
+		return raster, nil
+	}
+
+	band := image.NewNRGBA64(image.Rect(0, y0, int(p.Width), y1))
+	downsample(band, raster, s)
+	return band, nil
+}
+
+/*
+ * gridSize is how many Contexts across and down to divide r into for
+ * the given number of threads.
+ */
+func gridSize(threads int, r image.Rectangle) int {
+	n := threads
+	if d := r.Dy(); n > d {
+		n = d
+	}
+	if d := r.Dx(); n > d {
+		n = d
+	}
+	return n
+}
+
+/*
+ * downsample averages each s by s block of src into one pixel of dst in
+ * linear light.
+ */
+func downsample(dst, src *image.NRGBA64, s int) {
+	b := dst.Bounds()
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var sum linearSum
+			for sy := y * s; sy < (y+1)*s; sy++ {
+				for sx := x * s; sx < (x+1)*s; sx++ {
+					sum.add(src.NRGBA64At(sx, sy))
+				}
+			}
+			dst.SetNRGBA64(x, y, sum.average())
+		}
+	}
+}
+
+/*
+ * bandProgress turns the progress of each band into the progress of
+ * the whole image. Tiles are bands.
+ */
+type bandProgress struct {
+	fn       ProgressFunc
+	start    time.Time
+	progress Progress
+}
+
+func newBandProgress(p *Parameters, bands int, fn ProgressFunc) *bandProgress {
+	return &bandProgress{
+		fn:    fn,
+		start: time.Now(),
+		progress: Progress{
+			Tiles:  bands,
+			Pixels: int64(p.ImageWidth) * int64(p.ImageHeight),
+		},
+	}
+}
+
+/*
+ * band returns a ProgressFunc for the next band.
+ */
+func (self *bandProgress) band() ProgressFunc {
+	if self.fn == nil {
+		return nil
+	}
+
+	done := self.progress.PixelsDone
+	return func(band Progress) {
+		// Bands may render a few pixels more than their share.
+		self.progress.PixelsDone = done + band.PixelsDone
+		if self.progress.PixelsDone > self.progress.Pixels {
+			self.progress.PixelsDone = self.progress.Pixels
+		}
+		self.progress.estimate(self.start)
+		self.fn(self.progress)
+	}
+}
+
+func (self *bandProgress) finishBand() {
+	self.progress.TilesDone++
+}
+
+/*
+ * RenderImage renders the Width by Height result of a set of Parameters
+ * one band of rows at a time, so that the full supersampled render never
+ * has to exist at once.
+ */
+func RenderImage(ctx context.Context, p *Parameters, threads int, fn ProgressFunc) (*image.NRGBA64, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	h := int(p.Height)
+	img := image.NewNRGBA64(image.Rect(0, 0, int(p.Width), h))
+	bp := newBandProgress(p, (h+DefaultBandHeight-1)/DefaultBandHeight, fn)
+	overlay := traceOverlay(ctx, p, threads)
+
+	for y := 0; y < h; y += DefaultBandHeight {
+		y1 := y + DefaultBandHeight
+		if y1 > h {
+			y1 = h
+		}
+
+		band, err := renderBand(ctx, p, threads, y, y1, bp.band())
+		if err != nil {
+			return nil, err
+		}
+		if err := overlay.draw(band, p, true); err != nil {
+			return nil, err
+		}
+		draw.Draw(img, band.Bounds(), band, band.Bounds().Min, draw.Src)
+		bp.finishBand()
+	}
+
+	return img, nil
+}
+
+/*
+ * BandedImage is an image.Image of the Width by Height result of a set
+ * of Parameters that renders itself one band of rows at a time as it is
+ * read. It's meant to be read from top to bottom, as image encoders do,
+ * so that images far larger than memory can be streamed to a file.
+ * Reading rows out of order re-renders bands.
+ */
+type BandedImage struct {
+	ctx        context.Context
+	params     *Parameters
+	threads    int
+	bandHeight int
+	band       *image.NRGBA64
+	overlay    *tracedOverlay
+	progress   *bandProgress
+	err        error
+}
+
+/*
+ * NewBandedImage returns a BandedImage that renders bandHeight rows at a
+ * time with the given number of threads.
+ */
+func NewBandedImage(ctx context.Context, p *Parameters, threads, bandHeight int, fn ProgressFunc) *BandedImage {
+	if bandHeight < 1 {
+		bandHeight = DefaultBandHeight
+	}
+
+	h := int(p.Height)
+	img := &BandedImage{
+		ctx:        ctx,
+		params:     p,
+		threads:    threads,
+		bandHeight: bandHeight,
+		band:       image.NewNRGBA64(image.Rectangle{}),
+		progress:   newBandProgress(p, (h+bandHeight-1)/bandHeight, fn),
+		err:        p.Validate(),
+	}
+	if img.err == nil {
+		img.overlay = traceOverlay(ctx, p, threads)
+	}
+	return img
+}
+
+/*
+ * Err returns the first error encountered while rendering. Once there
+ * has been an error, the rest of the image reads as transparent black.
+ */
+func (self *BandedImage) Err() error {
+	return self.err
+}
+
+func (self *BandedImage) ColorModel() color.Model {
+	return color.NRGBA64Model
+}
+
+func (self *BandedImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, int(self.params.Width), int(self.params.Height))
+}
+
+/*
+ * Opaque lets encoders skip scanning the whole image for transparency,
+ * which would render it twice. RenderFuncs and ColorFuncs draw opaque
+ * pixels.
+ */
+func (self *BandedImage) Opaque() bool {
+	return true
+}
+
+func (self *BandedImage) At(x, y int) color.Color {
+	return self.NRGBA64At(x, y)
+}
+
+func (self *BandedImage) NRGBA64At(x, y int) color.NRGBA64 {
+	if self.err != nil {
+		return color.NRGBA64{}
+	}
+
+	if !(image.Point{x, y}.In(self.band.Bounds())) {
+		if !(image.Point{x, y}.In(self.Bounds())) {
+			return color.NRGBA64{}
+		}
+
+		y0 := y - y%self.bandHeight
+		y1 := y0 + self.bandHeight
+		if h := int(self.params.Height); y1 > h {
+			y1 = h
+		}
+
+		// Let go of the last band before making the next one.
+		self.band = image.NewNRGBA64(image.Rectangle{})
+		self.band, self.err = renderBand(self.ctx, self.params, self.threads, y0, y1, self.progress.band())
+		if self.err == nil {
+			self.err = self.overlay.draw(self.band, self.params, true)
+		}
+		if self.err != nil {
+			self.band = image.NewNRGBA64(image.Rectangle{})
+			return color.NRGBA64{}
+		}
+		self.progress.finishBand()
+	}
+
+	return self.band.NRGBA64At(x, y)
+}
+
+/*
+ * EncodePNG streams a PNG of the Width by Height result of a set of
+ * Parameters to w, rendering bandHeight rows at a time.
+ */
+func EncodePNG(ctx context.Context, w io.Writer, p *Parameters, threads, bandHeight int, fn ProgressFunc) error {
+	img := NewBandedImage(ctx, p, threads, bandHeight, fn)
+	if err := img.Err(); err != nil {
+		return err
+	}
+
+	err := png.Encode(w, img)
+	if img.Err() != nil {
+		return img.Err()
+	}
+	return err
+}
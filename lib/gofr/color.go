@@ -6,6 +6,7 @@ import (
 	"math"
 	"math/cmplx"
 	"strconv"
+	"sync"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
@@ -42,40 +43,19 @@ func HclaToNRGBA64(h, c, l, a float64) color.NRGBA64 {
 }
 
 func ColorFuncFromString(name string) (ColorFunc, error) {
-	switch name {
-	case "smooth":
-		return ColorSmooth, nil
-	case "bands":
-		return ColorBands, nil
-	case "gray":
-		return ColorGray, nil
-	case "mono":
-		return ColorMono, nil
-	case "stripe":
-		return ColorMonoStripe, nil
-	case "parti":
-		return ColorParti, nil
-	case "superparti":
-		return ColorSuperParti, nil
-	case "check":
-		return ColorCheck, nil
-	case "softspectrum":
-		return ColorSoftSpectrum, nil
-	case "fire":
-		return ColorFire, nil
-	case "ice":
-		return ColorIce, nil
-	case "unicornrainbow":
-		return ColorUnicornRainbow, nil
-	case "e1":
-		return ColorExperiment1, nil
-	default:
+	info, ok := LookupColorFunc(name)
+	if !ok {
 		return nil, fmt.Errorf("Invalid ColorFunc name: %#v", name)
 	}
+	return info.Func, nil
 }
 
 func MemberColorFromString(hex string) (color.NRGBA64, error) {
-	mc, err := strconv.ParseInt(hex[1:len(hex)], 16, 32)
+	if len(hex) != 7 || hex[0] != '#' {
+		return color.NRGBA64{0, 0, 0, 0}, fmt.Errorf("Invalid member color: %#v", hex)
+	}
+
+	mc, err := strconv.ParseUint(hex[1:], 16, 32)
 	if err != nil {
 		return color.NRGBA64{0, 0, 0, 0}, err
 	}
@@ -92,19 +72,28 @@ func MemberColorFromString(hex string) (color.NRGBA64, error) {
 
 type ColorFunc func(*Context, complex128, int, int, int, int)
 
+/*
+ * smoothIteration is the continuous iteration count at which z escaped
+ * after i iterations, shifted along the palette by PaletteOffset.
+ */
+func (self *Context) smoothIteration(z complex128, i int) float64 {
+	d := self.degree()
+	log_zn := math.Log(real(z)*real(z)+imag(z)*imag(z)) / 2.0
+	nu := math.Log(log_zn/math.Log(d)) / math.Log(d)
+	return float64(i) + 1.0 - nu + self.PaletteOffset
+}
+
 func ColorSmooth(c *Context, z complex128, x, y, i, max_i int) {
 	if i == max_i {
 		c.Image.SetNRGBA64(x, y, c.MemberColor)
 		return
 	}
 
-	log_zn := math.Log(real(z)*real(z)+imag(z)*imag(z)) / 2.0
-	nu := math.Log(log_zn/math.Log(float64(c.Power))) / math.Log(float64(c.Power))
-	j := float64(i) + 1.0 - nu
+	j := c.smoothIteration(z, i)
 
 	// TODO: this kinda looks like the bands coloring algorithm, but
 	// doesn't match. the 4.75 factor is a guess.
-	t := (math.Pi / (4.75 * float64(c.Power))) * j
+	t := (math.Pi / (4.75 * c.degree())) * j
 
 	k := color.NRGBA64{
 		centeredUint16(math.Sin(math.Pi + t)),
@@ -122,7 +111,7 @@ func ColorBands(c *Context, z complex128, x, y, i, max_i int) {
 		return
 	}
 
-	t := (float64(max_i) / math.Pi) * (float64(i) / float64(max_i))
+	t := (float64(max_i) / math.Pi) * ((float64(i) + c.PaletteOffset) / float64(max_i))
 
 	k := color.NRGBA64{
 		centeredUint16(math.Sin(math.Pi + t)),
@@ -248,9 +237,7 @@ func ColorSoftSpectrum(ctx *Context, z complex128, x, y, i, max_i int) {
 		return
 	}
 
-	log_zn := math.Log(real(z)*real(z)+imag(z)*imag(z)) / 2.0
-	nu := math.Log(log_zn/math.Log(float64(ctx.Power))) / math.Log(float64(ctx.Power))
-	j := float64(i) + 1.0 - nu
+	j := ctx.smoothIteration(z, i)
 
 	h := 0.5 + 0.5*math.Sin(0.125*math.Pi*j)
 	c := 0.5 + 0.333*math.Sin(0.0625*math.Pi*j)
@@ -265,9 +252,7 @@ func colorSmoothMono(ctx *Context, z complex128, x, y, i, max_i int, hue float64
 		return
 	}
 
-	log_zn := math.Log(real(z)*real(z)+imag(z)*imag(z)) / 2.0
-	nu := math.Log(log_zn/math.Log(float64(ctx.Power))) / math.Log(float64(ctx.Power))
-	j := float64(i) + 1.0 - nu
+	j := ctx.smoothIteration(z, i)
 
 	c := 0.5 + 0.5*math.Sin(0.0625*math.Pi*j)
 	l := 0.5 + 0.5*math.Sin(0.03125*math.Pi*j)
@@ -289,9 +274,7 @@ func ColorUnicornRainbow(ctx *Context, z complex128, x, y, i, max_i int) {
 		return
 	}
 
-	log_zn := math.Log(real(z)*real(z)+imag(z)*imag(z)) / 2.0
-	nu := math.Log(log_zn/math.Log(float64(ctx.Power))) / math.Log(float64(ctx.Power))
-	j := float64(i) + 1.0 - nu
+	j := ctx.smoothIteration(z, i)
 
 	h := 0.5 + 0.5*math.Sin(0.125*math.Pi*j)
 	c := 1.0
@@ -311,9 +294,7 @@ func ColorExperiment1(ctx *Context, z complex128, x, y, i, max_i int) {
 		return
 	}
 
-	log_zn := math.Log(real(z)*real(z)+imag(z)*imag(z)) / 2.0
-	nu := math.Log(log_zn/math.Log(float64(ctx.Power))) / math.Log(float64(ctx.Power))
-	j := float64(i) + 1.0 - nu
+	j := ctx.smoothIteration(z, i)
 
 	h := 0.5 + 0.5*math.Sin(0.125*math.Pi*j)
 	c := 1.0
@@ -321,3 +302,73 @@ func ColorExperiment1(ctx *Context, z complex128, x, y, i, max_i int) {
 
 	ctx.Image.SetNRGBA64(x, y, HclaToNRGBA64(h, c, l, 1.0))
 }
+
+var linearTable []float32
+var linearTableOnce sync.Once
+
+/*
+ * toLinear converts a 16-bit sRGB channel to linear light between 0 and
+ * 1, so that colors can be averaged the way light adds up.
+ */
+func toLinear(v uint16) float64 {
+	linearTableOnce.Do(func() {
+		linearTable = make([]float32, 1<<16)
+		for i := range linearTable {
+			c := float64(i) / 0xffff
+			if c <= 0.04045 {
+				linearTable[i] = float32(c / 12.92)
+			} else {
+				linearTable[i] = float32(math.Pow((c+0.055)/1.055, 2.4))
+			}
+		}
+	})
+	return float64(linearTable[v])
+}
+
+/*
+ * fromLinear converts linear light between 0 and 1 back to a 16-bit
+ * sRGB channel.
+ */
+func fromLinear(l float64) uint16 {
+	var c float64
+	switch {
+	case l <= 0:
+		return 0
+	case l >= 1:
+		return 0xffff
+	case l <= 0.0031308:
+		c = l * 12.92
+	default:
+		c = 1.055*math.Pow(l, 1/2.4) - 0.055
+	}
+	return uint16(c*0xffff + 0.5)
+}
+
+/*
+ * linearSum adds up colors in linear light. Alpha is added as is.
+ */
+type linearSum struct {
+	r, g, b, a float64
+	n          int
+}
+
+func (self *linearSum) add(k color.NRGBA64) {
+	self.r += toLinear(k.R)
+	self.g += toLinear(k.G)
+	self.b += toLinear(k.B)
+	self.a += float64(k.A)
+	self.n++
+}
+
+func (self *linearSum) average() color.NRGBA64 {
+	if self.n == 0 {
+		return color.NRGBA64{}
+	}
+	n := float64(self.n)
+	return color.NRGBA64{
+		fromLinear(self.r / n),
+		fromLinear(self.g / n),
+		fromLinear(self.b / n),
+		uint16(self.a/n + 0.5),
+	}
+}
@@ -1,8 +1,11 @@
 package gofr
 
 import (
+	"context"
+	"fmt"
 	"image"
 	"image/color"
+	"sync/atomic"
 )
 
 /*
@@ -22,6 +25,47 @@ type Parameters struct {
 	Min          complex128
 	Scaling      int
 	Power        int
+
+	/*
+	 * Julia renders the Julia set of Seed instead: every point starts
+	 * the iteration, and Seed is added at each step.
+	 */
+	Julia bool
+	Seed  complex128
+
+	/*
+	 * Exponent is the real power of RenderFuncs like multibrot that
+	 * aren't limited to whole powers; zero means Power. PaletteOffset
+	 * shifts smooth colorings along their palettes, in iterations.
+	 */
+	Exponent      float64
+	PaletteOffset float64
+
+	/*
+	 * Angle turns the view anticlockwise about the center of Min to Max,
+	 * in radians. Affine, if set, transforms it about the center before
+	 * it's turned.
+	 */
+	Angle  float64
+	Affine *Affine
+
+	/*
+	 * Overlay is drawn over the Width by Height result once it's
+	 * rendered.
+	 */
+	Overlay Overlay
+
+	/*
+	 * Adaptive anti-aliasing: when AdaptiveSamples is more than zero,
+	 * pixels whose color differs from a neighbor's by more than
+	 * AdaptiveThreshold, or whose iteration count differs by more than
+	 * AdaptiveIterations, are re-sampled AdaptiveSamples by
+	 * AdaptiveSamples times. Zero AdaptiveIterations ignores iteration
+	 * counts.
+	 */
+	AdaptiveSamples    int
+	AdaptiveThreshold  float64
+	AdaptiveIterations int
 }
 
 /*
@@ -29,7 +73,6 @@ type Parameters struct {
  * work for a render job to be run in one thread.
  */
 type Context struct {
-	Cancel       chan bool
 	RenderFunc   RenderFunc
 	ColorFunc    ColorFunc
 	EscapeRadius float64
@@ -43,55 +86,75 @@ type Context struct {
 	Min          complex128
 	Scaling      int
 	Power        int
+
+	Julia         bool
+	Seed          complex128
+	Exponent      float64
+	PaletteOffset float64
+
+	Angle  float64
+	Affine *Affine
+
+	pixelsDone *int64
 }
 
-func MakeContexts(im *image.NRGBA64, n int, p *Parameters) (c []*Context) {
+/*
+ * MakeContexts divides an image into an n by n grid of Contexts that
+ * can be rendered in parallel. The image may be any part of the
+ * ImageWidth by ImageHeight render described by the Parameters. It
+ * returns an error if the Parameters don't validate or the image can't
+ * be divided that way.
+ */
+func MakeContexts(im *image.NRGBA64, n int, p *Parameters) ([]*Context, error) {
+	var c []*Context
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
 	r := im.Bounds()
-	x := 0
-	y := 0
-	dx := r.Max.X / n
-	dy := r.Max.Y / n
-	rx := dx + (r.Max.X % n)
-	ry := dy + (r.Max.Y % n)
-	w := dx
-	h := dy
+
+	if n <= 0 {
+		return nil, fmt.Errorf("Refusing to make %d contexts of an image.", n)
+	}
+
+	if n > r.Dx() || n > r.Dy() {
+		return nil, fmt.Errorf("Refusing to make more contexts than there are pixels: %d > %v", n, r.Size())
+	}
+
+	dx := r.Dx() / n
+	dy := r.Dy() / n
 
 	mc, err := MemberColorFromString(p.MemberColor)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	cf, err := ColorFuncFromString(p.ColorFunc)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	rf, err := RenderFuncFromString(p.RenderFunc)
 	if err != nil {
-		panic(err)
-	}
-
-	if n <= 0 {
-		panic("I refuse to make zero or fewer contexts of an image.")
-	}
-
-	if n > r.Max.X || n > r.Max.Y {
-		panic("I refuse to make more contexts than I have pixels.")
+		return nil, err
 	}
 
 	for i := 0; i < n; i++ {
-		x = i * dx
+		x0 := r.Min.X + i*dx
+		x1 := x0 + dx
 		if i == n-1 {
-			w = rx
+			x1 = r.Max.X
 		}
 
 		for j := 0; j < n; j++ {
-			y = j * dy
+			y0 := r.Min.Y + j*dy
+			y1 := y0 + dy
 			if j == n-1 {
-				h = ry
+				y1 = r.Max.Y
 			}
 
-			sub := im.SubImage(image.Rect(x, y, x+w, y+h)).(*image.NRGBA64)
+			sub := im.SubImage(image.Rect(x0, y0, x1, y1)).(*image.NRGBA64)
 			nc := Context{
 				RenderFunc:   rf,
 				ColorFunc:    cf,
@@ -106,15 +169,28 @@ func MakeContexts(im *image.NRGBA64, n int, p *Parameters) (c []*Context) {
 				Min:          p.Min,
 				Scaling:      p.Scaling,
 				Power:        p.Power,
+
+				Julia:         p.Julia,
+				Seed:          p.Seed,
+				Exponent:      p.Exponent,
+				PaletteOffset: p.PaletteOffset,
+
+				Angle:  p.Angle,
+				Affine: p.Affine,
 			}
 
 			c = append(c, &nc)
 		}
 	}
 
-	return
+	return c, nil
 }
 
+/*
+ * Delta is how far apart pixels are on the complex plane before the view
+ * is turned or transformed. dx and dy differ if Min to Max isn't the
+ * shape of the image; see Parameters.SquarePixels.
+ */
 func (self *Context) Delta() (dx, dy float64) {
 	rw := self.ImageWidth
 	rh := self.ImageHeight
@@ -127,6 +203,30 @@ func (self *Context) Delta() (dx, dy float64) {
 	return
 }
 
+/*
+ * constant is what each iteration at point z adds: z itself, or Seed
+ * for a Julia set.
+ */
+func (self *Context) constant(z complex128) complex128 {
+	if self.Julia {
+		return self.Seed
+	}
+	return z
+}
+
+/*
+ * degree is the power that z is raised to at each iteration.
+ */
+func (self *Context) degree() float64 {
+	if self.Exponent > 0 {
+		return self.Exponent
+	}
+	if self.Power > 0 {
+		return float64(self.Power)
+	}
+	return 2
+}
+
 /*
 * Use this with EachPoint to iterate over the map of pixel coordinates
 * and mapped complex points.
@@ -134,25 +234,27 @@ func (self *Context) Delta() (dx, dy float64) {
 type ContextFunc func(int, int, complex128)
 
 /*
-* Iterate over the map of pixel coordinates and complex points.
+* Iterate over the map of pixel coordinates and complex points, at the
+* center of each pixel. Stops early and returns ctx.Err() if ctx is done.
  */
-func (self *Context) EachPoint(fn ContextFunc, cancel chan bool) {
+func (self *Context) EachPoint(ctx context.Context, fn ContextFunc) error {
 	rmin := self.Image.Bounds().Min
 	rmax := self.Image.Bounds().Max
-	cmin := self.Min
-	dx, dy := self.Delta()
-	var z complex128
+	t := self.Transform()
 
 	for x := rmin.X; x < rmax.X; x++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		for y := rmin.Y; y < rmax.Y; y++ {
-			z = complex(real(cmin)+float64(x)*dx, imag(cmin)+float64(y)*dy)
-			fn(x, y, z)
+			fn(x, y, t.PixelToPoint(float64(x)+0.5, float64(y)+0.5))
+		}
 
-			select {
-			case <-cancel:
-				return
-			default:
-			}
+		if self.pixelsDone != nil {
+			atomic.AddInt64(self.pixelsDone, int64(rmax.Y-rmin.Y))
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,122 @@
+package gofr
+
+import (
+	"context"
+	"image/color"
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+/*
+ * coverage is how much of a pixel a line width pixels wide covers when
+ * its center is at the distance d in pixels from the line.
+ */
+func coverage(d, width float64) float64 {
+	return math.Max(0, math.Min(1, width/2+0.5-d))
+}
+
+/*
+ * contourCover is how much of each pixel of the canvas' image, row by
+ * row, from 0 to 0xffff, is covered by the equipotentials of the points
+ * outside the set, at every multiple of spacing of the smooth iteration
+ * count that the ColorFuncs use, and its field lines, where the last
+ * point of each orbit crosses the real axis, so that the cells of a
+ * binary decomposition are between them. They're width pixels wide and
+ * anti-aliased by how far each pixel is from them, which is estimated
+ * from the derivative of the orbit. Each pixel is iterated again, with
+ * up to threads goroutines taking a row at a time, until ctx is done.
+ */
+func (self canvas) contourCover(ctx context.Context, p *Parameters, equipotentials, fieldLines bool, spacing, width float64, threads int) ([]uint16, error) {
+	b := self.image.Bounds()
+	cover := make([]uint16, b.Dx()*b.Dy())
+
+	c, step, err := stepContext(p)
+	if err != nil {
+		return cover, nil
+	}
+
+	pixel := cmplx.Abs(self.transform.PixelToPoint(1, 0) - self.transform.PixelToPoint(0, 0))
+	lnd := math.Log(c.degree())
+
+	at := func(x, y int) float64 {
+		z := self.transform.PixelToPoint(float64(x)+0.5, float64(y)+0.5)
+		i, zn, dz := follow(c, step, z, nil)
+		if i >= c.MaxI {
+			return 0
+		}
+
+		// How fast log(zn) changes across the plane, in pixels.
+		lnr := math.Log(cmplx.Abs(zn))
+		g := cmplx.Abs(dz/zn) * pixel
+		if !finite(g) || g == 0 || !(lnr > 0) {
+			return 0
+		}
+
+		cover := 0.0
+		if equipotentials {
+			j := c.smoothIteration(zn, i) - c.PaletteOffset
+			d := math.Abs(j-spacing*math.Round(j/spacing)) * lnd * lnr / g
+			cover = math.Max(cover, coverage(d, width))
+		}
+		if fieldLines {
+			a := math.Abs(cmplx.Phase(zn))
+			d := math.Min(a, math.Pi-a) / g
+			cover = math.Max(cover, coverage(d, width))
+		}
+		return cover
+	}
+
+	if threads < 1 {
+		threads = 1
+	}
+	rows := make(chan int, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for n := 0; n < threads; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				if ctx.Err() != nil {
+					return
+				}
+				row := cover[(y-b.Min.Y)*b.Dx():]
+				for x := b.Min.X; x < b.Max.X; x++ {
+					row[x-b.Min.X] = uint16(math.Round(0xffff * at(x, y)))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cover, nil
+}
+
+/*
+ * contours draws the contours that cover, from contourCover, covers of
+ * each pixel of the canvas' image in color k, or inverted over what's
+ * there.
+ */
+func (self canvas) contours(cover []uint16, k color.NRGBA64, inv bool) {
+	b := self.image.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			f := cover[(y-b.Min.Y)*b.Dx()+x-b.Min.X]
+			if f == 0 {
+				continue
+			}
+
+			kk := k
+			kk.A = uint16(uint32(k.A) * uint32(f) / 0xffff)
+			self.plotter(kk, inv)(x, y)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package gofr
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"time"
+)
+
+/*
+ * DeepZoom describes a Deep Zoom Image pyramid, as OpenSeadragon and
+ * other deep zoom viewers read them: every level is half the size of the
+ * next, down to a single pixel, and each level is cut into TileSize
+ * square tiles that overlap their neighbors by Overlap pixels.
+ */
+type DeepZoom struct {
+	TileSize int
+	Overlap  int
+}
+
+/*
+ * DefaultDeepZoom is the tiling OpenSeadragon's own tools use.
+ */
+var DefaultDeepZoom = DeepZoom{TileSize: 254, Overlap: 1}
+
+/*
+ * DeepZoomFunc receives each rendered tile of a pyramid.
+ */
+type DeepZoomFunc func(level, col, row int, img *image.NRGBA64) error
+
+/*
+ * MaxLevel is the level of the pyramid at full size. Level 0 is one
+ * pixel.
+ */
+func (self DeepZoom) MaxLevel(p *Parameters) int {
+	n := int(p.Width)
+	if h := int(p.Height); h > n {
+		n = h
+	}
+
+	level := 0
+	for size := 1; size < n; size *= 2 {
+		level++
+	}
+	return level
+}
+
+/*
+ * LevelSize is the width and height in pixels of a level.
+ */
+func (self DeepZoom) LevelSize(p *Parameters, level int) (w, h int) {
+	shift := uint(self.MaxLevel(p) - level)
+	scale := 1 << shift
+
+	w = (int(p.Width) + scale - 1) / scale
+	h = (int(p.Height) + scale - 1) / scale
+	return
+}
+
+/*
+ * Tiles is how many columns and rows of tiles a level has.
+ */
+func (self DeepZoom) Tiles(p *Parameters, level int) (cols, rows int) {
+	w, h := self.LevelSize(p, level)
+	return (w + self.TileSize - 1) / self.TileSize, (h + self.TileSize - 1) / self.TileSize
+}
+
+/*
+ * TileRect is the part of a level a tile covers, overlap included.
+ */
+func (self DeepZoom) TileRect(p *Parameters, level, col, row int) image.Rectangle {
+	w, h := self.LevelSize(p, level)
+
+	r := image.Rect(col*self.TileSize, row*self.TileSize, (col+1)*self.TileSize, (row+1)*self.TileSize)
+	r.Min.X -= self.Overlap
+	r.Min.Y -= self.Overlap
+	r.Max.X += self.Overlap
+	r.Max.Y += self.Overlap
+
+	return r.Intersect(image.Rect(0, 0, w, h))
+}
+
+/*
+ * TileParameters are a set of Parameters that render one tile of the
+ * pyramid straight from the fractal at its level's resolution. Pixels
+ * keep their size across a level even where rounding up the level's size
+ * reaches a little past real(Max) or below imag(Min). Tiles leave out
+ * the Overlay, which is laid out for a whole image.
+ */
+func (self DeepZoom) TileParameters(p *Parameters, level, col, row int) (Parameters, error) {
+	scale := float64(uint64(1) << uint(self.MaxLevel(p)-level))
+	dx := (real(p.Max) - real(p.Min)) / float64(p.Width) * scale
+	dy := (imag(p.Max) - imag(p.Min)) / float64(p.Height) * scale
+
+	s, err := p.Samples()
+	if err != nil {
+		return *p, err
+	}
+
+	r := self.TileRect(p, level, col, row)
+	t := *p
+	// Rows run down from imag(Max), as they do in a Transform.
+	t.Min, t.Max = p.crop((p.Min+p.Max)/2,
+		complex(real(p.Min)+float64(r.Min.X)*dx, imag(p.Max)-float64(r.Max.Y)*dy),
+		complex(real(p.Min)+float64(r.Max.X)*dx, imag(p.Max)-float64(r.Min.Y)*dy))
+	t.Width = uint(r.Dx())
+	t.Height = uint(r.Dy())
+	t.ImageWidth = r.Dx() * s
+	t.ImageHeight = r.Dy() * s
+	t.Scaling = s
+	t.Overlay = Overlay{}
+
+	return t, t.Validate()
+}
+
+/*
+ * Descriptor is the XML .dzi file that describes the pyramid.
+ */
+func (self DeepZoom) Descriptor(p *Parameters) ([]byte, error) {
+	type size struct {
+		Width  uint `xml:",attr"`
+		Height uint `xml:",attr"`
+	}
+	descriptor := struct {
+		XMLName  xml.Name `xml:"http://schemas.microsoft.com/deepzoom/2008 Image"`
+		Format   string   `xml:",attr"`
+		Overlap  int      `xml:",attr"`
+		TileSize int      `xml:",attr"`
+		Size     size
+	}{
+		Format:   "png",
+		Overlap:  self.Overlap,
+		TileSize: self.TileSize,
+		Size:     size{p.Width, p.Height},
+	}
+
+	body, err := xml.MarshalIndent(descriptor, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+/*
+ * RenderDeepZoom renders every tile of the pyramid for a set of
+ * Parameters, from level 0 up, and hands each to fn.
+ */
+func RenderDeepZoom(ctx context.Context, p *Parameters, dz DeepZoom, threads int, progress ProgressFunc, fn DeepZoomFunc) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if dz.TileSize < 1 || dz.Overlap < 0 {
+		return fmt.Errorf("Invalid deep zoom tiling: %d pixel tiles with %d pixels of overlap", dz.TileSize, dz.Overlap)
+	}
+
+	s, err := p.Samples()
+	if err != nil {
+		return err
+	}
+
+	top := dz.MaxLevel(p)
+	bp := &bandProgress{fn: progress, start: time.Now()}
+	for level := 0; level <= top; level++ {
+		cols, rows := dz.Tiles(p, level)
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				r := dz.TileRect(p, level, col, row)
+				bp.progress.Tiles++
+				bp.progress.Pixels += int64(r.Dx()*s) * int64(r.Dy()*s)
+			}
+		}
+	}
+
+	for level := 0; level <= top; level++ {
+		cols, rows := dz.Tiles(p, level)
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				t, err := dz.TileParameters(p, level, col, row)
+				if err != nil {
+					return err
+				}
+
+				img, err := RenderImage(ctx, &t, threads, bp.band())
+				if err != nil {
+					return err
+				}
+				bp.finishBand()
+
+				err = fn(level, col, row, img)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,23 +1,23 @@
 package gofr
 
 import (
+	"context"
 	"math"
 	"math/cmplx"
 )
 
-func Ebrot(c *Context, cancel chan bool) int {
+func Ebrot(ctx context.Context, c *Context) error {
 	maxI := c.MaxI
 	fn := func(x, y int, z complex128) {
 		i, zn := EBrotEscape(c, z, maxI)
 		c.ColorFunc(c, zn, x, y, i, maxI)
 	}
-	c.EachPoint(fn, cancel)
-	return 0
+	return c.EachPoint(ctx, fn)
 }
 
 func EBrotEscape(c *Context, z complex128, maxI int) (int, complex128) {
 	i := 0
-	z0 := z
+	z0 := c.constant(z)
 	zn := complex(0, 0)
 	e := complex(math.E, math.E)
 	//p := complex(float64(c.Power), 0)
@@ -37,6 +37,9 @@ func EBrotEscape(c *Context, z complex128, maxI int) (int, complex128) {
 
 		i++
 	}
+}
 
-	return i, z0
+func EBrotStep(c *Context, z complex128) (complex128, complex128) {
+	e := complex(math.E, math.E)
+	return cmplx.Pow(z, e), e * cmplx.Pow(z, e-1)
 }
@@ -1,25 +1,25 @@
 package gofr
 
 import (
+	"context"
 	"math"
 	"math/cmplx"
 )
 
 // Experimental is
-func Experimental(c *Context, cancel chan bool) int {
+func Experimental(ctx context.Context, c *Context) error {
 	maxI := c.MaxI
 	fn := func(x, y int, z complex128) {
 		i, zn := Escape(c, z, maxI)
 		c.ColorFunc(c, zn, x, y, i, maxI)
 	}
-	c.EachPoint(fn, cancel)
-	return 0
+	return c.EachPoint(ctx, fn)
 }
 
 // ExperimentalEscape is
 func ExperimentalEscape(c *Context, z complex128, maxI int) (int, complex128) {
 	i := 0
-	z0 := z
+	z0 := c.constant(z)
 	zn := complex(0, 0)
 	p := c.Power
 
@@ -58,6 +58,4 @@ func ExperimentalEscape(c *Context, z complex128, maxI int) (int, complex128) {
 
 		i++
 	}
-
-	return i, z0
 }
@@ -0,0 +1,351 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+/*
+ * Interest is how Explore scores how interesting a part of a view is,
+ * from the iteration counts of its pixels.
+ */
+type Interest int
+
+const (
+	/*
+	 * InterestEntropy is the entropy of the histogram of iteration
+	 * counts, which is highest where there are many of them in even
+	 * amounts.
+	 */
+	InterestEntropy Interest = iota
+
+	/*
+	 * InterestBoundary is how many pairs of neighboring pixels have
+	 * different iteration counts, which is highest where the bands of
+	 * iteration counts crowd together near the boundary of the set.
+	 */
+	InterestBoundary
+
+	/*
+	 * InterestVariance is the variance of the iteration counts of the
+	 * pixels that escape.
+	 */
+	InterestVariance
+)
+
+/*
+ * Interests are the names of the Interests that InterestFromString knows.
+ */
+var Interests = map[string]Interest{
+	"entropy":  InterestEntropy,
+	"boundary": InterestBoundary,
+	"variance": InterestVariance,
+}
+
+/*
+ * InterestFromString looks up one of Interests by name.
+ */
+func InterestFromString(name string) (Interest, error) {
+	if i, ok := Interests[name]; ok {
+		return i, nil
+	}
+
+	names := []string{}
+	for n := range Interests {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return InterestEntropy, fmt.Errorf("Invalid interest name: %#v, expected one of %v", name, names)
+}
+
+func (self Interest) String() string {
+	for name, i := range Interests {
+		if i == self {
+			return name
+		}
+	}
+	return fmt.Sprintf("Interest(%d)", int(self))
+}
+
+const (
+	/*
+	 * MaxExploreLevels is the most levels an Exploration goes down.
+	 */
+	MaxExploreLevels = 64
+
+	/*
+	 * MaxThumbnailSize is the longest side of a thumbnail Explore
+	 * renders.
+	 */
+	MaxThumbnailSize = 1024
+
+	/*
+	 * exploreProbe is the longest side of the image that Explore
+	 * iterates to score the parts of each view.
+	 */
+	exploreProbe = 128
+)
+
+/*
+ * Exploration goes down Levels levels from the view of Start, each time
+ * zooming in Zoom times on the part of the view that is most interesting
+ * by Interest. Everything but the view stays as it is in Start. Each
+ * level gets a thumbnail ThumbnailSize pixels along its longer side, or
+ * none if that's zero.
+ */
+type Exploration struct {
+	Start         Parameters
+	Levels        int
+	Zoom          float64
+	Interest      Interest
+	ThumbnailSize int
+}
+
+/*
+ * Validate returns an error if an Exploration can't be made.
+ */
+func (self *Exploration) Validate() error {
+	if self.Levels < 1 || self.Levels > MaxExploreLevels {
+		return fmt.Errorf("An exploration needs between 1 and %d levels: %d", MaxExploreLevels, self.Levels)
+	}
+	if !finite(self.Zoom) || self.Zoom < 2 || self.Zoom > float64(exploreProbe)/4 {
+		return fmt.Errorf("Invalid exploration zoom: %v, expected 2 to %d", self.Zoom, exploreProbe/4)
+	}
+	if self.Interest < InterestEntropy || self.Interest > InterestVariance {
+		return fmt.Errorf("Invalid exploration interest: %v", self.Interest)
+	}
+	if self.ThumbnailSize < 0 || self.ThumbnailSize > MaxThumbnailSize {
+		return fmt.Errorf("Invalid thumbnail size: %d, expected 0 to %d", self.ThumbnailSize, MaxThumbnailSize)
+	}
+	if _, ok := LookupRenderFunc(self.Start.RenderFunc); !ok {
+		return fmt.Errorf("Invalid RenderFunc: %#v", self.Start.RenderFunc)
+	}
+	return self.Start.Validate()
+}
+
+/*
+ * EstimateMemory is roughly how many bytes of images Explore needs at
+ * once for an Exploration.
+ */
+func (self *Exploration) EstimateMemory() uint64 {
+	probe := resized(&self.Start, exploreProbe)
+	memory := probe.EstimateMemory()
+	if self.ThumbnailSize > 0 {
+		thumbnail := resized(&self.Start, self.ThumbnailSize)
+		memory += thumbnail.EstimateMemory()
+	}
+	return memory
+}
+
+/*
+ * Waypoint is one level of an Exploration: the Parameters of its view,
+ * which is the View at its Width and Height, how interesting the part
+ * of the last view it zoomed in on was, and its Thumbnail.
+ */
+type Waypoint struct {
+	Parameters Parameters
+	View       View
+	Score      float64
+	Thumbnail  *image.NRGBA64
+}
+
+/*
+ * resized is a set of Parameters that shows the same view at a size
+ * that's longer pixels along its longer side, sampled as much, without
+ * an Overlay.
+ */
+func resized(p *Parameters, longer int) Parameters {
+	q := *p
+	v := p.View()
+	s, err := p.Samples()
+	if err != nil || p.AdaptiveSamples > 0 {
+		s = 1
+	}
+
+	w, h := float64(p.Width), float64(p.Height)
+	f := float64(longer) / math.Max(w, h)
+	q.Width = uint(math.Max(1, math.Round(w*f)))
+	q.Height = uint(math.Max(1, math.Round(h*f)))
+	q.ImageWidth, q.ImageHeight = int(q.Width)*s, int(q.Height)*s
+	q.Overlay = Overlay{}
+	q.SetView(v)
+	return q
+}
+
+/*
+ * Explore makes an Exploration, probing each level and rendering its
+ * thumbnails with up to threads goroutines.
+ */
+func Explore(ctx context.Context, e *Exploration, threads int) ([]Waypoint, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	info, _ := LookupRenderFunc(e.Start.RenderFunc)
+	p := e.Start
+	v := p.View()
+	waypoints := []Waypoint{}
+
+	for level := 0; level < e.Levels; level++ {
+		probe := resized(&p, exploreProbe)
+		counts, err := iterationCounts(ctx, &probe, threads, info.Escape)
+		if err != nil {
+			return nil, err
+		}
+
+		w, h := int(probe.Width), int(probe.Height)
+		x, y, score := mostInteresting(counts, w, h, e.Zoom, probe.MaxI, e.Interest)
+		v.Center = probe.Transform().PixelToPoint(x, y)
+		v.Magnification *= e.Zoom
+		p.SetView(v)
+
+		wp := Waypoint{Parameters: p, View: v, Score: score}
+		if e.ThumbnailSize > 0 {
+			tp := resized(&p, e.ThumbnailSize)
+			wp.Thumbnail, err = RenderImage(ctx, &tp, threads, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		waypoints = append(waypoints, wp)
+	}
+
+	return waypoints, nil
+}
+
+/*
+ * iterationCounts are what escape returns for each pixel of the Width by
+ * Height image of a set of Parameters, row by row, worked out with up to
+ * threads goroutines.
+ */
+func iterationCounts(ctx context.Context, p *Parameters, threads int, escape EscapeFunc) ([]int, error) {
+	w, h := int(p.Width), int(p.Height)
+	q := *p
+	q.ImageWidth, q.ImageHeight = w, h
+
+	img := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	contexts, err := MakeContexts(img, gridSize(threads, img.Bounds()), &q)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int, w*h)
+	for _, c := range contexts {
+		c.RenderFunc = func(ctx context.Context, c *Context) error {
+			return c.EachPoint(ctx, func(x, y int, z complex128) {
+				counts[y*w+x], _ = escape(c, z, c.MaxI)
+			})
+		}
+	}
+	if err := RenderProgress(ctx, threads, contexts, nil); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+/*
+ * mostInteresting is the center, in pixels, of the most interesting
+ * part of a w by h image of iteration counts that's zoom times smaller
+ * across, and its score. Parts overlap by half, and of those that score
+ * the same, the one nearest the center wins.
+ */
+func mostInteresting(counts []int, w, h int, zoom float64, maxI int, interest Interest) (x, y, score float64) {
+	pw := int(math.Min(float64(w), math.Max(2, math.Round(float64(w)/zoom))))
+	ph := int(math.Min(float64(h), math.Max(2, math.Round(float64(h)/zoom))))
+
+	starts := func(size, part int) []int {
+		s := []int{}
+		for i := 0; i+part < size; i += (part + 1) / 2 {
+			s = append(s, i)
+		}
+		return append(s, size-part)
+	}
+
+	best, bestDist := math.Inf(-1), math.Inf(1)
+	for _, y0 := range starts(h, ph) {
+		for _, x0 := range starts(w, pw) {
+			s := scorePart(counts, w, x0, y0, pw, ph, maxI, interest)
+			cx, cy := float64(x0)+float64(pw)/2, float64(y0)+float64(ph)/2
+			d := math.Hypot(cx-float64(w)/2, cy-float64(h)/2)
+			if s > best || (s == best && d < bestDist) {
+				best, bestDist = s, d
+				x, y = cx, cy
+			}
+		}
+	}
+	return x, y, best
+}
+
+/*
+ * scorePart scores the pw by ph part of a w wide image of iteration
+ * counts whose top left corner is at x0, y0.
+ */
+func scorePart(counts []int, w, x0, y0, pw, ph, maxI int, interest Interest) float64 {
+	at := func(x, y int) int {
+		return counts[(y0+y)*w+x0+x]
+	}
+
+	switch interest {
+	case InterestBoundary:
+		edges, pairs := 0, 0
+		for y := 0; y < ph; y++ {
+			for x := 0; x < pw; x++ {
+				if x+1 < pw {
+					pairs++
+					if at(x, y) != at(x+1, y) {
+						edges++
+					}
+				}
+				if y+1 < ph {
+					pairs++
+					if at(x, y) != at(x, y+1) {
+						edges++
+					}
+				}
+			}
+		}
+		return float64(edges) / float64(pairs)
+
+	case InterestVariance:
+		n, sum, sq := 0.0, 0.0, 0.0
+		for y := 0; y < ph; y++ {
+			for x := 0; x < pw; x++ {
+				if i := at(x, y); i < maxI {
+					f := float64(i)
+					n, sum, sq = n+1, sum+f, sq+f*f
+				}
+			}
+		}
+		if n < 2 {
+			return 0
+		}
+		mean := sum / n
+		return math.Max(0, sq/n-mean*mean)
+
+	default:
+		// Sorted, the histogram is runs of the same count, added up in
+		// the same order every time.
+		is := make([]int, 0, pw*ph)
+		for y := 0; y < ph; y++ {
+			for x := 0; x < pw; x++ {
+				is = append(is, at(x, y))
+			}
+		}
+		sort.Ints(is)
+
+		n, entropy := float64(len(is)), 0.0
+		for i := 0; i < len(is); {
+			j := i
+			for j < len(is) && is[j] == is[i] {
+				j++
+			}
+			f := float64(j-i) / n
+			entropy -= f * math.Log2(f)
+			i = j
+		}
+		return entropy
+	}
+}
@@ -0,0 +1,68 @@
+package gofr
+
+import (
+	"image"
+)
+
+/*
+ * The built-in font is 3 by 5 pixels, enough for numbers on the plane.
+ * Each glyph is its rows from the top, with the leftmost pixel in the
+ * highest of the low 3 bits.
+ */
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+var glyphs = map[rune][glyphHeight]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'-': {0, 0, 7, 0, 0},
+	'+': {0, 2, 7, 2, 0},
+	'.': {0, 0, 0, 0, 2},
+	'e': {0, 2, 7, 4, 3},
+	'i': {2, 0, 2, 2, 2},
+}
+
+/*
+ * textSize is the size of s in the built-in font with every pixel made
+ * scale by scale, leaving one scaled pixel between glyphs.
+ */
+func textSize(s string, scale int) image.Point {
+	n := len([]rune(s))
+	if n == 0 {
+		return image.Point{}
+	}
+	return image.Point{(n*(glyphWidth+1) - 1) * scale, glyphHeight * scale}
+}
+
+/*
+ * text marks the pixels of s in the built-in font with its top left
+ * corner at at. Characters the font doesn't have are left blank.
+ */
+func (self canvas) text(at image.Point, s string, scale int, plot plotFunc) {
+	for i, r := range []rune(s) {
+		g := glyphs[r]
+		left := at.X + i*(glyphWidth+1)*scale
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if g[row]&(1<<uint(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				for y := 0; y < scale; y++ {
+					for x := 0; x < scale; x++ {
+						plot(left+col*scale+x, at.Y+row*scale+y)
+					}
+				}
+			}
+		}
+	}
+}
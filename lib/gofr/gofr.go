@@ -1,3 +1,3 @@
 package gofr
 
-const Version = "0.2.2"
+const Version = "0.3.0"
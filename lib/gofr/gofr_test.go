@@ -1,10 +1,18 @@
 package gofr
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"image"
+	"math"
+	"math/big"
+	"math/cmplx"
 	"math/rand"
+	"reflect"
 	"regexp"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -17,6 +25,8 @@ func parameters() Parameters {
 	h := int(float64(w) * (imag(b) - imag(a)) / (real(b) - real(a)))
 
 	return Parameters{
+		Width:        uint(w),
+		Height:       uint(h),
 		ImageWidth:   w,
 		ImageHeight:  h,
 		Min:          a,
@@ -32,7 +42,11 @@ func parameters() Parameters {
 
 func contexts(p *Parameters) []*Context {
 	img := image.NewNRGBA64(image.Rect(0, 0, p.ImageWidth, p.ImageHeight))
-	return MakeContexts(img, n_cpu, p)
+	c, err := MakeContexts(img, n_cpu, p)
+	if err != nil {
+		panic(err)
+	}
+	return c
 }
 
 func TestVersion(t *testing.T) {
@@ -42,21 +56,1381 @@ func TestVersion(t *testing.T) {
 	}
 }
 
+func TestValidate(t *testing.T) {
+	p := parameters()
+	if err := p.Validate(); err != nil {
+		t.Errorf("Default parameters don't validate: %v", err)
+	}
+
+	// Zero is the default power, not an invalid one.
+	p.Power = 0
+	if err := p.Validate(); err != nil {
+		t.Errorf("Parameters without a Power don't validate: %v", err)
+	}
+	p.Power = 1
+	if err := p.Validate(); err == nil {
+		t.Errorf("Parameters with a Power of 1 validate.")
+	}
+	p.Power = 2
+
+	p.ImageWidth = 0
+	p.Min, p.Max = p.Max, p.Min
+	p.EscapeRadius = 1
+	p.MaxI = MaxIterations + 1
+	p.MemberColor = ""
+	p.ColorFunc = "no-such-color"
+
+	err := p.Validate()
+	fields := map[string]bool{}
+	if errs, ok := err.(ValidationError); ok {
+		for _, e := range errs {
+			fields[e.Field] = true
+		}
+	}
+
+	for _, field := range []string{"ImageWidth", "real(Max)", "imag(Max)", "EscapeRadius", "MaxI", "MemberColor", "ColorFunc"} {
+		if !fields[field] {
+			t.Errorf("Expected a ValidationError for %s, got: %v", field, err)
+		}
+	}
+
+	if _, err := MakeContexts(image.NewNRGBA64(image.Rect(0, 0, 1, 1)), 1, &p); err == nil {
+		t.Errorf("MakeContexts accepted invalid parameters.")
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	p := Parameters{Width: 4000, Height: 4000, ImageWidth: 16000, ImageHeight: 16000, Scaling: 4}
+	band := uint64(8 * (16000*DefaultBandHeight*4 + 4000*DefaultBandHeight))
+	expected := uint64(8*4000*4000) + band
+
+	if m := p.EstimateMemory(); m != expected {
+		t.Errorf("Expected an estimate of %d bytes, got %d", expected, m)
+	}
+	if m := p.EstimateStreamMemory(DefaultBandHeight); m != band {
+		t.Errorf("Expected a streaming estimate of %d bytes, got %d", band, m)
+	}
+}
+
+func TestRenderBands(t *testing.T) {
+	p := parameters()
+	p.Width = uint(p.ImageWidth / 2)
+	p.Height = uint(p.ImageHeight / 2)
+	p.ImageWidth = int(p.Width) * 2
+	p.ImageHeight = int(p.Height) * 2
+	p.Scaling = 2
+
+	img, err := RenderImage(context.Background(), &p, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, int(p.Width), int(p.Height)) {
+		t.Errorf("RenderImage made an image of the wrong size: %v", img.Bounds())
+	}
+
+	banded := NewBandedImage(context.Background(), &p, n_cpu, 7, nil)
+	for y := 0; y < int(p.Height); y++ {
+		for x := 0; x < int(p.Width); x++ {
+			if banded.NRGBA64At(x, y) != img.NRGBA64At(x, y) {
+				t.Fatalf("BandedImage and RenderImage differ at %d, %d", x, y)
+			}
+		}
+	}
+	if banded.Err() != nil {
+		t.Errorf("BandedImage failed: %v", banded.Err())
+	}
+}
+
+func TestAdaptiveAntiAliasing(t *testing.T) {
+	difference := func(a, b *image.NRGBA64) float64 {
+		sum := 0.0
+		r := a.Bounds()
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				sum += colorDistance(a.NRGBA64At(x, y), b.NRGBA64At(x, y))
+			}
+		}
+		return sum / float64(r.Dx()*r.Dy())
+	}
+
+	render := func(p Parameters) *image.NRGBA64 {
+		img, err := RenderImage(context.Background(), &p, n_cpu, nil)
+		if err != nil {
+			t.Fatalf("RenderImage failed: %v", err)
+		}
+		return img
+	}
+
+	p := parameters()
+	p.Width, p.Height = 128, 128
+	p.ImageWidth, p.ImageHeight = 128, 128
+	p.ColorFunc = "smooth"
+
+	plain := render(p)
+
+	s := p
+	s.ImageWidth, s.ImageHeight, s.Scaling = 512, 512, 4
+	reference := render(s)
+
+	a := p
+	a.AdaptiveSamples = 4
+	a.AdaptiveThreshold = DefaultAdaptiveThreshold
+	adaptive := render(a)
+
+	if d, e := difference(adaptive, reference), difference(plain, reference); d >= e/2 {
+		t.Errorf("Adaptive anti-aliasing is %f from s=4, no closer than %f for s=1", d, e)
+	}
+
+	banded := NewBandedImage(context.Background(), &a, n_cpu, 7, nil)
+	for y := 0; y < int(a.Height); y++ {
+		for x := 0; x < int(a.Width); x++ {
+			if banded.NRGBA64At(x, y) != adaptive.NRGBA64At(x, y) {
+				t.Fatalf("BandedImage and RenderImage differ at %d, %d", x, y)
+			}
+		}
+	}
+
+	a.Scaling, a.ImageWidth, a.ImageHeight = 2, 256, 256
+	if a.Validate() == nil {
+		t.Errorf("Validate allowed adaptive anti-aliasing with supersampling")
+	}
+}
+
+func TestRenderProgressive(t *testing.T) {
+	for _, scaling := range []int{1, 2} {
+		p := parameters()
+		p.Width, p.Height = 100, 75
+		p.ImageWidth, p.ImageHeight = 100*scaling, 75*scaling
+		p.Scaling = scaling
+
+		want, err := RenderImage(context.Background(), &p, n_cpu, nil)
+		if err != nil {
+			t.Fatalf("RenderImage failed: %v", err)
+		}
+
+		blocks := []int{}
+		var last *image.NRGBA64
+		var reported Progress
+		err = RenderProgressive(context.Background(), &p, n_cpu, func(progress Progress) {
+			reported = progress
+		}, func(pass Pass) error {
+			blocks = append(blocks, pass.Block)
+			if pass.Final {
+				last = pass.Image
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("RenderProgressive failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(blocks, ProgressiveBlocks) {
+			t.Errorf("RenderProgressive passes were %v, not %v", blocks, ProgressiveBlocks)
+		}
+		if reported.PixelsDone != reported.Pixels {
+			t.Errorf("RenderProgressive finished at %d of %d pixels", reported.PixelsDone, reported.Pixels)
+		}
+		if last == nil || !reflect.DeepEqual(last.Pix, want.Pix) {
+			t.Errorf("RenderProgressive at scaling %d doesn't finish with the same image as RenderImage", scaling)
+		}
+	}
+}
+
+func TestTileBounds(t *testing.T) {
+	origin := complex(-0.5, 0)
+
+	min, max := Tile{0, 0, 0}.Bounds(origin, 4)
+	if min != complex(-2.5, -2) || max != complex(1.5, 2) {
+		t.Errorf("Tile 0/0/0 is %v to %v", min, max)
+	}
+
+	// The four children of a tile split it into quarters.
+	parent := Tile{3, 5, 2}
+	pmin, pmax := parent.Bounds(origin, 4)
+	for dy := 0; dy < 2; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			child := Tile{parent.Z + 1, 2*parent.X + dx, 2*parent.Y + dy}
+			cmin, cmax := child.Bounds(origin, 4)
+			mid := (pmin + pmax) / 2
+			if dx == 0 && (real(cmin) != real(pmin) || real(cmax) != real(mid)) ||
+				dx == 1 && (real(cmin) != real(mid) || real(cmax) != real(pmax)) ||
+				dy == 0 && (imag(cmin) != imag(mid) || imag(cmax) != imag(pmax)) ||
+				dy == 1 && (imag(cmin) != imag(pmin) || imag(cmax) != imag(mid)) {
+				t.Errorf("Tile %v (%v to %v) isn't a quarter of %v (%v to %v)", child, cmin, cmax, parent, pmin, pmax)
+			}
+		}
+	}
+
+	for _, tile := range []Tile{{-1, 0, 0}, {MaxTileZoom + 1, 0, 0}, {2, 4, 0}, {2, 0, -1}} {
+		if tile.Validate() == nil {
+			t.Errorf("Tile %v should be invalid", tile)
+		}
+	}
+
+	p, err := TileParameters(parameters(), Tile{1, 1, 0}, origin, 4)
+	if err != nil {
+		t.Fatalf("TileParameters failed: %v", err)
+	}
+	if p.Width != TileSize || p.ImageHeight != TileSize || p.Min != complex(-0.5, 0) {
+		t.Errorf("TileParameters made %+v", p)
+	}
+}
+
+func TestDeepZoom(t *testing.T) {
+	p := parameters()
+	p.Width, p.Height = 300, 200
+	p.ImageWidth, p.ImageHeight = 300, 200
+	dz := DeepZoom{TileSize: 128, Overlap: 1}
+
+	if level := dz.MaxLevel(&p); level != 9 {
+		t.Errorf("MaxLevel of 300x200 is %d, not 9", level)
+	}
+	if w, h := dz.LevelSize(&p, 8); w != 150 || h != 100 {
+		t.Errorf("Level 8 is %dx%d, not 150x100", w, h)
+	}
+	if r := dz.TileRect(&p, 9, 1, 0); r != image.Rect(127, 0, 257, 129) {
+		t.Errorf("Tile 1, 0 of level 9 covers %v", r)
+	}
+
+	// The full size level of the pyramid matches a plain render.
+	want, err := RenderImage(context.Background(), &p, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+
+	tiles := 0
+	var reported Progress
+	err = RenderDeepZoom(context.Background(), &p, dz, n_cpu, func(progress Progress) {
+		reported = progress
+	}, func(level, col, row int, img *image.NRGBA64) error {
+		tiles++
+		r := dz.TileRect(&p, level, col, row)
+		if img.Bounds().Size() != r.Size() {
+			t.Errorf("Tile %d/%d_%d is %v, not %v", level, col, row, img.Bounds().Size(), r.Size())
+		}
+		if level != dz.MaxLevel(&p) {
+			return nil
+		}
+		// Tiles place their pixels independently, so a point on the
+		// boundary may round either way.
+		same := 0
+		for y := 0; y < r.Dy(); y++ {
+			for x := 0; x < r.Dx(); x++ {
+				if img.NRGBA64At(x, y) == want.NRGBA64At(r.Min.X+x, r.Min.Y+y) {
+					same++
+				}
+			}
+		}
+		if n := r.Dx() * r.Dy(); same < n*999/1000 {
+			t.Errorf("Tile %d/%d_%d differs from RenderImage at %d of %d pixels", level, col, row, n-same, n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RenderDeepZoom failed: %v", err)
+	}
+	if tiles != reported.Tiles || reported.PixelsDone != reported.Pixels {
+		t.Errorf("RenderDeepZoom rendered %d tiles and reported %+v", tiles, reported)
+	}
+
+	descriptor, err := dz.Descriptor(&p)
+	if err != nil {
+		t.Fatalf("Descriptor failed: %v", err)
+	}
+	if !regexp.MustCompile(`TileSize="128"[\s\S]*<Size Width="300" Height="200">`).Match(descriptor) {
+		t.Errorf("Unexpected descriptor: %s", descriptor)
+	}
+}
+
+func TestHash(t *testing.T) {
+	p := parameters()
+	p.MemberColor = "#abcdef"
+	q := p
+	if p.Hash() != q.Hash() {
+		t.Errorf("The same Parameters hash differently")
+	}
+
+	// Scaling of zero works out to 1, and thresholds don't matter
+	// without adaptive anti-aliasing.
+	q.Scaling = 1
+	q.AdaptiveThreshold = 0.5
+	q.MemberColor = "#ABCDEF"
+	if p.Hash() != q.Hash() {
+		t.Errorf("Equivalent Parameters hash differently")
+	}
+
+	q.MaxI++
+	if p.Hash() == q.Hash() {
+		t.Errorf("Different Parameters hash the same")
+	}
+}
+
+func TestZoom(t *testing.T) {
+	start := parameters()
+	start.Width, start.Height = 96, 96
+	start.ImageWidth, start.ImageHeight = 96, 96
+	start.Min, start.Max = complex(-2, -2), complex(2, 2)
+	start.ColorFunc = "smooth"
+
+	z := Zoom{
+		Start:         start,
+		Center:        complex(-0.75, 0.1),
+		Magnification: 4,
+		Frames:        5,
+		Easing:        Easings["ease-in-out"],
+	}
+
+	if p := z.Frame(0); cmplx.Abs(p.Min-start.Min) > 1e-12 || cmplx.Abs(p.Max-start.Max) > 1e-12 {
+		t.Errorf("The first frame is %v to %v, not the start", p.Min, p.Max)
+	}
+	if p := z.Frame(4); cmplx.Abs((p.Min+p.Max)/2-z.Center) > 1e-12 || math.Abs(real(p.Max-p.Min)-1) > 1e-12 {
+		t.Errorf("The last frame is %v to %v", p.Min, p.Max)
+	}
+
+	frames := 0
+	err := RenderZoom(context.Background(), &z, n_cpu, nil, func(n int, img *image.NRGBA64) error {
+		frames++
+		p := z.Frame(n)
+		want, err := RenderImage(context.Background(), &p, n_cpu, nil)
+		if err != nil {
+			return err
+		}
+
+		difference := 0.0
+		for y := 0; y < 96; y++ {
+			for x := 0; x < 96; x++ {
+				difference += colorDistance(img.NRGBA64At(x, y), want.NRGBA64At(x, y))
+			}
+		}
+		if difference /= 96 * 96; difference > 0.005 {
+			t.Errorf("Frame %d is %f from a plain render", n, difference)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RenderZoom failed: %v", err)
+	}
+	if frames != z.Frames {
+		t.Errorf("RenderZoom rendered %d frames, not %d", frames, z.Frames)
+	}
+
+	// Frames close together share most of their pixels.
+	z.Frames = 100
+	bounds := image.Rect(0, 0, 96, 96)
+	last, next := newZoomRaster(bounds), newZoomRaster(bounds)
+	escape, _ := adaptiveEscape(&start)
+	p0, p1 := z.Frame(0), z.Frame(1)
+	if _, err = (&zoomRaster{}).renderFrame(context.Background(), &p0, n_cpu, escape, last, nil); err != nil {
+		t.Fatalf("renderFrame failed: %v", err)
+	}
+	last.place(&p0)
+	reused, err := last.renderFrame(context.Background(), &p1, n_cpu, escape, next, nil)
+	if err != nil {
+		t.Fatalf("renderFrame failed: %v", err)
+	}
+	if reused < 96*96/2 {
+		t.Errorf("Only %d pixels were reused", reused)
+	}
+}
+
+func TestJulia(t *testing.T) {
+	p := parameters()
+	p.Julia = true
+	c := contexts(&p)[0]
+
+	// The Julia set of 0 is the unit disk.
+	if i, _ := Escape(c, complex(0.6, 0.6), p.MaxI); i != p.MaxI {
+		t.Errorf("0.6+0.6i escaped from the unit disk after %d iterations", i)
+	}
+	if i, _ := Escape(c, complex(0.8, 0.8), p.MaxI); i == p.MaxI {
+		t.Errorf("0.8+0.8i didn't escape from the unit disk")
+	}
+
+	// Multibrot agrees with mandelbrot at whole exponents.
+	p = parameters()
+	p.RenderFunc = "multibrot"
+	p.Exponent = 3
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Invalid multibrot parameters: %v", err)
+	}
+	m := contexts(&p)[0]
+	p.Power = 3
+	c = contexts(&p)[0]
+	for _, z := range []complex128{0.1, complex(0.3, 0.5), complex(-0.6, 0.2), 1} {
+		want, _ := Escape(c, z, p.MaxI)
+		if got, _ := MultibrotEscape(m, z, p.MaxI); got != want {
+			t.Errorf("%v took %d iterations as a multibrot, not %d", z, got, want)
+		}
+	}
+
+	p = parameters()
+	p.Exponent = 3
+	if err := p.Validate(); err == nil {
+		t.Errorf("mandelbrot accepted an Exponent")
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	start := parameters()
+	start.Width, start.Height = 48, 48
+	start.ImageWidth, start.ImageHeight = 48, 48
+	start.RenderFunc = "multibrot"
+	start.ColorFunc = "smooth"
+	start.Julia = true
+
+	a := Animation{
+		Start:  start,
+		Frames: 9,
+		Keyframes: []Keyframe{
+			{Frame: 0, Values: map[string]float64{"Exponent": 2, "real(Seed)": -0.8, "MaxI": 100}},
+			{Frame: 4, Values: map[string]float64{"real(Seed)": 0.25, "imag(Seed)": 0.5}},
+			{Frame: 8, Values: map[string]float64{"Exponent": 4, "real(Seed)": -0.8, "MaxI": 200}},
+		},
+	}
+	a.Interpolation, _ = InterpolationFromString("linear")
+	if err := a.Validate(); err != nil {
+		t.Fatalf("Invalid animation: %v", err)
+	}
+
+	p := a.Frame(2)
+	if p.Exponent != 2.5 || p.MaxI != 125 || p.Seed != complex(-0.275, 0.5) {
+		t.Errorf("Frame 2 is Exponent %v, MaxI %d, Seed %v", p.Exponent, p.MaxI, p.Seed)
+	}
+	if p.Width != start.Width || p.ColorFunc != start.ColorFunc || !p.Julia {
+		t.Errorf("Frame 2 changed fields without keyframes")
+	}
+
+	// Cubic curves pass through every keyframe.
+	a.Interpolation, _ = InterpolationFromString("cubic")
+	for _, k := range a.Keyframes {
+		p := a.Frame(k.Frame)
+		if v, ok := k.Values["real(Seed)"]; ok && math.Abs(real(p.Seed)-v) > 1e-12 {
+			t.Errorf("real(Seed) is %v at keyframe %d, not %v", real(p.Seed), k.Frame, v)
+		}
+	}
+	if v := real(a.Frame(2).Seed); v <= -0.8 || v >= 0.25 {
+		t.Errorf("real(Seed) is %v between keyframes", v)
+	}
+
+	// A cubic curve between valid keyframes can still overshoot into
+	// frames that wouldn't render, which is caught before any do.
+	overshoot := a
+	overshoot.Keyframes = []Keyframe{
+		{Frame: 0, Values: map[string]float64{"EscapeRadius": 2}},
+		{Frame: 4, Values: map[string]float64{"EscapeRadius": 2}},
+		{Frame: 8, Values: map[string]float64{"EscapeRadius": 100}},
+	}
+	if err := overshoot.Validate(); err == nil || !strings.Contains(err.Error(), "between keyframes") {
+		t.Errorf("An overshooting animation was accepted: %v", err)
+	}
+
+	for _, name := range []string{"Width", "Seed", "real(MaxI)", "MemberColor", "Nope"} {
+		bad := a
+		bad.Keyframes = []Keyframe{{Frame: 1, Values: map[string]float64{name: 1}}}
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s was accepted as a keyframe field", name)
+		}
+	}
+
+	frames := []int{}
+	err := RenderAnimation(context.Background(), &a, n_cpu, nil, func(n int, img *image.NRGBA64) error {
+		frames = append(frames, n)
+		p := a.Frame(n)
+		want, err := RenderImage(context.Background(), &p, 1, nil)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(img.Pix, want.Pix) {
+			t.Errorf("Frame %d differs from a plain render", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RenderAnimation failed: %v", err)
+	}
+	if !reflect.DeepEqual(frames, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("RenderAnimation delivered frames %v", frames)
+	}
+}
+
+func TestView(t *testing.T) {
+	p := parameters()
+	p.Width, p.Height = 300, 200
+	p.ImageWidth, p.ImageHeight = 300, 200
+
+	v := View{Center: complex(-0.75, 0.1), Magnification: 8, Angle: 0.5}
+	p.SetView(v)
+	if got := p.View(); cmplx.Abs(got.Center-v.Center) > 1e-12 || math.Abs(got.Magnification-v.Magnification) > 1e-9 || got.Angle != v.Angle {
+		t.Errorf("SetView(%+v) reads back as %+v", v, got)
+	}
+	if size := p.Max - p.Min; math.Abs(imag(size)-ViewSpan/8) > 1e-12 || math.Abs(real(size)/300-imag(size)/200) > 1e-12 {
+		t.Errorf("SetView(%+v) spans %v", v, size)
+	}
+	if err := (View{Magnification: 0}).Validate(); err == nil {
+		t.Errorf("A View with no magnification validated")
+	}
+
+	for name, aspect := range Aspects {
+		v := View{Center: complex(0.25, -0.5), Magnification: 3, Aspect: aspect}
+		min, max := v.Corners(300, 200)
+		got := ViewOfCorners(min, max, 300, 200, aspect)
+		if cmplx.Abs(got.Center-v.Center) > 1e-12 || math.Abs(got.Magnification-v.Magnification) > 1e-9 {
+			t.Errorf("%s corners %v to %v read back as %+v", name, min, max, got)
+		}
+		if a, err := AspectFromString(name); err != nil || a != aspect || a.String() != name {
+			t.Errorf("AspectFromString(%#v) is %v, %v", name, a, err)
+		}
+	}
+	if _, err := AspectFromString("squash"); err == nil {
+		t.Errorf("AspectFromString accepted squash")
+	}
+
+	q := p
+	q.Min, q.Max = complex(-1, -1), complex(1, 1)
+	if q.SquarePixels() {
+		t.Errorf("A square view of a 300x200 image has square pixels")
+	}
+	q.CorrectAspect(AspectFit)
+	if !q.SquarePixels() || math.Abs(imag(q.Max-q.Min)-2) > 1e-12 || math.Abs(real(q.Max-q.Min)-3) > 1e-12 {
+		t.Errorf("Fitting a square view to 300x200 gives %v to %v", q.Min, q.Max)
+	}
+
+	p.Affine = &Affine{XX: 1, XY: 0.5, YX: -0.25, YY: 2, Offset: complex(0.1, -0.2)}
+	if inv := p.Affine.Inverse(); cmplx.Abs(inv.Apply(p.Affine.Apply(0.3+0.7i))-(0.3+0.7i)) > 1e-12 {
+		t.Errorf("Affine.Inverse doesn't undo %+v", *p.Affine)
+	}
+	if r := p; r.Affine != nil {
+		r.Affine = &Affine{XX: 1, XY: 2, YX: 1, YY: 2}
+		if err := r.Validate(); err == nil {
+			t.Errorf("A singular Affine validated")
+		}
+	}
+
+	// Turning a view halfway round turns its image halfway round.
+	p = parameters()
+	p.Width, p.Height = 96, 64
+	p.ImageWidth, p.ImageHeight = 96, 64
+	p.Min, p.Max = complex(-2.4, -1.6), complex(0.6, 0.4)
+	plain, err := RenderImage(context.Background(), &p, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	p.Angle = math.Pi
+	turned, err := RenderImage(context.Background(), &p, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	same := 0
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 96; x++ {
+			if turned.NRGBA64At(x, y) == plain.NRGBA64At(95-x, 63-y) {
+				same++
+			}
+		}
+	}
+	if same < 96*64*99/100 {
+		t.Errorf("Only %d of %d pixels match when turned halfway round", same, 96*64)
+	}
+
+	// Deep Zoom tiles of a turned view still fit together.
+	p.Angle = 0.3
+	p.Affine = &Affine{XX: 1, XY: 0.2, YX: 0, YY: 1}
+	want, err := RenderImage(context.Background(), &p, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	dz := DeepZoom{TileSize: 32, Overlap: 0}
+	tp, err := dz.TileParameters(&p, dz.MaxLevel(&p), 2, 1)
+	if err != nil {
+		t.Fatalf("TileParameters failed: %v", err)
+	}
+	tile, err := RenderImage(context.Background(), &tp, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	same = 0
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if tile.NRGBA64At(x, y) == want.NRGBA64At(64+x, 32+y) {
+				same++
+			}
+		}
+	}
+	if same < 32*32*99/100 {
+		t.Errorf("Only %d of %d pixels of a turned tile match the full render", same, 32*32)
+	}
+
+	// The axes cross where the origin is, at the angle of the view.
+	img := image.NewNRGBA64(image.Rect(0, 0, 64, 64))
+	q = parameters()
+	q.Width, q.Height = 64, 64
+	q.ImageWidth, q.ImageHeight = 64, 64
+	q.SetView(View{Center: complex(0.5, 0.25), Magnification: 2, Angle: math.Pi / 6})
+	cs, err := MakeContexts(img, 1, &q)
+	if err != nil {
+		t.Fatalf("MakeContexts failed: %v", err)
+	}
+	DrawAxesColor(cs[0], White)
+	for _, z := range []complex128{0, 0.5, -0.5i} {
+		x, y := cs[0].Transform().PointToPixel(z)
+		hit := false
+		for _, d := range [][2]float64{{0, 0}, {-0.5, 0}, {0.5, 0}, {0, -0.5}, {0, 0.5}} {
+			hit = hit || img.NRGBA64At(int(math.Floor(x+d[0])), int(math.Floor(y+d[1]))) == White
+		}
+		if !hit {
+			t.Errorf("The axes miss %v at %v, %v", z, x, y)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	// Pixels are sampled at their centers, and the top row is at the
+	// largest imaginary values.
+	tr := NewTransform(complex(-2, -1), complex(2, 1), 4, 2, 0, nil)
+	for _, c := range []struct {
+		x, y float64
+		z    complex128
+	}{
+		{0, 0, complex(-2, 1)},
+		{0.5, 0.5, complex(-1.5, 0.5)},
+		{3.5, 1.5, complex(1.5, -0.5)},
+		{4, 2, complex(2, -1)},
+	} {
+		if z := tr.PixelToPoint(c.x, c.y); cmplx.Abs(z-c.z) > 1e-12 {
+			t.Errorf("Pixel %v, %v maps to %v, not %v", c.x, c.y, z, c.z)
+		}
+	}
+
+	// Rendering samples the same points, so the top half of a view of
+	// the upper half plane is all above the real axis.
+	p := parameters()
+	p.Width, p.Height, p.ImageWidth, p.ImageHeight = 4, 2, 4, 2
+	p.Min, p.Max = complex(-2, -1), complex(2, 1)
+	c := contexts(&p)[0]
+	c.EachPoint(context.Background(), func(x, y int, z complex128) {
+		if want := tr.PixelToPoint(float64(x)+0.5, float64(y)+0.5); z != want {
+			t.Errorf("EachPoint samples pixel %d, %d at %v, not %v", x, y, z, want)
+		}
+		if (y == 0) != (imag(z) > 0) {
+			t.Errorf("Pixel %d, %d is at %v", x, y, z)
+		}
+	})
+
+	// PointToPixel undoes PixelToPoint however a view is placed, turned
+	// or transformed.
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		min := complex(r.NormFloat64(), r.NormFloat64())
+		max := min + complex(r.ExpFloat64()+1e-6, r.ExpFloat64()+1e-6)
+		w, h := 1+r.Intn(2000), 1+r.Intn(2000)
+		var a *Affine
+		if i%2 == 1 {
+			a = &Affine{XX: 1 + r.Float64(), XY: r.NormFloat64(), YX: r.NormFloat64(), YY: 2 + r.Float64(), Offset: complex(r.NormFloat64(), r.NormFloat64())}
+			if math.Abs(a.Determinant()) < 0.1 {
+				continue
+			}
+		}
+		tr := NewTransform(min, max, w, h, r.Float64()*2*math.Pi, a)
+
+		x, y := r.Float64()*float64(w), r.Float64()*float64(h)
+		gx, gy := tr.PointToPixel(tr.PixelToPoint(x, y))
+		if math.Abs(gx-x) > 1e-6 || math.Abs(gy-y) > 1e-6 {
+			t.Fatalf("PointToPixel(PixelToPoint(%v, %v)) is %v, %v", x, y, gx, gy)
+		}
+
+		z := min + complex(r.Float64()*real(max-min), r.Float64()*imag(max-min))
+		if g := tr.PixelToPoint(tr.PointToPixel(z)); cmplx.Abs(g-z) > 1e-9*(1+cmplx.Abs(z)) {
+			t.Fatalf("PixelToPoint(PointToPixel(%v)) is %v", z, g)
+		}
+
+		// The center of the view stays put.
+		if g := tr.PixelToPoint(float64(w)/2, float64(h)/2); a == nil && cmplx.Abs(g-(min+max)/2) > 1e-9 {
+			t.Fatalf("The center of %v to %v turned maps to %v", min, max, g)
+		}
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	for _, c := range []struct{ raw, want float64 }{
+		{1, 1}, {1.1, 2}, {2.5, 5}, {7, 10}, {0.03, 0.05}, {1.5e-13, 2e-13},
+	} {
+		if got := niceStep(c.raw); got != c.want {
+			t.Errorf("niceStep(%v) is %v, not %v", c.raw, got, c.want)
+		}
+	}
+	for _, c := range []struct {
+		k, unit float64
+		want    string
+	}{
+		{0, 0.5, "0"}, {-3, 0.5, "-1.5"}, {3, 0.2, "0.6"}, {5, 20, "100"}, {-3, 2e-13, "-0.0000000000006"},
+	} {
+		if got := tickLabel(c.k, c.unit); got != c.want {
+			t.Errorf("tickLabel(%v, %v) is %#v, not %#v", c.k, c.unit, got, c.want)
+		}
+	}
+
+	var o Overlay
+	if err := o.SetParts("axes, labels"); err != nil || !o.Axes || !o.Labels || o.Grid || o.ScaleBar {
+		t.Errorf("SetParts(\"axes, labels\") set %+v, %v", o, err)
+	}
+	if err := o.SetParts("axes,compass"); err == nil {
+		t.Errorf("SetParts accepted a part that doesn't exist")
+	}
+
+	p := parameters()
+	p.Width, p.Height, p.ImageWidth, p.ImageHeight = 160, 100, 160, 100
+	p.SetView(View{Center: complex(-0.5, 0.2), Magnification: 1.5, Angle: 0.4})
+	plain := p.Hash()
+	p.Overlay = Overlay{Axes: true, Grid: true, Labels: true, ScaleBar: true, Color: "#ffcc00", GridColor: "#ffffff40"}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if p.Hash() == plain {
+		t.Errorf("An overlay doesn't change the hash")
+	}
+
+	// Bands drawn separately line up with the whole image drawn at once.
+	whole := image.NewNRGBA64(image.Rect(0, 0, 160, 100))
+	DrawOverlay(whole, &p)
+	for y := 0; y < 100; y += 7 {
+		y1 := y + 7
+		if y1 > 100 {
+			y1 = 100
+		}
+		band := image.NewNRGBA64(image.Rect(0, y, 160, y1))
+		DrawOverlay(band, &p)
+		for by := y; by < y1; by++ {
+			for x := 0; x < 160; x++ {
+				if band.NRGBA64At(x, by) != whole.NRGBA64At(x, by) {
+					t.Fatalf("Band %d to %d doesn't match the whole overlay at %d, %d", y, y1, x, by)
+				}
+			}
+		}
+	}
+
+	// The axes pass through where the origin is.
+	x, y := NewTransform(p.Min, p.Max, 160, 100, p.Angle, p.Affine).PointToPixel(0)
+	hit := false
+	for _, d := range [][2]float64{{0, 0}, {-0.5, 0}, {0.5, 0}, {0, -0.5}, {0, 0.5}} {
+		hit = hit || whole.NRGBA64At(int(math.Floor(x+d[0])), int(math.Floor(y+d[1]))).R == 0xffff
+	}
+	if !hit {
+		t.Errorf("The axes miss the origin at %v, %v", x, y)
+	}
+
+	// Progressive renders draw it over each pass without drawing it into
+	// what's left to render.
+	want, err := RenderImage(context.Background(), &p, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	var last []uint8
+	err = RenderProgressive(context.Background(), &p, n_cpu, nil, func(pass Pass) error {
+		last = append([]uint8{}, pass.Image.Pix...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RenderProgressive failed: %v", err)
+	}
+	if !reflect.DeepEqual(last, want.Pix) {
+		t.Errorf("RenderProgressive with an overlay doesn't finish with the same image as RenderImage")
+	}
+
+	// Tiles leave it out.
+	tp, err := TileParameters(p, Tile{1, 1, 0}, 0, 4)
+	if err != nil {
+		t.Fatalf("TileParameters failed: %v", err)
+	}
+	if tp.Overlay.Enabled() {
+		t.Errorf("A tile keeps the overlay")
+	}
+
+	p.Overlay.Color = "#ffcc0"
+	p.Overlay.Spacing = -1
+	err = p.Validate()
+	for _, field := range []string{"Overlay.Color", "Overlay.Spacing"} {
+		if !regexp.MustCompile(regexp.QuoteMeta(field)).MatchString(err.Error()) {
+			t.Errorf("Validate doesn't report %s: %v", field, err)
+		}
+	}
+}
+
+func TestOrbit(t *testing.T) {
+	// Orbits end where the EscapeFuncs do, for every RenderFunc.
+	for _, c := range []struct {
+		r, x  string
+		power int
+		julia bool
+	}{
+		{"mandelbrot", "", 2, false}, {"mandelbrot", "", 3, false}, {"mandelbrot", "", 2, true},
+		{"multibrot", "2.5", 2, false}, {"ebrot", "", 2, false},
+	} {
+		p := parameters()
+		p.RenderFunc, p.Power, p.Julia, p.Seed = c.r, c.power, c.julia, complex(-0.8, 0.156)
+		if c.x != "" {
+			p.Exponent = 2.5
+		}
+		info, _ := LookupRenderFunc(p.RenderFunc)
+		ctx := contexts(&p)[0]
+		for _, z := range []complex128{complex(0.3, 0.5), complex(-0.75, 0.1), complex(0.25, 0), complex(-1.5, 0.01)} {
+			o, err := TraceOrbit(&p, z, 0)
+			if err != nil {
+				t.Fatalf("TraceOrbit failed: %v", err)
+			}
+			i, zn := info.Escape(ctx, z, p.MaxI)
+			if o.Iteration != i || complex128(o.Z[len(o.Z)-1]) != zn {
+				t.Errorf("The %s orbit of %v ends at %v after %d, not %v after %d", c.r, z, o.Z[len(o.Z)-1], o.Iteration, zn, i)
+			}
+		}
+	}
+
+	p := parameters()
+	for _, c := range []struct {
+		z      complex128
+		period int
+	}{
+		{0, 1}, {-0.1, 1}, {-1, 2}, {complex(-0.1225611669, 0.7448617666), 3}, {-1.3107026413, 4},
+	} {
+		o, err := TraceOrbit(&p, c.z, 10)
+		if err != nil {
+			t.Fatalf("TraceOrbit failed: %v", err)
+		}
+		if o.Escaped || o.Period != c.period {
+			t.Errorf("The orbit of %v has period %d, not %d", c.z, o.Period, c.period)
+		}
+		if imag(c.z) != 0 && (len(o.Z) != 10 || !o.Truncated) {
+			t.Errorf("The orbit of %v keeps %d points", c.z, len(o.Z))
+		}
+	}
+
+	// 1 is 0.75 from the cusp at 0.25.
+	p.EscapeRadius = 1e10
+	o, err := TraceOrbit(&p, 1, 0)
+	if err != nil {
+		t.Fatalf("TraceOrbit failed: %v", err)
+	}
+	if !o.Escaped || o.Smooth <= 0 || o.Distance <= 0.75/4 || o.Distance > 0.75 {
+		t.Errorf("The orbit of 1 escapes at %v, %v from the set", o.Smooth, o.Distance)
+	}
+
+	// The color is the one the pixel gets.
+	p = parameters()
+	p.ColorFunc = "smooth"
+	p.Width, p.Height, p.ImageWidth, p.ImageHeight = 1, 1, 1, 1
+	z := complex(-0.7, 0.35)
+	p.Min, p.Max = z-complex(1e-3, 1e-3), z+complex(1e-3, 1e-3)
+	img, err := RenderImage(context.Background(), &p, 1, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	o, err = TraceOrbit(&p, NewTransform(p.Min, p.Max, 1, 1, 0, nil).PixelToPoint(0.5, 0.5), 0)
+	if err != nil {
+		t.Fatalf("TraceOrbit failed: %v", err)
+	}
+	k := img.NRGBA64At(0, 0)
+	if want := fmt.Sprintf("#%02x%02x%02x", k.R>>8, k.G>>8, k.B>>8); o.Color != want {
+		t.Errorf("The orbit's color is %s, not %s", o.Color, want)
+	}
+
+	// Orbits that overflow still make JSON.
+	p = parameters()
+	p.Power, p.EscapeRadius = 32, 1e100
+	o, err = TraceOrbit(&p, 3, 0)
+	if err != nil {
+		t.Fatalf("TraceOrbit failed: %v", err)
+	}
+	if _, err := json.Marshal(o); err != nil {
+		t.Errorf("An orbit that overflows can't be written as JSON: %v", err)
+	}
+
+	// The overlay draws on each point.
+	p = parameters()
+	p.Width, p.Height, p.ImageWidth, p.ImageHeight = 64, 64, 64, 64
+	p.Min, p.Max = complex(-2, -2), complex(2, 2)
+	p.Overlay = Overlay{Orbit: true, OrbitAt: -1, Color: "#ffffff"}
+	img = image.NewNRGBA64(image.Rect(0, 0, 64, 64))
+	DrawOverlay(img, &p)
+	for _, z := range []complex128{-1, 0} {
+		x, y := NewTransform(p.Min, p.Max, 64, 64, 0, nil).PointToPixel(z)
+		if img.NRGBA64At(int(x), int(y)) != White {
+			t.Errorf("The orbit overlay misses %v", z)
+		}
+	}
+	if img.NRGBA64At(16, 48) == White {
+		t.Errorf("The orbit overlay draws off the orbit")
+	}
+}
+
+func TestNuclei(t *testing.T) {
+	p := parameters()
+	for _, c := range []struct {
+		guess, want complex128
+		period      int
+		size        float64
+	}{
+		{0.1, 0, 1, 1},
+		{-0.9, -1, 2, 0.5},
+		{-1.75, -1.7548776662466927, 3, 0.019},
+		{complex(-0.1, 0.7), complex(-0.12256116687665362, 0.7448617666197442), 3, 0.1},
+		{-1.3, -1.3107026413368328, 4, 0.12},
+	} {
+		n, err := FindNucleus(&p, c.guess, c.period)
+		if err != nil {
+			t.Fatalf("FindNucleus failed: %v", err)
+		}
+		if cmplx.Abs(n.C-c.want) > 1e-12 || n.Period != c.period {
+			t.Errorf("The nucleus of period %d near %v is %v, not %v", c.period, c.guess, n.C, c.want)
+		}
+		if n.Size < c.size/2 || n.Size > c.size*2 {
+			t.Errorf("The nucleus at %v has size %v, not about %v", n.C, n.Size, c.size)
+		}
+	}
+
+	// Minibrots on the real axis point the same way as the set.
+	n, _ := FindNucleus(&p, -1.75, 3)
+	if math.Abs(n.Orientation) > 1e-9 {
+		t.Errorf("The minibrot at %v is turned by %v", n.C, n.Orientation)
+	}
+	if v := n.View(); v.Magnification < 10 || cmplx.Abs(v.Center-n.C) > n.Size {
+		t.Errorf("The minibrot at %v is shown by %v", n.C, v)
+	}
+
+	if _, err := FindNucleus(&p, -1, 4); err == nil {
+		t.Errorf("FindNucleus took -1 to have period 4")
+	}
+
+	p.Width, p.Height = 100, 100
+	p.SetView(View{Center: -1.76, Magnification: 20})
+	if period, err := BoxPeriod(&p, 100); err != nil || period != 3 {
+		t.Errorf("The view around -1.76 has box period %d, %v", period, err)
+	}
+	nuclei, err := FindNuclei(context.Background(), &p, 0)
+	if err != nil || len(nuclei) == 0 || cmplx.Abs(nuclei[0].C-(-1.7548776662466927)) > 1e-12 {
+		t.Errorf("The nuclei around -1.76 are %v, %v", nuclei, err)
+	}
+
+	p.Julia = true
+	if _, err := FindNuclei(context.Background(), &p, 3); err == nil {
+		t.Errorf("FindNuclei found nuclei of a Julia set")
+	}
+}
+
+func TestRays(t *testing.T) {
+	for s, want := range map[string]string{
+		"1/3": "1/3", "0.(01)": "1/3", ".(001)": "1/7", "0.0(01)": "1/6", "4/3": "1/3", "0.1": "1/2", "0.": "0",
+	} {
+		a, err := ParseAngle(s)
+		if err != nil || a.RatString() != want {
+			t.Errorf("The angle %#v is %v, not %s: %v", s, a, want, err)
+		}
+	}
+	for _, s := range []string{"", "1/0", "-1/3", "0.(2)", "0.5", "one third"} {
+		if _, err := ParseAngle(s); err == nil {
+			t.Errorf("Expected angle %#v not to parse.", s)
+		}
+	}
+
+	p := parameters()
+	for _, c := range []struct {
+		angle             string
+		preperiod, period int
+		landing           complex128
+	}{
+		{"0", 0, 1, 0.25},
+		{"1/3", 0, 2, -0.75},
+		{"1/7", 0, 3, complex(-0.125, 0.649519052838329)},
+		{"3/7", 0, 3, -1.75},
+		{"1/2", 1, 1, -2},
+		{"1/6", 1, 2, 1i},
+		{"9/56", 3, 3, complex(-0.10109636384562, 0.95628651080914)},
+	} {
+		a, _ := ParseAngle(c.angle)
+		r, err := TraceRay(context.Background(), &p, a, 64)
+		if err != nil {
+			t.Fatalf("TraceRay failed: %v", err)
+		}
+		if r.Preperiod != c.preperiod || r.Period != c.period {
+			t.Errorf("The angle %s has preperiod %d and period %d", c.angle, r.Preperiod, r.Period)
+		}
+		if r.Landing == nil || cmplx.Abs(complex128(*r.Landing)-c.landing) > 1e-6 {
+			t.Errorf("The ray of %s lands at %v, not %v", c.angle, r.Landing, c.landing)
+		}
+		if z := complex128(r.Points[len(r.Points)-1]); cmplx.Abs(z-c.landing) > 0.1 {
+			t.Errorf("The ray of %s ends at %v, far from %v", c.angle, z, c.landing)
+		}
+	}
+
+	// The landing points are where the critical orbit lands on a cycle.
+	m, err := FindMisiurewicz(&p, complex(0, 0.9), 2, 2)
+	if err != nil || cmplx.Abs(m-1i) > 1e-12 {
+		t.Errorf("The Misiurewicz point of preperiod 2 and period 2 near 0.9i is %v, %v", m, err)
+	}
+	if _, err := FindMisiurewicz(&p, complex(0, 0.9), 3, 2); err == nil {
+		t.Errorf("FindMisiurewicz took i to have preperiod 3")
+	}
+
+	p.Width, p.Height = 100, 100
+	p.SetView(View{Center: complex(0, 1), Magnification: 40})
+	ms, err := FindMisiurewiczPoints(context.Background(), &p, 2, 2)
+	if err != nil || len(ms) != 1 || cmplx.Abs(ms[0]-1i) > 1e-12 {
+		t.Errorf("The Misiurewicz points around i are %v, %v", ms, err)
+	}
+
+	// The overlay draws each ray and a dot where it lands.
+	p = parameters()
+	p.Width, p.Height, p.ImageWidth, p.ImageHeight = 64, 64, 64, 64
+	p.Min, p.Max = complex(-2, -2), complex(2, 2)
+	p.Overlay = Overlay{Rays: []string{"1/3", "0.0(01)"}, Color: "#ffffff"}
+	img := image.NewNRGBA64(image.Rect(0, 0, 64, 64))
+	DrawOverlay(img, &p)
+	tr := NewTransform(p.Min, p.Max, 64, 64, 0, nil)
+	r, _ := TraceRay(context.Background(), &p, big.NewRat(1, 3), OverlayRayDepth)
+	on := complex128(r.Points[len(r.Points)/4])
+	for _, z := range []complex128{-0.75, 1i, on} {
+		x, y := tr.PointToPixel(z)
+		if img.NRGBA64At(int(x), int(y)) != White {
+			t.Errorf("The ray overlay misses %v", z)
+		}
+	}
+	if x, y := tr.PointToPixel(complex(1, -1)); img.NRGBA64At(int(x), int(y)) == White {
+		t.Errorf("The ray overlay draws off the rays")
+	}
+
+	p.Overlay.Rays = []string{"1/3", "0.(2)"}
+	if err := p.Validate(); err == nil || !regexp.MustCompile("Overlay.Rays").MatchString(err.Error()) {
+		t.Errorf("Expected a bad angle not to validate: %v", err)
+	}
+
+	p.Overlay.Rays = []string{"1/3"}
+	p.Exponent, p.RenderFunc = 2.5, "multibrot"
+	if _, err := TraceRay(context.Background(), &p, big.NewRat(1, 3), 64); err == nil {
+		t.Errorf("TraceRay traced a ray at power 2.5")
+	}
+	if err := p.Validate(); err == nil {
+		t.Errorf("Expected rays at power 2.5 not to validate")
+	}
+}
+
+func TestContours(t *testing.T) {
+	p := parameters()
+	p.Width, p.Height, p.ImageWidth, p.ImageHeight = 96, 96, 96, 96
+	p.Min, p.Max = complex(-2, -1.5), complex(1, 1.5)
+
+	draw := func(o Overlay) *image.NRGBA64 {
+		p.Overlay = o
+		img := image.NewNRGBA64(image.Rect(0, 0, 96, 96))
+		DrawOverlay(img, &p)
+		return img
+	}
+
+	// Lines are drawn outside the set only, and blended at their edges.
+	for _, o := range []Overlay{
+		{Equipotentials: true, Color: "#ff0000"},
+		{Equipotentials: true, EquipotentialSpacing: 0.5, Color: "#ff0000"},
+		{FieldLines: true, Color: "#ff0000"},
+	} {
+		img := draw(o)
+		full, partial := 0, 0
+		for y := 0; y < 96; y++ {
+			for x := 0; x < 96; x++ {
+				switch k := img.NRGBA64At(x, y); {
+				case k.R > 0xc000:
+					full++
+				case k.R > 0:
+					partial++
+				}
+			}
+		}
+		if full < 96 || partial < 96 {
+			t.Errorf("%+v draws %d pixels and %d in part", o, full, partial)
+		}
+		x, y := NewTransform(p.Min, p.Max, 96, 96, 0, nil).PointToPixel(-0.1)
+		if img.NRGBA64At(int(x), int(y)).R != 0 {
+			t.Errorf("%+v draws inside the set", o)
+		}
+	}
+
+	// Equipotentials are where the smooth iteration count is a multiple
+	// of the spacing, so halving it draws all of them and more.
+	one, half := draw(Overlay{Equipotentials: true, Color: "#ff0000"}), draw(Overlay{Equipotentials: true, EquipotentialSpacing: 0.5, Color: "#ff0000"})
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 96; x++ {
+			if int(one.NRGBA64At(x, y).R) > int(half.NRGBA64At(x, y).R)+2 {
+				t.Fatalf("Equipotentials every half an iteration miss one at %d, %d", x, y)
+			}
+		}
+	}
+
+	// However many goroutines work them out, and however many bands a
+	// render draws them over, they come out the same, along with the
+	// orbit and rays traced once for the whole render.
+	p.Overlay = Overlay{Equipotentials: true, FieldLines: true, Orbit: true, OrbitAt: -0.1 + 0.7i, Rays: []string{"1/3"}}
+	cv := canvas{image.NewNRGBA64(image.Rect(0, 10, 96, 40)), 96, 96, NewTransform(p.Min, p.Max, 96, 96, 0, nil)}
+	serial, _ := cv.contourCover(context.Background(), &p, true, true, 1, 1, 1)
+	threaded, _ := cv.contourCover(context.Background(), &p, true, true, 1, 1, 4)
+	if !reflect.DeepEqual(serial, threaded) {
+		t.Errorf("Contours differ with more goroutines")
+	}
+
+	// They stop with the render.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cv.contourCover(cancelled, &p, true, true, 1, 1, 4); err != context.Canceled {
+		t.Errorf("Contours went on after the render was cancelled: %v", err)
+	}
+	if _, err := RenderImage(cancelled, &p, n_cpu, nil); err != context.Canceled {
+		t.Errorf("RenderImage went on after it was cancelled: %v", err)
+	}
+
+	// Progressive renders only draw them on the final pass.
+	plainPasses := [][]uint8{}
+	p.Overlay = Overlay{}
+	RenderProgressive(context.Background(), &p, n_cpu, nil, func(pass Pass) error {
+		plainPasses = append(plainPasses, append([]uint8{}, pass.Image.Pix...))
+		return nil
+	})
+	p.Overlay = Overlay{Equipotentials: true, FieldLines: true}
+	n := 0
+	RenderProgressive(context.Background(), &p, n_cpu, nil, func(pass Pass) error {
+		if same := reflect.DeepEqual(pass.Image.Pix, plainPasses[n]); same == pass.Final {
+			t.Errorf("Pass %d draws contours: %v, final: %v", n, !same, pass.Final)
+		}
+		n++
+		return nil
+	})
+	p.Overlay = Overlay{Equipotentials: true, FieldLines: true, Orbit: true, OrbitAt: -0.1 + 0.7i, Rays: []string{"1/3"}}
+
+	whole, err := RenderImage(context.Background(), &p, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("RenderImage failed: %v", err)
+	}
+	p.Overlay = Overlay{}
+	plain, _ := RenderImage(context.Background(), &p, n_cpu, nil)
+	p.Overlay = Overlay{Equipotentials: true, FieldLines: true, Orbit: true, OrbitAt: -0.1 + 0.7i, Rays: []string{"1/3"}}
+	DrawOverlay(plain, &p)
+	if !reflect.DeepEqual(whole.Pix, plain.Pix) {
+		t.Errorf("A traced Overlay draws differently over bands")
+	}
+
+	p.Overlay = Overlay{Equipotentials: true}
+	p.RenderFunc = "multibrot"
+	p.Exponent = 2.5
+	if err := p.Validate(); err != nil {
+		t.Errorf("Equipotentials don't validate for multibrot: %v", err)
+	}
+	p.Overlay.EquipotentialSpacing = -1
+	if err := p.Validate(); err == nil {
+		t.Errorf("Expected a negative equipotential spacing not to validate")
+	}
+}
+
+func TestExplore(t *testing.T) {
+	p := parameters()
+	p.Width, p.Height, p.ImageWidth, p.ImageHeight = 160, 120, 160, 120
+	p.MaxI = 500
+	p.SetView(View{Center: -0.5, Magnification: 1})
+
+	for name, interest := range Interests {
+		e := &Exploration{Start: p, Levels: 4, Zoom: 4, Interest: interest, ThumbnailSize: 64}
+		waypoints, err := Explore(context.Background(), e, n_cpu)
+		if err != nil {
+			t.Fatalf("Explore failed: %v", err)
+		}
+		if len(waypoints) != 4 {
+			t.Fatalf("Exploring by %s makes %d waypoints", name, len(waypoints))
+		}
+
+		last := p
+		for n, wp := range waypoints {
+			if want := math.Pow(4, float64(n+1)); math.Abs(wp.View.Magnification-want) > 1e-9*want {
+				t.Errorf("Waypoint %d by %s is magnified %v times, not %v", n, name, wp.View.Magnification, want)
+			}
+			if x, y := last.Transform().PointToPixel(wp.View.Center); x < 0 || x > 160 || y < 0 || y > 120 {
+				t.Errorf("Waypoint %d by %s is outside the last view", n, name)
+			}
+			if b := wp.Thumbnail.Bounds(); b.Dx() != 64 || b.Dy() != 48 {
+				t.Errorf("Waypoint %d by %s has a %v thumbnail", n, name, b)
+			}
+			last = wp.Parameters
+		}
+
+		// It ends up somewhere with more than one iteration count, which
+		// is where the set's boundary is.
+		probe := resized(&last, 32)
+		counts, _ := iterationCounts(context.Background(), &probe, 1, Escape)
+		if threaded, _ := iterationCounts(context.Background(), &probe, 4, Escape); !reflect.DeepEqual(counts, threaded) {
+			t.Errorf("Iteration counts differ with more goroutines")
+		}
+		distinct := map[int]bool{}
+		for _, i := range counts {
+			distinct[i] = true
+		}
+		if len(distinct) < 4 {
+			t.Errorf("Exploring by %s ends up at %v, where there are only %d iteration counts", name, waypoints[3].View, len(distinct))
+		}
+
+		again, _ := Explore(context.Background(), e, 1)
+		if again[3].View != waypoints[3].View {
+			t.Errorf("Exploring by %s twice ends up at %v and %v", name, waypoints[3].View, again[3].View)
+		}
+	}
+
+	for _, e := range []Exploration{
+		{Start: p, Levels: 0, Zoom: 4},
+		{Start: p, Levels: 4, Zoom: 1},
+		{Start: p, Levels: 4, Zoom: 4, ThumbnailSize: -1},
+		{Start: p, Levels: 4, Zoom: 4, Interest: Interest(7)},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("Expected %+v not to validate", e)
+		}
+	}
+}
+
+func TestEstimateArea(t *testing.T) {
+	p := parameters()
+
+	for _, method := range AreaMethods {
+		var last *AreaEstimate
+		for _, shortcuts := range []bool{false, true} {
+			e := &AreaEstimation{Parameters: p, Method: method, Samples: 200000, Seed: 1, Shortcuts: shortcuts, Bins: 10}
+			a, err := EstimateArea(context.Background(), e, n_cpu, nil)
+			if err != nil {
+				t.Fatalf("EstimateArea failed: %v", err)
+			}
+
+			// The area of the Mandelbrot set is about 1.5066.
+			if math.Abs(a.Area-1.5066) > a.Error || a.Error > 0.1 {
+				t.Errorf("Mandelbrot set's area by %v is %v ± %v", method, a.Area, a.Error)
+			}
+
+			sum := 0
+			for _, n := range a.Histogram {
+				sum += n
+			}
+			if sum != a.Escaped || a.Escaped+a.Members != a.Points {
+				t.Errorf("%d points by %v are %d members, %d escaped and %d in the histogram", a.Points, method, a.Members, a.Escaped, sum)
+			}
+
+			// The shortcuts are only there to be quicker.
+			if last != nil && (a.Members != last.Members || a.Area != last.Area) {
+				t.Errorf("Shortcuts change the area by %v from %v to %v", method, last.Area, a.Area)
+			}
+			if shortcuts != (a.Shortcuts > 0) {
+				t.Errorf("%d shortcuts by %v with shortcuts %v", a.Shortcuts, method, shortcuts)
+			}
+			last = a
+		}
+	}
+
+	// The filled Julia set of 0 is the unit disk.
+	p.Julia, p.Seed = true, 0
+	a, err := EstimateArea(context.Background(), &AreaEstimation{Parameters: p, Shortcuts: true, Bins: 1}, n_cpu, nil)
+	if err != nil {
+		t.Fatalf("EstimateArea failed: %v", err)
+	}
+	if math.Abs(a.Area-math.Pi) > a.Error || a.Shortcuts > 0 {
+		t.Errorf("Unit disk's area is %v ± %v, with %d shortcuts", a.Area, a.Error, a.Shortcuts)
+	}
+
+	for _, e := range []AreaEstimation{
+		{Parameters: p, Method: AreaMonteCarlo, Bins: 1},
+		{Parameters: p, Bins: 0},
+		{Parameters: p, Method: AreaMethod(7), Bins: 1},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("Expected %+v not to validate", e)
+		}
+	}
+
+	if m, err := AreaMethodFromString("montecarlo"); err != nil || m != AreaMonteCarlo {
+		t.Errorf("Expected montecarlo to be AreaMonteCarlo, got %v, %v", m, err)
+	}
+	if _, err := AreaMethodFromString("guess"); err == nil {
+		t.Errorf("Expected an invalid area method to fail")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	sizes := map[string]uint64{
+		"0":      0,
+		"512":    512,
+		"1K":     1024,
+		"1.5M":   1536 * 1024,
+		"2G":     2 << 30,
+		"2 GiB":  2 << 30,
+		"16mb":   16 << 20,
+		"0.25 T": 1 << 38,
+	}
+
+	for s, expected := range sizes {
+		n, err := ParseByteSize(s)
+		if err != nil || n != expected {
+			t.Errorf("Expected %#v to be %d bytes, got %d, %v", s, expected, n, err)
+		}
+	}
+
+	for _, s := range []string{"", "G", "-1K", "lots"} {
+		if _, err := ParseByteSize(s); err == nil {
+			t.Errorf("Expected %#v not to parse.", s)
+		}
+	}
+}
+
 func TestRenderImage(t *testing.T) {
-	c := make(chan bool)
 	p := parameters()
 	contexts := contexts(&p)
-	Render(n_cpu, contexts, c)
+
+	err := Render(context.Background(), n_cpu, contexts)
+	if err != nil {
+		t.Errorf("Render failed: %v", err)
+	}
+}
+
+func TestRenderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := parameters()
+	contexts := contexts(&p)
+
+	cancel()
+	err := Render(ctx, n_cpu, contexts)
+	if err != context.Canceled {
+		t.Errorf("Expected a cancelled render to fail with %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestRenderProgress(t *testing.T) {
+	p := parameters()
+	contexts := contexts(&p)
+
+	var last Progress
+	reports := 0
+	err := RenderProgress(context.Background(), n_cpu, contexts, func(progress Progress) {
+		if progress.PixelsDone < last.PixelsDone || progress.TilesDone < last.TilesDone {
+			t.Errorf("Progress went backwards: %+v after %+v", progress, last)
+		}
+		last = progress
+		reports++
+	})
+	if err != nil {
+		t.Errorf("Render failed: %v", err)
+	}
+
+	if reports < len(contexts) {
+		t.Errorf("Expected at least %d progress reports, got %d", len(contexts), reports)
+	}
+	if last.TilesDone != len(contexts) || last.Fraction() != 1.0 {
+		t.Errorf("Final progress report isn't complete: %+v", last)
+	}
 }
 
 func TestMandelbrot(t *testing.T) {
-	c := make(chan bool)
 	p := parameters()
 	contexts := contexts(&p)
 
-	rc := Mandelbrot(contexts[0], c)
-	if rc != 0 {
-		t.Errorf("Mandelbrot didn't return 0: %d", rc)
+	err := Mandelbrot(context.Background(), contexts[0])
+	if err != nil {
+		t.Errorf("Mandelbrot failed: %v", err)
 	}
 }
 
@@ -64,7 +1438,8 @@ func TestEscape(t *testing.T) {
 	p := parameters()
 	contexts := contexts(&p)
 	z_in := complex(0.1*rand.Float64(), 0.1*rand.Float64())
-	z_out := complex(2.0*rand.Float64(), 2.0*rand.Float64())
+	// Anywhere beyond 2 escapes, but not everywhere nearer does.
+	z_out := cmplx.Rect(2.0+rand.Float64(), 2*math.Pi*rand.Float64())
 
 	i, _ := Escape(contexts[0], z_in, p.MaxI)
 	if i != p.MaxI {
@@ -76,25 +1451,57 @@ func TestEscape(t *testing.T) {
 	}
 }
 
+func TestRegisterRenderFunc(t *testing.T) {
+	info := RenderFuncInfo{
+		Name:        "test-blocks",
+		Description: "colored blocks, one per context",
+		Func: func(ctx context.Context, c *Context) error {
+			TestBlocks(c)
+			return nil
+		},
+	}
+
+	if err := RegisterRenderFunc(info); err != nil {
+		t.Fatalf("Unable to register RenderFunc: %v", err)
+	}
+	if err := RegisterRenderFunc(info); err == nil {
+		t.Errorf("Registered RenderFunc %#v twice.", info.Name)
+	}
+
+	if _, err := RenderFuncFromString(info.Name); err != nil {
+		t.Errorf("Registered RenderFunc not found: %v", err)
+	}
+
+	found := false
+	for _, rf := range RenderFuncs() {
+		found = found || rf.Name == info.Name
+	}
+	if !found {
+		t.Errorf("RenderFuncs() doesn't list %#v.", info.Name)
+	}
+
+	if _, err := ColorFuncFromString("no-such-color"); err == nil {
+		t.Errorf("Found a ColorFunc that was never registered.")
+	}
+}
+
 func BenchmarkRenderImage(b *testing.B) {
-	c := make(chan bool)
 	p := parameters()
 	contexts := contexts(&p)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		Render(n_cpu, contexts, c)
+		Render(context.Background(), n_cpu, contexts)
 	}
 }
 
 func BenchmarkMandelbrot(b *testing.B) {
-	c := make(chan bool)
 	p := parameters()
 	contexts := contexts(&p)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		Mandelbrot(contexts[0], c)
+		Mandelbrot(context.Background(), contexts[0])
 	}
 }
 
@@ -0,0 +1,84 @@
+package gofr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Hash is a key that identifies the image a set of Parameters renders.
+ * Parameters that render the same image, like Scaling left at zero or
+ * set to what it works out to, hash the same. The library Version is
+ * part of it, so that a new renderer doesn't reuse old images.
+ */
+func (self *Parameters) Hash() string {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	s, err := self.Samples()
+	if err != nil {
+		s = 0
+	}
+
+	aa := []string{"0"}
+	if self.AdaptiveSamples > 0 {
+		aa = []string{
+			strconv.Itoa(self.AdaptiveSamples),
+			f(self.AdaptiveThreshold),
+			strconv.Itoa(self.AdaptiveIterations),
+		}
+	}
+
+	julia := "0"
+	if self.Julia {
+		julia = f(real(self.Seed)) + "," + f(imag(self.Seed))
+	}
+
+	affine := "0"
+	if a := self.Affine; a != nil {
+		affine = strings.Join([]string{f(a.XX), f(a.XY), f(a.YX), f(a.YY), f(real(a.Offset)), f(imag(a.Offset))}, ",")
+	}
+
+	overlay := "0"
+	if o := self.Overlay; o.Enabled() {
+		overlay = fmt.Sprint(o.Axes, o.Grid, o.Labels, o.ScaleBar, ",", strings.ToLower(o.Color), ",", strings.ToLower(o.GridColor), ",", f(o.Spacing))
+		if o.Orbit {
+			overlay += ",orbit," + f(real(o.OrbitAt)) + "," + f(imag(o.OrbitAt))
+		}
+		if o.Equipotentials || o.FieldLines {
+			overlay += fmt.Sprint(",contours,", o.Equipotentials, o.FieldLines, ",", f(o.EquipotentialSpacing))
+		}
+		if len(o.Rays) > 0 {
+			overlay += ",rays," + strings.Join(o.Rays, ",")
+		}
+	}
+
+	fields := []string{
+		Version,
+		self.RenderFunc,
+		self.ColorFunc,
+		strings.ToLower(self.MemberColor),
+		fmt.Sprint(self.Width, "x", self.Height, "x", s),
+		strconv.Itoa(self.ImageWidth),
+		strconv.Itoa(self.ImageHeight),
+		f(real(self.Min)), f(imag(self.Min)),
+		f(real(self.Max)), f(imag(self.Max)),
+		strconv.Itoa(self.MaxI),
+		f(self.EscapeRadius),
+		strconv.Itoa(self.Power),
+		strings.Join(aa, ","),
+		julia,
+		f(self.Exponent),
+		f(self.PaletteOffset),
+		f(self.Angle),
+		affine,
+		overlay,
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,20 +1,22 @@
 package gofr
 
-import "math"
+import (
+	"context"
+	"math"
+)
 
-func Mandelbrot(c *Context, cancel chan bool) int {
+func Mandelbrot(ctx context.Context, c *Context) error {
 	maxI := c.MaxI
 	fn := func(x, y int, z complex128) {
 		i, zn := Escape(c, z, maxI)
 		c.ColorFunc(c, zn, x, y, i, maxI)
 	}
-	c.EachPoint(fn, cancel)
-	return 0
+	return c.EachPoint(ctx, fn)
 }
 
 func Escape(c *Context, z complex128, maxI int) (int, complex128) {
 	i := 0
-	z0 := z
+	z0 := c.constant(z)
 	zn := complex(0, 0)
 	p := c.Power
 
@@ -46,6 +48,21 @@ func Escape(c *Context, z complex128, maxI int) (int, complex128) {
 
 		i++
 	}
+}
 
-	return i, z0
+func Step(c *Context, z complex128) (complex128, complex128) {
+	p := c.Power
+	if p <= 0 {
+		p = 2
+	}
+
+	// The same multiplications as Escape, so that orbits agree with it
+	// to the last bit.
+	t := z
+	d := complex(1, 0)
+	for j := 0; j < p-1; j++ {
+		d = z
+		z = z * t
+	}
+	return z, complex(float64(p), 0) * d
 }
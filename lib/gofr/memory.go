@@ -0,0 +1,54 @@
+package gofr
+
+/*
+ * BytesPerPixel is the size of one pixel of the image.NRGBA64s that
+ * RenderFuncs draw on and RenderImage returns.
+ */
+const BytesPerPixel = 8
+
+/*
+ * EstimateMemory is roughly how many bytes of images RenderImage needs
+ * for a set of Parameters: the Width by Height result plus one band
+ * being rendered.
+ */
+func (self *Parameters) EstimateMemory() uint64 {
+	w := uint64(self.Width)
+	h := uint64(self.Height)
+
+	return BytesPerPixel*w*h + self.EstimateStreamMemory(DefaultBandHeight)
+}
+
+/*
+ * EstimateStreamMemory is roughly how many bytes of images EncodePNG
+ * needs for a set of Parameters: one supersampled band of bandHeight
+ * rows and its downsampled result, or with adaptive anti-aliasing, one
+ * band with its iteration counts and its re-sampled result. The whole
+ * image is never in memory.
+ */
+func (self *Parameters) EstimateStreamMemory(bandHeight int) uint64 {
+	s, err := self.Samples()
+	if err != nil {
+		s = 1
+	}
+
+	rows := uint64(bandHeight)
+	if h := uint64(self.Height); rows > h {
+		rows = h
+	}
+	iw := uint64(nonNegative(self.ImageWidth))
+	w := uint64(self.Width)
+
+	if self.AdaptiveSamples > 0 {
+		// One row of margin above and below, and an int32 per pixel.
+		return (BytesPerPixel+4)*iw*(rows+2) + BytesPerPixel*w*rows
+	}
+
+	return BytesPerPixel * (iw*rows*uint64(s) + w*rows)
+}
+
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
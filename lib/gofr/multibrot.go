@@ -0,0 +1,50 @@
+package gofr
+
+import (
+	"context"
+	"math"
+	"math/cmplx"
+)
+
+/*
+ * Multibrot renders z = z^e + c for any real Exponent e, so that the
+ * number of bulbs can change smoothly from one frame to the next.
+ * Powers that aren't whole numbers cut the plane along the negative real
+ * axis of z, where the principal value of z^e jumps.
+ */
+func Multibrot(ctx context.Context, c *Context) error {
+	maxI := c.MaxI
+	fn := func(x, y int, z complex128) {
+		i, zn := MultibrotEscape(c, z, maxI)
+		c.ColorFunc(c, zn, x, y, i, maxI)
+	}
+	return c.EachPoint(ctx, fn)
+}
+
+func MultibrotEscape(c *Context, z complex128, maxI int) (int, complex128) {
+	i := 0
+	z0 := c.constant(z)
+	zn := complex(0, 0)
+	e := complex(c.degree(), 0)
+
+	for {
+		z = cmplx.Pow(z, e) + z0
+
+		if zn == z {
+			return maxI, z
+		}
+		zn = z
+
+		d := math.Sqrt(real(z)*real(z) + imag(z)*imag(z))
+		if d >= c.EscapeRadius || i == maxI {
+			return i, z
+		}
+
+		i++
+	}
+}
+
+func MultibrotStep(c *Context, z complex128) (complex128, complex128) {
+	e := complex(c.degree(), 0)
+	return cmplx.Pow(z, e), e * cmplx.Pow(z, e-1)
+}
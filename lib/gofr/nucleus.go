@@ -0,0 +1,302 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+/*
+ * Nucleus is the center of a hyperbolic component of the set: the point
+ * c whose orbit from 0 comes back to 0 after Period steps. Size is how
+ * big its component is compared to the main cardioid, and Orientation
+ * is how far it's turned anticlockwise from it in radians, so that for
+ * a minibrot it's the angle its copy of the set lies at.
+ */
+type Nucleus struct {
+	C           complex128
+	Period      int
+	Size        float64
+	Orientation float64
+}
+
+/*
+ * View is a View that shows a Nucleus' component the way a View at
+ * magnification 1 and center -0.5 shows the whole set, turned by its
+ * Orientation.
+ */
+func (self Nucleus) View() View {
+	s := cmplx.Rect(self.Size, self.Orientation)
+	return View{
+		Center:        self.C - 0.5*s,
+		Magnification: 1 / self.Size,
+		Angle:         self.Orientation,
+	}
+}
+
+const (
+	/*
+	 * MaxNucleusPeriod is the longest period FindNuclei looks for.
+	 */
+	MaxNucleusPeriod = 4096
+
+	/*
+	 * newtonSteps is how many steps of Newton's method the finders here
+	 * take at most.
+	 */
+	newtonSteps = 64
+
+	/*
+	 * newtonTolerance is how small, relative to the size of the point,
+	 * a Newton step must get for them to stop early, and newtonAccept
+	 * how small the last must be for them to have found anything.
+	 */
+	newtonTolerance = 1e-15
+	newtonAccept    = 1e-10
+
+	/*
+	 * searchSeeds is how many points along each side of a view the
+	 * finders start Newton's method from.
+	 */
+	searchSeeds = 8
+)
+
+/*
+ * viewSearch spreads Newton's method over the view of a set of
+ * Parameters, and keeps track of what it's found.
+ */
+type viewSearch struct {
+	transform     Transform
+	width, height float64
+	center        complex128
+	pixel         float64
+}
+
+func newViewSearch(p *Parameters) viewSearch {
+	t := NewTransform(p.Min, p.Max, int(p.Width), int(p.Height), p.Angle, p.Affine)
+	w, h := float64(p.Width), float64(p.Height)
+	return viewSearch{
+		transform: t,
+		width:     w,
+		height:    h,
+		center:    t.PixelToPoint(w/2, h/2),
+		pixel:     cmplx.Abs(t.PixelToPoint(1, 0) - t.PixelToPoint(0, 0)),
+	}
+}
+
+/*
+ * seeds are the center of the view and a grid of points over it.
+ */
+func (self viewSearch) seeds() []complex128 {
+	seeds := []complex128{self.center}
+	for i := 0; i < searchSeeds; i++ {
+		for j := 0; j < searchSeeds; j++ {
+			seeds = append(seeds, self.transform.PixelToPoint(
+				(float64(i)+0.5)*self.width/searchSeeds,
+				(float64(j)+0.5)*self.height/searchSeeds,
+			))
+		}
+	}
+	return seeds
+}
+
+/*
+ * fresh reports whether z is in view and isn't within a thousandth of a
+ * pixel of any of found.
+ */
+func (self viewSearch) fresh(z complex128, found []complex128) bool {
+	if x, y := self.transform.PointToPixel(z); x < 0 || x >= self.width || y < 0 || y >= self.height {
+		return false
+	}
+	for _, f := range found {
+		if cmplx.Abs(f-z) < 1e-3*self.pixel {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * nearer reports whether a is nearer the center of the view than b.
+ */
+func (self viewSearch) nearer(a, b complex128) bool {
+	return cmplx.Abs(a-self.center) < cmplx.Abs(b-self.center)
+}
+
+/*
+ * nucleusContext is a Context for following points one at a time under
+ * a set of Parameters that have nuclei: those of a RenderFunc with a
+ * StepFunc that raises z to a power greater than one, outside of Julia
+ * sets.
+ */
+func nucleusContext(p *Parameters) (*Context, StepFunc, error) {
+	c, step, err := stepContext(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Julia || c.degree() <= 1 {
+		return nil, nil, fmt.Errorf("RenderFunc %#v has no nuclei to find here.", p.RenderFunc)
+	}
+	return c, step, nil
+}
+
+/*
+ * FindNucleus finds the nucleus of period period nearest to guess by
+ * Newton's method on z(period), the polynomial in c that the orbit of 0
+ * reaches after period steps. It fails if Newton's method doesn't
+ * settle, or settles on a nucleus of a shorter period that divides it.
+ */
+func FindNucleus(p *Parameters, guess complex128, period int) (Nucleus, error) {
+	c, step, err := nucleusContext(p)
+	if err != nil {
+		return Nucleus{}, err
+	}
+	if period < 1 || period > MaxNucleusPeriod {
+		return Nucleus{}, fmt.Errorf("Period must be between 1 and %d.", MaxNucleusPeriod)
+	}
+
+	return findNucleus(c, step, guess, period)
+}
+
+func findNucleus(c *Context, step StepFunc, guess complex128, period int) (Nucleus, error) {
+	z0 := guess
+	last := math.Inf(1)
+	for n := 0; n < newtonSteps; n++ {
+		z, dz := complex(0, 0), complex(0, 0)
+		for i := 0; i < period; i++ {
+			fz, dfz := step(c, z)
+			dz = dfz*dz + 1
+			z = fz + z0
+		}
+
+		d := z / dz
+		if !finite(real(d)) || !finite(imag(d)) {
+			break
+		}
+		z0 -= d
+		last = cmplx.Abs(d)
+		if last <= newtonTolerance*math.Max(1, cmplx.Abs(z0)) {
+			break
+		}
+	}
+
+	if !(last <= newtonAccept*math.Max(1, cmplx.Abs(z0))) {
+		return Nucleus{}, fmt.Errorf("No nucleus of period %d near %v.", period, guess)
+	}
+
+	// Size and orientation by the product of the derivatives around the
+	// cycle and the sum of their partial products' reciprocals.
+	z, l, b := z0, complex(1, 0), complex(1, 0)
+	for i := 1; i < period; i++ {
+		if cmplx.Abs(z) <= newtonAccept*math.Max(1, cmplx.Abs(z0)) {
+			return Nucleus{}, fmt.Errorf("Nucleus at %v has period %d, not %d.", z0, i, period)
+		}
+		fz, dfz := step(c, z)
+		l *= dfz
+		b += 1 / l
+		z = fz + z0
+	}
+
+	d := c.degree()
+	s := 1 / (b * cmplx.Pow(l, complex(d/(d-1), 0)))
+	size := cmplx.Abs(s)
+	if !finite(size) || size == 0 {
+		return Nucleus{}, fmt.Errorf("Nucleus at %v has no size.", z0)
+	}
+
+	return Nucleus{C: z0, Period: period, Size: size, Orientation: cmplx.Phase(s)}, nil
+}
+
+/*
+ * BoxPeriod is the lowest period of the nuclei in the view of a set of
+ * Parameters, at most maxPeriod, found as the first iteration at which
+ * the orbits of the view's corners surround 0. It's zero if they don't
+ * by maxPeriod, or escape first.
+ */
+func BoxPeriod(p *Parameters, maxPeriod int) (int, error) {
+	c, step, err := nucleusContext(p)
+	if err != nil {
+		return 0, err
+	}
+
+	t := NewTransform(p.Min, p.Max, int(p.Width), int(p.Height), p.Angle, p.Affine)
+	w, h := float64(p.Width), float64(p.Height)
+	cs := []complex128{t.PixelToPoint(0, 0), t.PixelToPoint(w, 0), t.PixelToPoint(w, h), t.PixelToPoint(0, h)}
+	zs := make([]complex128, len(cs))
+
+	for n := 1; n <= maxPeriod; n++ {
+		for i := range zs {
+			fz, _ := step(c, zs[i])
+			zs[i] = fz + cs[i]
+			if cmplx.Abs(zs[i]) >= c.EscapeRadius {
+				return 0, nil
+			}
+		}
+		if surrounds(zs, 0) {
+			return n, nil
+		}
+	}
+	return 0, nil
+}
+
+/*
+ * surrounds reports whether the polygon with the corners zs winds
+ * around z.
+ */
+func surrounds(zs []complex128, z complex128) bool {
+	winding := 0
+	for i := range zs {
+		a, b := zs[i]-z, zs[(i+1)%len(zs)]-z
+		cross := real(a)*imag(b) - imag(a)*real(b)
+		if imag(a) <= 0 && imag(b) > 0 && cross > 0 {
+			winding++
+		} else if imag(a) > 0 && imag(b) <= 0 && cross < 0 {
+			winding--
+		}
+	}
+	return winding != 0
+}
+
+/*
+ * FindNuclei finds the nuclei of period period in the view of a set of
+ * Parameters, nearest its center first, by Newton's method from points
+ * spread over it. If period is zero, it's the view's BoxPeriod. Newton's
+ * method can miss some of them, especially at long periods.
+ */
+func FindNuclei(ctx context.Context, p *Parameters, period int) ([]Nucleus, error) {
+	c, step, err := nucleusContext(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if period == 0 {
+		period, err = BoxPeriod(p, MaxNucleusPeriod)
+		if err != nil || period == 0 {
+			return []Nucleus{}, err
+		}
+	}
+	if period < 1 || period > MaxNucleusPeriod {
+		return nil, fmt.Errorf("Period must be between 1 and %d.", MaxNucleusPeriod)
+	}
+
+	search := newViewSearch(p)
+	nuclei, found := []Nucleus{}, []complex128{}
+	for _, seed := range search.seeds() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n, err := findNucleus(c, step, seed, period)
+		if err != nil || !search.fresh(n.C, found) {
+			continue
+		}
+		nuclei, found = append(nuclei, n), append(found, n.C)
+	}
+
+	sort.Slice(nuclei, func(i, j int) bool {
+		return search.nearer(nuclei[i].C, nuclei[j].C)
+	})
+	return nuclei, nil
+}
@@ -0,0 +1,212 @@
+package gofr
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"math/cmplx"
+)
+
+/*
+ * OrbitPoint is a point of an orbit. It's written to JSON as its real
+ * and imaginary parts and its modulus, with null in place of any that
+ * overflowed.
+ */
+type OrbitPoint complex128
+
+func (self OrbitPoint) MarshalJSON() ([]byte, error) {
+	z := complex128(self)
+	return json.Marshal(struct {
+		Re  *float64 `json:"re"`
+		Im  *float64 `json:"im"`
+		Abs *float64 `json:"abs"`
+	}{jsonFloat(real(z)), jsonFloat(imag(z)), jsonFloat(cmplx.Abs(z))})
+}
+
+func jsonFloat(f float64) *float64 {
+	if !finite(f) {
+		return nil
+	}
+	return &f
+}
+
+/*
+ * Orbit is the iteration of a single point by a set of Parameters, with
+ * what its ColorFunc is given and what can be worked out from it.
+ *
+ * C is the point, which is the constant of the iteration, or its start
+ * for Julia sets, where Seed is the constant. Z is the orbit from the
+ * point itself on; Truncated is true if it was cut short, though the
+ * rest is still worked out from the whole orbit. Iteration is what the
+ * RenderFunc's EscapeFunc returns and Color is the color the ColorFunc
+ * gives it. When the point Escaped, Smooth is its smooth iteration count
+ * and Distance estimates its distance to the set from below, to within a
+ * factor of four; they're zero if it didn't or if they overflowed. When
+ * it didn't, Period is the length of the cycle the orbit settles into,
+ * or zero if it hasn't settled.
+ */
+type Orbit struct {
+	C         OrbitPoint   `json:"c"`
+	Seed      *OrbitPoint  `json:"seed,omitempty"`
+	Z         []OrbitPoint `json:"z"`
+	Truncated bool         `json:"truncated"`
+	Escaped   bool         `json:"escaped"`
+	Iteration int          `json:"iteration"`
+	Color     string       `json:"color"`
+	Smooth    float64      `json:"smooth"`
+	Distance  float64      `json:"distance"`
+	Period    int          `json:"period"`
+}
+
+const (
+	/*
+	 * MaxOrbitPeriod is the longest cycle TraceOrbit looks for.
+	 */
+	MaxOrbitPeriod = 4096
+
+	/*
+	 * orbitTolerance is how close, relative to their size, the points
+	 * of an orbit one cycle apart must be for it to have settled.
+	 */
+	orbitTolerance = 1e-9
+)
+
+/*
+ * stepContext is a Context of a single pixel for following points one
+ * at a time under a set of Parameters, and the StepFunc of their
+ * RenderFunc.
+ */
+func stepContext(p *Parameters) (*Context, StepFunc, error) {
+	info, ok := LookupRenderFunc(p.RenderFunc)
+	if ok && info.Step == nil {
+		return nil, nil, fmt.Errorf("RenderFunc %#v can't follow orbits.", p.RenderFunc)
+	}
+
+	img := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	cs, err := MakeContexts(img, 1, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cs[0], info.Step, nil
+}
+
+/*
+ * TraceOrbit follows the orbit of the point z under a set of Parameters
+ * exactly as rendering it would. It keeps at most limit points of the
+ * orbit; zero or less keeps them all.
+ */
+func TraceOrbit(p *Parameters, z complex128, limit int) (*Orbit, error) {
+	c, step, err := stepContext(p)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Orbit{C: OrbitPoint(z)}
+	if c.Julia {
+		s := OrbitPoint(c.Seed)
+		o.Seed = &s
+	}
+
+	// The end of the orbit is kept apart from Z to look for cycles in,
+	// however much of it Z keeps.
+	tail := []complex128{}
+	keep := func(z complex128) {
+		if limit <= 0 || len(o.Z) < limit {
+			o.Z = append(o.Z, OrbitPoint(z))
+		} else {
+			o.Truncated = true
+		}
+		tail = append(tail, z)
+		if len(tail) > 4*MaxOrbitPeriod {
+			tail = append(tail[:0], tail[len(tail)-2*MaxOrbitPeriod:]...)
+		}
+	}
+	keep(z)
+
+	maxI := c.MaxI
+	z0 := c.constant(z)
+	i, z, dz := follow(c, step, z, keep)
+	o.Iteration = i
+
+	o.Escaped = o.Iteration < maxI
+	if o.Escaped {
+		if s := c.smoothIteration(z, o.Iteration); finite(s) {
+			o.Smooth = s
+		}
+		r := cmplx.Abs(z)
+		if d := r * math.Log(r) / (2 * cmplx.Abs(dz)); finite(d) {
+			o.Distance = d
+		}
+	} else {
+		// Follow the cycle further than rendering does, since it stops
+		// as soon as a point repeats the last, or at first when it's 0.
+		w := z
+		for n := 0; n < 2*MaxOrbitPeriod; n++ {
+			fw, _ := step(c, w)
+			w = fw + z0
+			tail = append(tail, w)
+		}
+		o.Period = period(tail)
+	}
+
+	c.ColorFunc(c, z, 0, 0, o.Iteration, maxI)
+	k := c.Image.NRGBA64At(0, 0)
+	o.Color = fmt.Sprintf("#%02x%02x%02x", k.R>>8, k.G>>8, k.B>>8)
+
+	return o, nil
+}
+
+/*
+ * follow iterates z exactly as the EscapeFuncs do, calling each with
+ * every point after the first if it's set. It returns what they do,
+ * along with the derivative of the last point: with respect to c, or to
+ * the start for Julia sets.
+ */
+func follow(c *Context, step StepFunc, z complex128, each func(complex128)) (int, complex128, complex128) {
+	maxI := c.MaxI
+	z0 := c.constant(z)
+	dz := complex(1, 0)
+	zn := complex(0, 0)
+	for i := 0; ; i++ {
+		fz, dfz := step(c, z)
+		dz *= dfz
+		if !c.Julia {
+			dz += 1
+		}
+		z = fz + z0
+		if each != nil {
+			each(z)
+		}
+
+		if zn == z {
+			return maxI, z, dz
+		}
+		zn = z
+
+		d := math.Sqrt(real(z)*real(z) + imag(z)*imag(z))
+		if d >= c.EscapeRadius || i == maxI {
+			return i, z, dz
+		}
+	}
+}
+
+/*
+ * period is the length of the cycle the end of an orbit has settled
+ * into, or zero if it hasn't.
+ */
+func period(zs []complex128) int {
+	n := len(zs) - 1
+	if n >= 1 && zs[n] == zs[n-1] {
+		return 1
+	}
+
+	last := zs[n]
+	tol := orbitTolerance * math.Max(1, cmplx.Abs(last))
+	for p := 1; 2*p <= n && p <= MaxOrbitPeriod; p++ {
+		if cmplx.Abs(zs[n-p]-last) < tol && cmplx.Abs(zs[n-1-p]-zs[n-1]) < tol {
+			return p
+		}
+	}
+	return 0
+}
@@ -0,0 +1,584 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/cmplx"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Overlay is what to draw over a render to show where on the plane it
+ * is: the real and imaginary Axes, with ticks along them, a Grid, Labels
+ * with the value of each grid line and a ScaleBar. Orbit draws the orbit
+ * of the point OrbitAt, as TraceOrbit follows it, as a line through the
+ * first OrbitSteps of its points. Rays draws the external rays of the
+ * angles it lists, in any form ParseAngle takes, as TraceRay follows
+ * them to OverlayRayDepth, with a dot where each lands. Equipotentials
+ * draws a curve at every multiple of EquipotentialSpacing of the smooth
+ * iteration count, or every one if it's zero, and FieldLines the edges
+ * of the cells of a binary decomposition, both under everything else.
+ *
+ * Color is the color of the axes, labels and scale bar, as #rrggbb, or
+ * #rrggbbaa to blend it over the render; empty inverts what's under
+ * them. GridColor is the color of the grid; empty is Color at a third
+ * of its alpha. Spacing is how far apart grid lines, ticks and labels
+ * are on the plane; zero picks a round number that puts about eight of
+ * them across the shorter side of the image.
+ */
+type Overlay struct {
+	Axes     bool
+	Grid     bool
+	Labels   bool
+	ScaleBar bool
+
+	Color     string
+	GridColor string
+	Spacing   float64
+
+	Orbit   bool
+	OrbitAt complex128
+
+	Rays []string
+
+	Equipotentials       bool
+	FieldLines           bool
+	EquipotentialSpacing float64
+}
+
+/*
+ * OrbitSteps is how many points of an orbit an Overlay draws.
+ */
+const OrbitSteps = 1000
+
+/*
+ * OverlayParts are the names of the parts of an Overlay that SetParts
+ * knows, in the order they're drawn.
+ */
+var OverlayParts = []string{"equipotentials", "fieldlines", "grid", "axes", "orbit", "scale", "labels"}
+
+/*
+ * SetParts turns on the parts of an Overlay named in a comma separated
+ * list, like "axes,grid", and turns off the rest.
+ */
+func (self *Overlay) SetParts(list string) error {
+	self.Axes, self.Grid, self.Labels, self.ScaleBar, self.Orbit = false, false, false, false, false
+	self.Equipotentials, self.FieldLines = false, false
+
+	for _, name := range strings.Split(list, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "axes":
+			self.Axes = true
+		case "grid":
+			self.Grid = true
+		case "labels":
+			self.Labels = true
+		case "scale":
+			self.ScaleBar = true
+		case "orbit":
+			self.Orbit = true
+		case "equipotentials":
+			self.Equipotentials = true
+		case "fieldlines":
+			self.FieldLines = true
+		default:
+			return fmt.Errorf("Invalid overlay part: %#v, expected one of %v", name, OverlayParts)
+		}
+	}
+	return nil
+}
+
+/*
+ * SetRays sets the Rays of an Overlay to the angles in a comma separated
+ * list, like "1/3,0.0(01)". Validate checks them.
+ */
+func (self *Overlay) SetRays(list string) {
+	self.Rays = nil
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			self.Rays = append(self.Rays, s)
+		}
+	}
+}
+
+/*
+ * Enabled reports whether an Overlay draws anything.
+ */
+func (self Overlay) Enabled() bool {
+	return self.Axes || self.Grid || self.Labels || self.ScaleBar || self.Orbit || len(self.Rays) > 0 ||
+		self.Equipotentials || self.FieldLines
+}
+
+/*
+ * overlayColor parses an overlay color, #rrggbb or #rrggbbaa. Empty is
+ * inverting at full strength, which is what the color's alpha is then.
+ */
+func overlayColor(hex string) (k color.NRGBA64, inv bool, err error) {
+	if hex == "" {
+		return color.NRGBA64{A: 0xffff}, true, nil
+	}
+	if len(hex) == 7 {
+		k, err = MemberColorFromString(hex)
+		return k, false, err
+	}
+	if len(hex) != 9 {
+		return k, false, fmt.Errorf("Invalid overlay color: %#v", hex)
+	}
+
+	k, err = MemberColorFromString(hex[:7])
+	if err != nil {
+		return k, false, err
+	}
+	a, err := strconv.ParseUint(hex[7:], 16, 8)
+	if err != nil {
+		return k, false, err
+	}
+	k.A = uint16(a * 0x101)
+	return k, false, nil
+}
+
+/*
+ * plotter is the plotFunc for an overlay color.
+ */
+func (self canvas) plotter(k color.NRGBA64, inv bool) plotFunc {
+	if inv {
+		return self.blend(k.A, func(bg color.NRGBA64) color.NRGBA64 {
+			return color.NRGBA64{^bg.R, ^bg.G, ^bg.B, 0xffff}
+		})
+	}
+	return self.paint(k)
+}
+
+/*
+ * halo is the plotFunc for the outline that keeps text in color k
+ * readable: black around light colors and white around dark ones. Text
+ * that inverts what's under it has none.
+ */
+func (self canvas) halo(k color.NRGBA64, inv bool) plotFunc {
+	if inv {
+		return nil
+	}
+	if 0.299*float64(k.R)+0.587*float64(k.G)+0.114*float64(k.B) > 0x7fff {
+		return self.paint(color.NRGBA64{0, 0, 0, k.A})
+	}
+	return self.paint(color.NRGBA64{0xffff, 0xffff, 0xffff, k.A})
+}
+
+/*
+ * outlined marks the pixels that draw marks with plot, once each, and
+ * the pixels around them with halo, if it's set.
+ */
+func outlined(draw func(plotFunc), plot, halo plotFunc) {
+	marks := map[image.Point]bool{}
+	draw(func(x, y int) {
+		marks[image.Point{x, y}] = true
+	})
+
+	if halo != nil {
+		around := map[image.Point]bool{}
+		for pt := range marks {
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if q := pt.Add(image.Point{dx, dy}); !marks[q] {
+						around[q] = true
+					}
+				}
+			}
+		}
+		for q := range around {
+			halo(q.X, q.Y)
+		}
+	}
+
+	for pt := range marks {
+		plot(pt.X, pt.Y)
+	}
+}
+
+/*
+ * niceStep is the smallest of 1, 2 or 5 times a power of ten that's at
+ * least raw, or zero if there isn't one.
+ */
+func niceStep(raw float64) float64 {
+	if !finite(raw) || raw <= 0 {
+		return 0
+	}
+
+	e := int(math.Floor(math.Log10(raw)))
+	m := 10
+	for _, n := range []int{1, 2, 5} {
+		if raw <= float64(n)*math.Pow10(e) {
+			m = n
+			break
+		}
+	}
+	if m == 10 {
+		m, e = 1, e+1
+	}
+
+	// Parsing gives the double nearest the decimal, so that it prints
+	// back as it reads.
+	v, err := strconv.ParseFloat(fmt.Sprintf("%de%d", m, e), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+/*
+ * tickLabel is the label of the kth multiple of unit, with as many
+ * decimals as unit has.
+ */
+func tickLabel(k, unit float64) string {
+	if k == 0 {
+		return "0"
+	}
+
+	decimals := 0
+	if s := strconv.FormatFloat(unit, 'f', -1, 64); strings.Contains(s, ".") {
+		decimals = len(s) - strings.Index(s, ".") - 1
+	}
+	return strconv.FormatFloat(k*unit, 'f', decimals, 64)
+}
+
+/*
+ * spacing is an Overlay's Spacing, or the one it picks when that's zero.
+ */
+func (self canvas) spacing(o Overlay) float64 {
+	if o.Spacing > 0 {
+		return o.Spacing
+	}
+
+	d := self.direction(0, 1)
+	target := math.Max(48, float64(self.shorter())/8)
+	return niceStep(target / math.Hypot(d[0], d[1]))
+}
+
+/*
+ * shorter is the length of the shorter side of the whole image.
+ */
+func (self canvas) shorter() int {
+	if self.width < self.height {
+		return self.width
+	}
+	return self.height
+}
+
+/*
+ * textScale is how many pixels across each pixel of the built-in font
+ * is drawn, so that text stays readable on large images.
+ */
+func (self canvas) textScale() int {
+	return 1 + self.shorter()/512
+}
+
+/*
+ * scaleBar draws a bar a round length of the plane long, with that
+ * length written above it, in the bottom right corner. It returns the
+ * space it takes up, which is empty if it doesn't fit.
+ */
+func (self canvas) scaleBar(scale int, plot, halo plotFunc) image.Rectangle {
+	per := cmplx.Abs(self.transform.PixelToPoint(1, 0) - self.transform.PixelToPoint(0, 0))
+	length := niceStep(float64(self.width) / 6 * per)
+	px := int(math.Round(length / per))
+
+	margin := 4 * scale
+	caption := strconv.FormatFloat(length, 'g', -1, 64)
+	size := textSize(caption, scale)
+	right, bottom := self.width-margin, self.height-margin
+	left := right - px
+	if px < 2*scale || left < margin || size.X > self.width-2*margin {
+		return image.Rectangle{}
+	}
+
+	at := image.Point{left + px/2 - size.X/2, bottom - 4*scale - size.Y}
+	if at.X+size.X > right {
+		at.X = right - size.X
+	}
+
+	outlined(func(mark plotFunc) {
+		for _, r := range []image.Rectangle{
+			image.Rect(left, bottom-scale, right, bottom),
+			image.Rect(left, bottom-3*scale, left+scale, bottom),
+			image.Rect(right-scale, bottom-3*scale, right, bottom),
+		} {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					mark(x, y)
+				}
+			}
+		}
+		self.text(at, caption, scale, mark)
+	}, plot, halo)
+
+	return image.Rect(left, at.Y, right, bottom).Union(image.Rectangle{at, at.Add(size)}).Inset(-scale)
+}
+
+/*
+ * orbit draws an orbit with a dot on each point and a line from each to
+ * the next.
+ */
+func (self canvas) orbit(o *Orbit, scale int, plot, halo plotFunc) {
+	near := func(pt [2]float64) bool {
+		return pt[0] > -1 && pt[0] < float64(self.width+1) && pt[1] > -1 && pt[1] < float64(self.height+1)
+	}
+
+	outlined(func(mark plotFunc) {
+		var last [2]float64
+		for n, z := range o.Z {
+			pt := self.pixel(complex128(z))
+			if n > 0 {
+				self.segment(last, pt, mark)
+			}
+			last = pt
+
+			if near(pt) {
+				x, y := int(math.Floor(pt[0])), int(math.Floor(pt[1]))
+				for dy := -scale; dy <= scale; dy++ {
+					for dx := -scale; dx <= scale; dx++ {
+						mark(x+dx, y+dy)
+					}
+				}
+			}
+		}
+	}, plot, halo)
+}
+
+/*
+ * rays draws external rays with a dot where each lands.
+ */
+func (self canvas) rays(rays []*Ray, scale int, plot, halo plotFunc) {
+	for _, r := range rays {
+		outlined(func(mark plotFunc) {
+			last := self.pixel(complex128(r.Points[0]))
+			for _, z := range r.Points[1:] {
+				pt := self.pixel(complex128(z))
+				self.segment(last, pt, mark)
+				last = pt
+			}
+
+			if r.Landing != nil {
+				pt := self.pixel(complex128(*r.Landing))
+				self.segment(last, pt, mark)
+				x, y := int(math.Floor(pt[0])), int(math.Floor(pt[1]))
+				for dy := -2 * scale; dy <= 2*scale; dy++ {
+					for dx := -2 * scale; dx <= 2*scale; dx++ {
+						if dx*dx+dy*dy <= 4*scale*scale {
+							mark(x+dx, y+dy)
+						}
+					}
+				}
+			}
+		}, plot, halo)
+	}
+}
+
+/*
+ * labels writes the value of each multiple of unit along each axis next
+ * to where it crosses the axis. Where the axis is out of view, they go
+ * along the bottom edge for the real axis and the left edge for the
+ * imaginary one. Labels that would overlap one another, anything in
+ * taken or the edge of the image are left out.
+ */
+func (self canvas) labels(unit float64, tl, scale int, taken []image.Rectangle, plot, halo plotFunc) {
+	whole := image.Rect(0, 0, self.width, self.height)
+	inView := func(p [2]float64) bool {
+		return p[0] >= 0 && p[0] < float64(self.width) && p[1] >= 0 && p[1] < float64(self.height)
+	}
+
+	place := func(at image.Point, s string) {
+		r := image.Rectangle{at, at.Add(textSize(s, scale))}.Inset(-scale)
+		if !r.In(whole) {
+			return
+		}
+		for _, t := range taken {
+			if r.Overlaps(t) {
+				return
+			}
+		}
+		taken = append(taken, r)
+		outlined(func(mark plotFunc) {
+			self.text(at, s, scale, mark)
+		}, plot, halo)
+	}
+
+	lo, hi := self.visible()
+	gap := tl + 2*scale
+
+	origin := inView(self.pixel(0))
+	along := self.direction(0, 1i)
+	for _, k := range multiples(real(lo), real(hi), unit, self.maxLines()) {
+		s := tickLabel(k, unit)
+		size := textSize(s, scale)
+		p := self.pixel(complex(k*unit, 0))
+		switch {
+		case inView(p):
+			place(image.Point{int(math.Round(p[0])) - size.X/2, int(math.Floor(p[1])) + gap}, s)
+		case math.Abs(along[1]) > 1e-9:
+			x := p[0] + (float64(self.height)-0.5-p[1])*along[0]/along[1]
+			place(image.Point{int(math.Round(x)) - size.X/2, self.height - 2*scale - size.Y}, s)
+		}
+	}
+
+	along = self.direction(0, 1)
+	for _, k := range multiples(imag(lo), imag(hi), unit, self.maxLines()) {
+		if k == 0 && origin {
+			continue
+		}
+		s := tickLabel(k, unit) + "i"
+		size := textSize(s, scale)
+		p := self.pixel(complex(0, k*unit))
+		switch {
+		case inView(p):
+			place(image.Point{int(math.Floor(p[0])) + gap, int(math.Round(p[1])) - size.Y/2}, s)
+		case math.Abs(along[0]) > 1e-9:
+			y := p[1] + (0.5-p[0])*along[1]/along[0]
+			place(image.Point{2 * scale, int(math.Round(y)) - size.Y/2}, s)
+		}
+	}
+}
+
+/*
+ * overlaid is img with an Overlay drawn over a copy of it in scratch, so
+ * that img can go on being rendered into, with or without its contours.
+ * It's img itself if scratch is nil, which it should be if there's no
+ * Overlay.
+ */
+func overlaid(p *Parameters, t *tracedOverlay, img, scratch *image.NRGBA64, contours bool) (*image.NRGBA64, error) {
+	if scratch == nil {
+		return img, nil
+	}
+
+	draw.Draw(scratch, img.Bounds(), img, img.Bounds().Min, draw.Src)
+	if err := t.draw(scratch, p, contours); err != nil {
+		return nil, err
+	}
+	return scratch, nil
+}
+
+/*
+ * tracedOverlay is the Overlay of a set of Parameters with the orbit and
+ * rays it draws already traced, so that the bands, passes and frames of
+ * a render draw them without tracing them again. They don't depend on
+ * the view, so it serves every frame of a Zoom. It's nil if there's no
+ * Overlay.
+ */
+type tracedOverlay struct {
+	ctx     context.Context
+	orbit   *Orbit
+	rays    []*Ray
+	threads int
+}
+
+/*
+ * traceOverlay traces the Overlay of a set of Parameters, and then draws
+ * its contours with up to threads goroutines, until ctx is done.
+ */
+func traceOverlay(ctx context.Context, p *Parameters, threads int) *tracedOverlay {
+	o := p.Overlay
+	if !o.Enabled() {
+		return nil
+	}
+
+	t := &tracedOverlay{ctx: ctx, threads: threads}
+	if o.Orbit {
+		t.orbit, _ = TraceOrbit(p, o.OrbitAt, OrbitSteps)
+	}
+	for _, s := range o.Rays {
+		a, err := ParseAngle(s)
+		if err != nil {
+			continue
+		}
+		r, err := TraceRay(ctx, p, a, OverlayRayDepth)
+		if err != nil {
+			continue
+		}
+		t.rays = append(t.rays, r)
+	}
+	return t
+}
+
+/*
+ * DrawOverlay draws the Overlay of a set of Parameters over img, which is
+ * all or a band of rows of their Width by Height result. Bands drawn
+ * separately line up. Renders trace the Overlay once for all of their
+ * bands, where this traces it every time.
+ */
+func DrawOverlay(img *image.NRGBA64, p *Parameters) {
+	traceOverlay(context.Background(), p, runtime.NumCPU()).draw(img, p, true)
+}
+
+/*
+ * draw draws a traced Overlay over img, as DrawOverlay does, with or
+ * without its contours. Working out contours stops with the error of the
+ * Overlay's context if it's done first.
+ */
+func (self *tracedOverlay) draw(img *image.NRGBA64, p *Parameters, contours bool) error {
+	if self == nil {
+		return nil
+	}
+
+	o := p.Overlay
+	w, h := int(p.Width), int(p.Height)
+	cv := canvas{img, w, h, NewTransform(p.Min, p.Max, w, h, p.Angle, p.Affine)}
+
+	k, inv, err := overlayColor(o.Color)
+	if err != nil {
+		return nil
+	}
+	gk, ginv := k, inv
+	gk.A = k.A / 3
+	if o.GridColor != "" {
+		if gk, ginv, err = overlayColor(o.GridColor); err != nil {
+			return nil
+		}
+	}
+
+	unit := cv.spacing(o)
+	scale := cv.textScale()
+	plot := cv.plotter(k, inv)
+	halo := cv.halo(k, inv)
+	tl := 2 * scale
+
+	if contours && (o.Equipotentials || o.FieldLines) {
+		spacing := o.EquipotentialSpacing
+		if spacing == 0 {
+			spacing = 1
+		}
+		cover, err := cv.contourCover(self.ctx, p, o.Equipotentials, o.FieldLines, spacing, float64(scale), self.threads)
+		if err != nil {
+			return err
+		}
+		cv.contours(cover, k, inv)
+	}
+	if o.Grid {
+		cv.grid(unit, cv.plotter(gk, ginv))
+	}
+	if o.Axes {
+		outlined(func(mark plotFunc) {
+			cv.axes(mark)
+			cv.ticks(tl, unit, mark)
+		}, plot, nil)
+	}
+
+	if self.orbit != nil {
+		cv.orbit(self.orbit, scale, plot, halo)
+	}
+	cv.rays(self.rays, scale, plot, halo)
+
+	taken := []image.Rectangle{}
+	if o.ScaleBar {
+		taken = append(taken, cv.scaleBar(scale, plot, halo))
+	}
+	if o.Labels {
+		cv.labels(unit, tl, scale, taken, plot, halo)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package gofr
+
+import (
+	"time"
+)
+
+/*
+ * ProgressInterval is how often RenderProgress reports progress while
+ * tiles are still being worked on.
+ */
+var ProgressInterval = 250 * time.Millisecond
+
+/*
+ * Progress is a snapshot of how far along a render is.
+ */
+type Progress struct {
+	Tiles      int           `json:"tiles"`
+	TilesDone  int           `json:"tiles_done"`
+	Pixels     int64         `json:"pixels"`
+	PixelsDone int64         `json:"pixels_done"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Remaining  time.Duration `json:"remaining"`
+}
+
+/*
+ * ProgressFunc receives progress reports. Reports for one render are
+ * delivered one at a time from a single goroutine.
+ */
+type ProgressFunc func(Progress)
+
+/*
+ * Fraction is the portion of pixels finished, from 0 to 1.
+ */
+func (self Progress) Fraction() float64 {
+	if self.Pixels <= 0 {
+		return 0
+	}
+	return float64(self.PixelsDone) / float64(self.Pixels)
+}
+
+/*
+ * estimate fills in Elapsed and Remaining given when work started.
+ * Remaining assumes the pixels left take as long as the ones done.
+ */
+func (self *Progress) estimate(start time.Time) {
+	self.Elapsed = time.Since(start)
+	self.Remaining = 0
+
+	if self.PixelsDone > 0 && self.PixelsDone < self.Pixels {
+		left := float64(self.Pixels-self.PixelsDone) / float64(self.PixelsDone)
+		self.Remaining = time.Duration(float64(self.Elapsed) * left)
+	}
+}
@@ -0,0 +1,211 @@
+package gofr
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"time"
+)
+
+/*
+ * ProgressiveBlocks are the block sizes RenderProgressive works down
+ * through, coarsest first. Each must divide the one before it, and the
+ * last must be 1.
+ */
+var ProgressiveBlocks = []int{8, 4, 2, 1}
+
+/*
+ * Pass is one successively finer image from RenderProgressive. Block is
+ * how many pixels of the ImageWidth by ImageHeight render across and
+ * down each sample was spread over; 1 means every pixel has been
+ * sampled. Final is true for the last pass, which may be followed by
+ * adaptive anti-aliasing if the Parameters ask for it.
+ */
+type Pass struct {
+	Image *image.NRGBA64
+	Block int
+	Final bool
+}
+
+/*
+ * PassFunc receives each Pass of a progressive render. The Image is only
+ * good until PassFunc returns. An error stops the render.
+ */
+type PassFunc func(Pass) error
+
+/*
+ * samplesIn is how many samples every block by block cell of a w by h
+ * render takes.
+ */
+func samplesIn(w, h, block int) int64 {
+	return int64((w+block-1)/block) * int64((h+block-1)/block)
+}
+
+/*
+ * EstimateProgressiveMemory is roughly how many bytes of images
+ * RenderProgressive needs for a set of Parameters: the whole render and
+ * its downsampled result, plus iteration counts with adaptive
+ * anti-aliasing.
+ */
+func (self *Parameters) EstimateProgressiveMemory() uint64 {
+	iw := uint64(nonNegative(self.ImageWidth))
+	ih := uint64(nonNegative(self.ImageHeight))
+	bytes := BytesPerPixel*iw*ih + BytesPerPixel*uint64(self.Width)*uint64(self.Height)
+
+	if self.AdaptiveSamples > 0 {
+		bytes += 4 * iw * ih
+	}
+	return bytes
+}
+
+/*
+ * RenderProgressive renders a set of Parameters coarsely first and then
+ * more finely, one pass for each of ProgressiveBlocks. Each pass samples
+ * only the points the passes before it skipped and fills the block to
+ * the right of and below each new sample with its color, so the whole
+ * render costs no more than rendering it once. Every pass is handed to
+ * pass downsampled to Width by Height.
+ */
+func RenderProgressive(ctx context.Context, p *Parameters, threads int, fn ProgressFunc, pass PassFunc) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	s, err := p.Samples()
+	if err != nil {
+		return err
+	}
+
+	escape, err := adaptiveEscape(p)
+	if err != nil {
+		return err
+	}
+
+	raster := &adaptiveRaster{image: image.NewNRGBA64(image.Rect(0, 0, p.ImageWidth, p.ImageHeight))}
+	if p.AdaptiveSamples > 0 {
+		raster.iters = make([]int32, p.ImageWidth*p.ImageHeight)
+	}
+
+	result := raster.image
+	if s > 1 {
+		result = image.NewNRGBA64(image.Rect(0, 0, int(p.Width), int(p.Height)))
+	}
+
+	var shown *image.NRGBA64
+	overlay := traceOverlay(ctx, p, threads)
+	if overlay != nil {
+		shown = image.NewNRGBA64(result.Bounds())
+	}
+
+	start := time.Now()
+	progress := Progress{
+		Tiles:  len(ProgressiveBlocks),
+		Pixels: int64(p.ImageWidth) * int64(p.ImageHeight),
+	}
+
+	previous := 0
+	for n, block := range ProgressiveBlocks {
+		// Samples every previous pass took, and how many this one takes.
+		done := int64(0)
+		if previous > 0 {
+			done = samplesIn(p.ImageWidth, p.ImageHeight, previous)
+		}
+		samples := samplesIn(p.ImageWidth, p.ImageHeight, block) - done
+
+		var passProgress ProgressFunc
+		if fn != nil {
+			passProgress = func(pp Progress) {
+				progress.PixelsDone = done + int64(pp.Fraction()*float64(samples))
+				progress.estimate(start)
+				fn(progress)
+			}
+		}
+
+		err = raster.progressivePass(ctx, p, threads, escape, block, previous, passProgress)
+		if err != nil {
+			return err
+		}
+		progress.TilesDone++
+		previous = block
+
+		if s > 1 {
+			downsample(result, raster.image, s)
+		}
+
+		// Contours iterate every pixel again, so only the final pass
+		// has them.
+		final := n == len(ProgressiveBlocks)-1
+		if final && p.AdaptiveSamples > 0 {
+			img, err := overlaid(p, overlay, result, shown, false)
+			if err != nil {
+				return err
+			}
+			err = pass(Pass{Image: img, Block: block})
+			if err != nil {
+				return err
+			}
+
+			band := image.NewNRGBA64(raster.image.Bounds())
+			draw.Draw(band, band.Bounds(), raster.image, band.Bounds().Min, draw.Src)
+			err = raster.refine(ctx, p, threads, escape, band)
+			if err != nil {
+				return err
+			}
+			result = band
+		}
+
+		img, err := overlaid(p, overlay, result, shown, final)
+		if err != nil {
+			return err
+		}
+		err = pass(Pass{Image: img, Block: block, Final: final})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * progressivePass samples every point on a grid of the given block size
+ * that isn't also on the previous, coarser grid, and fills its block.
+ */
+func (self *adaptiveRaster) progressivePass(ctx context.Context, p *Parameters, threads int, escape EscapeFunc, block, previous int, fn ProgressFunc) error {
+	b := self.image.Bounds()
+
+	contexts, err := MakeContexts(self.image, gridSize(threads, b), p)
+	if err != nil {
+		return err
+	}
+	for _, c := range contexts {
+		c.RenderFunc = func(ctx context.Context, c *Context) error {
+			return c.EachPoint(ctx, func(x, y int, z complex128) {
+				if x%block != 0 || y%block != 0 {
+					return
+				}
+				if previous > 0 && x%previous == 0 && y%previous == 0 {
+					return
+				}
+
+				i, zn := escape(c, z, c.MaxI)
+				c.ColorFunc(c, zn, x, y, i, c.MaxI)
+				if self.iters != nil {
+					self.iters[self.offset(x, y)] = int32(i)
+				}
+
+				// Blocks may reach into other Contexts' sub-images,
+				// but no two blocks overlap.
+				k := c.Image.NRGBA64At(x, y)
+				cell := image.Rect(x, y, x+block, y+block).Intersect(b)
+				for by := cell.Min.Y; by < cell.Max.Y; by++ {
+					for bx := cell.Min.X; bx < cell.Max.X; bx++ {
+						self.image.SetNRGBA64(bx, by, k)
+					}
+				}
+			})
+		}
+	}
+
+	return RenderProgress(ctx, threads, contexts, fn)
+}
@@ -0,0 +1,406 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	/*
+	 * MaxRayDepth is how many iterations deep TraceRay follows a ray at
+	 * most.
+	 */
+	MaxRayDepth = 4096
+
+	/*
+	 * OverlayRayDepth is how deep an Overlay follows its rays.
+	 */
+	OverlayRayDepth = 256
+
+	/*
+	 * raySharpness is how many points of a ray TraceRay finds for each
+	 * iteration it goes in, and rayRadius how far out it starts.
+	 */
+	raySharpness = 8
+	rayRadius    = 1e4
+
+	/*
+	 * rootSteps is how many steps the multiplier of a cycle is moved
+	 * along from its nucleus to its root in.
+	 */
+	rootSteps = 16
+)
+
+var (
+	binaryAngle   = regexp.MustCompile(`^0?\.([01]*)(?:\(([01]+)\))?$`)
+	fractionAngle = regexp.MustCompile(`^[0-9]+(/[0-9]+)?$`)
+)
+
+/*
+ * ParseAngle parses an external angle in turns, as a fraction like
+ * "1/3", a whole number or in binary like "0.(01)", where the digits in
+ * brackets repeat forever. It's taken modulo one.
+ */
+func ParseAngle(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	r := new(big.Rat)
+
+	if m := binaryAngle.FindStringSubmatch(s); m != nil {
+		pre, rep := m[1], m[2]
+		one := big.NewInt(1)
+		if pre != "" {
+			n, _ := new(big.Int).SetString(pre, 2)
+			r.SetFrac(n, new(big.Int).Lsh(one, uint(len(pre))))
+		}
+		if rep != "" {
+			n, _ := new(big.Int).SetString(rep, 2)
+			d := new(big.Int).Sub(new(big.Int).Lsh(one, uint(len(rep))), one)
+			d.Lsh(d, uint(len(pre)))
+			r.Add(r, new(big.Rat).SetFrac(n, d))
+		}
+		return turns(r), nil
+	}
+
+	if _, ok := r.SetString(s); !ok || !fractionAngle.MatchString(s) {
+		return nil, fmt.Errorf("Invalid angle: %#v, expected a fraction like 1/3 or binary like 0.(01)", s)
+	}
+	return turns(r), nil
+}
+
+/*
+ * turns is r modulo one.
+ */
+func turns(r *big.Rat) *big.Rat {
+	q := new(big.Int).Quo(r.Num(), r.Denom())
+	return r.Sub(r, new(big.Rat).SetInt(q))
+}
+
+/*
+ * Ray is an external ray of the set: the curve of points outside it
+ * that all have the same external Angle, from far out toward the set,
+ * as far in as it could be followed. Under z^d, an angle goes through
+ * Preperiod others before it comes back to itself every Period steps of
+ * multiplying it by d. A ray whose angle is rational lands on the set:
+ * at the root of a component of period Period if it's periodic, or at a
+ * Misiurewicz point otherwise, which is Landing if it was found.
+ */
+type Ray struct {
+	Angle     string       `json:"angle"`
+	Preperiod int          `json:"preperiod"`
+	Period    int          `json:"period"`
+	Points    []OrbitPoint `json:"points"`
+	Landing   *OrbitPoint  `json:"landing"`
+}
+
+/*
+ * rayContext is a Context for following points one at a time under a set
+ * of Parameters that have external rays: those that have nuclei, where
+ * z is raised to a whole power.
+ */
+func rayContext(p *Parameters) (*Context, StepFunc, error) {
+	c, step, err := nucleusContext(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d := c.degree(); d != math.Trunc(d) {
+		return nil, nil, fmt.Errorf("RenderFunc %#v has no external rays at power %v.", p.RenderFunc, d)
+	}
+	return c, step, nil
+}
+
+/*
+ * TraceRay follows the external ray of angle in turns from far out to
+ * depth iterations in, by Newton's method from each point to the next,
+ * and looks for where it lands. It stops with ctx's error if ctx is done
+ * first.
+ */
+func TraceRay(ctx context.Context, p *Parameters, angle *big.Rat, depth int) (*Ray, error) {
+	c, step, err := rayContext(p)
+	if err != nil {
+		return nil, err
+	}
+	if depth < 1 || depth > MaxRayDepth {
+		return nil, fmt.Errorf("Depth must be between 1 and %d.", MaxRayDepth)
+	}
+
+	// The angle of z(n) on the ray is the ray's angle multiplied by d
+	// n-1 times.
+	d := c.degree()
+	theta := turns(new(big.Rat).Set(angle))
+	angles := make([]float64, depth)
+	a, times := new(big.Rat).Set(theta), new(big.Rat).SetInt64(int64(d))
+	for k := range angles {
+		f, _ := a.Float64()
+		angles[k] = 2 * math.Pi * f
+		a = turns(a.Mul(a, times))
+	}
+
+	ray := &Ray{Angle: theta.RatString()}
+	ray.Preperiod, ray.Period = anglePeriod(theta, d)
+
+	// Each point is where z(n) reaches a radius that falls from R^d to R
+	// over raySharpness points per iteration, so that points further in
+	// have escaped more slowly.
+	z0 := cmplx.Rect(rayRadius, angles[0])
+	ray.Points = append(ray.Points, OrbitPoint(z0))
+	for m := 1; m < raySharpness*(depth-1); m++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n := (m+raySharpness-1)/raySharpness + 1
+		r := math.Pow(rayRadius, math.Pow(d, float64(n-1)-float64(m)/raySharpness))
+		target := cmplx.Rect(r, angles[n-1])
+
+		next, ok := newton(z0, func(c0 complex128) (complex128, complex128) {
+			z, dz := complex(0, 0), complex(0, 0)
+			for i := 0; i < n; i++ {
+				fz, dfz := step(c, z)
+				dz = dfz*dz + 1
+				z = fz + c0
+			}
+			return z - target, dz
+		})
+		if !ok {
+			break
+		}
+		z0 = next
+		ray.Points = append(ray.Points, OrbitPoint(z0))
+	}
+
+	if l, ok := ray.land(p); ok {
+		ray.Landing = &l
+	}
+	return ray, nil
+}
+
+/*
+ * newton finds a root of fn, which returns its value and derivative,
+ * starting from z. It reports whether it settled.
+ */
+func newton(z complex128, fn func(complex128) (complex128, complex128)) (complex128, bool) {
+	for n := 0; n < newtonSteps; n++ {
+		f, df := fn(z)
+		d := f / df
+		if !finite(real(d)) || !finite(imag(d)) {
+			return z, false
+		}
+		z -= d
+		if cmplx.Abs(d) <= newtonTolerance*math.Max(1, cmplx.Abs(z)) {
+			return z, true
+		}
+	}
+	f, df := fn(z)
+	return z, cmplx.Abs(f/df) <= newtonAccept*math.Max(1, cmplx.Abs(z))
+}
+
+/*
+ * anglePeriod is how many times an angle is multiplied by d before it
+ * comes back to one it's been, and how often it does from then on. It's
+ * zero and zero if that takes more than MaxNucleusPeriod steps.
+ */
+func anglePeriod(theta *big.Rat, d float64) (preperiod, period int) {
+	seen := map[string]int{}
+	a, times := new(big.Rat).Set(theta), new(big.Rat).SetInt64(int64(d))
+	for k := 0; k <= 2*MaxNucleusPeriod; k++ {
+		key := a.RatString()
+		if first, ok := seen[key]; ok {
+			if k-first > MaxNucleusPeriod {
+				return 0, 0
+			}
+			return first, k - first
+		}
+		seen[key] = k
+		a = turns(a.Mul(a, times))
+	}
+	return 0, 0
+}
+
+/*
+ * land finds where a traced ray lands: a root or Misiurewicz point that
+ * its last points are heading toward.
+ */
+func (self *Ray) land(p *Parameters) (OrbitPoint, bool) {
+	n := len(self.Points)
+	if self.Period == 0 || n < 2*raySharpness {
+		return 0, false
+	}
+	end := complex128(self.Points[n-1])
+	near := cmplx.Abs(end - complex128(self.Points[n/2]))
+
+	try := func(z complex128, err error) (OrbitPoint, bool) {
+		if err != nil || cmplx.Abs(z-end) > near {
+			return 0, false
+		}
+		return OrbitPoint(z), true
+	}
+
+	if self.Preperiod == 0 {
+		return try(FindRoot(p, end, self.Period))
+	}
+
+	// Rays landing together can have a period that's a multiple of the
+	// cycle they land on.
+	for q := 1; q <= self.Period; q++ {
+		if self.Period%q != 0 {
+			continue
+		}
+		if l, ok := try(FindMisiurewicz(p, end, self.Preperiod+1, q)); ok {
+			return l, true
+		}
+	}
+	return 0, false
+}
+
+/*
+ * FindRoot finds the root of the component of period period nearest to
+ * guess: the point where it meets its parent, or its cusp if it's a
+ * minibrot. It's found from the component's nucleus by moving its
+ * cycle's multiplier from zero to one.
+ */
+func FindRoot(p *Parameters, guess complex128, period int) (complex128, error) {
+	c, step, err := rayContext(p)
+	if err != nil {
+		return 0, err
+	}
+	n, err := FindNucleus(p, guess, period)
+	if err != nil {
+		return 0, err
+	}
+
+	// f'' of z^d from f', which rayContext makes sure it is.
+	d := c.degree()
+	second := func(z, dfz complex128) complex128 {
+		if z == 0 {
+			if d == 2 {
+				return 2
+			}
+			return 0
+		}
+		return complex(d-1, 0) * dfz / z
+	}
+
+	// Newton's method in both z and c on the cycle through z having
+	// multiplier w.
+	z, c0 := complex(0, 0), n.C
+	for k := 1; k <= rootSteps; k++ {
+		w := complex(float64(k)/rootSteps, 0)
+		settled := false
+		for it := 0; it < newtonSteps && !settled; it++ {
+			zz, a, b, az, ac := z, complex(1, 0), complex(0, 0), complex(0, 0), complex(0, 0)
+			for i := 0; i < period; i++ {
+				fz, dfz := step(c, zz)
+				d2 := second(zz, dfz)
+				az, ac = d2*a*a+dfz*az, d2*a*b+dfz*ac
+				a, b = dfz*a, dfz*b+1
+				zz = fz + c0
+			}
+
+			f, g := zz-z, a-w
+			det := (a-1)*ac - b*az
+			dz, dc := (f*ac-b*g)/det, ((a-1)*g-az*f)/det
+			if !finite(real(dz)) || !finite(imag(dz)) || !finite(real(dc)) || !finite(imag(dc)) {
+				return 0, fmt.Errorf("No root of period %d near %v.", period, guess)
+			}
+			z, c0 = z-dz, c0-dc
+			settled = cmplx.Abs(dc) <= newtonTolerance*math.Max(1, cmplx.Abs(c0))
+		}
+		if !settled && k == rootSteps {
+			return 0, fmt.Errorf("No root of period %d near %v.", period, guess)
+		}
+	}
+	return c0, nil
+}
+
+/*
+ * FindMisiurewicz finds the Misiurewicz point nearest to guess whose
+ * orbit from 0 falls after preperiod steps into a cycle of period
+ * period, by Newton's method on z(preperiod+period) - z(preperiod). It
+ * fails if Newton's method doesn't settle, or settles on a point with a
+ * shorter preperiod or period. The preperiod is at least 2; points with
+ * less are nuclei.
+ */
+func FindMisiurewicz(p *Parameters, guess complex128, preperiod, period int) (complex128, error) {
+	c, step, err := nucleusContext(p)
+	if err != nil {
+		return 0, err
+	}
+	if preperiod < 2 || period < 1 || preperiod+period > MaxNucleusPeriod {
+		return 0, fmt.Errorf("Preperiod must be at least 2 and period at least 1, with at most %d between them.", MaxNucleusPeriod)
+	}
+
+	return findMisiurewicz(c, step, guess, preperiod, period)
+}
+
+func findMisiurewicz(c *Context, step StepFunc, guess complex128, preperiod, period int) (complex128, error) {
+	orbit := func(c0 complex128) ([]complex128, []complex128) {
+		zs, dzs := make([]complex128, preperiod+period+1), make([]complex128, preperiod+period+1)
+		for i := 1; i < len(zs); i++ {
+			fz, dfz := step(c, zs[i-1])
+			zs[i], dzs[i] = fz+c0, dfz*dzs[i-1]+1
+		}
+		return zs, dzs
+	}
+
+	m, ok := newton(guess, func(c0 complex128) (complex128, complex128) {
+		zs, dzs := orbit(c0)
+		k := preperiod
+		return zs[k+period] - zs[k], dzs[k+period] - dzs[k]
+	})
+	if !ok {
+		return 0, fmt.Errorf("No Misiurewicz point of preperiod %d and period %d near %v.", preperiod, period, guess)
+	}
+
+	zs, _ := orbit(m)
+	tol := 1e-8 * math.Max(1, cmplx.Abs(zs[preperiod]))
+	if cmplx.Abs(zs[preperiod-1+period]-zs[preperiod-1]) <= tol {
+		return 0, fmt.Errorf("Misiurewicz point at %v has a preperiod less than %d.", m, preperiod)
+	}
+	for q := 1; q < period; q++ {
+		if period%q == 0 && cmplx.Abs(zs[preperiod+q]-zs[preperiod]) <= tol {
+			return 0, fmt.Errorf("Misiurewicz point at %v has period %d, not %d.", m, q, period)
+		}
+	}
+	return m, nil
+}
+
+/*
+ * FindMisiurewiczPoints finds the Misiurewicz points of a preperiod and
+ * period in the view of a set of Parameters, nearest its center first,
+ * by Newton's method from points spread over it. Like FindNuclei, it can
+ * miss some.
+ */
+func FindMisiurewiczPoints(ctx context.Context, p *Parameters, preperiod, period int) ([]complex128, error) {
+	c, step, err := nucleusContext(p)
+	if err != nil {
+		return nil, err
+	}
+	if preperiod < 2 || period < 1 || preperiod+period > MaxNucleusPeriod {
+		return nil, fmt.Errorf("Preperiod must be at least 2 and period at least 1, with at most %d between them.", MaxNucleusPeriod)
+	}
+
+	search := newViewSearch(p)
+	found := []complex128{}
+	for _, seed := range search.seeds() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		m, err := findMisiurewicz(c, step, seed, preperiod, period)
+		if err != nil || !search.fresh(m, found) {
+			continue
+		}
+		found = append(found, m)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return search.nearer(found[i], found[j])
+	})
+	return found, nil
+}
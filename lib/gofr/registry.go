@@ -0,0 +1,231 @@
+package gofr
+
+import (
+	"fmt"
+	"sync"
+)
+
+/*
+ * FuncParameter describes a field of Parameters that a registered
+ * RenderFunc or ColorFunc pays attention to, so that clients can build
+ * forms without hard-coding them.
+ */
+type FuncParameter struct {
+	Field       string  `json:"field"`
+	Type        string  `json:"type"`
+	Description string  `json:"description"`
+	Default     float64 `json:"default"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+}
+
+/*
+ * PowerRange is the inclusive range of Parameters.Power a RenderFunc
+ * supports. The zero value means the RenderFunc ignores Power.
+ */
+type PowerRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+/*
+ * Contains reports whether p is a supported power. A RenderFunc that
+ * ignores Power supports any value.
+ */
+func (self PowerRange) Contains(p int) bool {
+	if self.Min == 0 && self.Max == 0 {
+		return true
+	}
+	return p >= self.Min && p <= self.Max
+}
+
+/*
+ * RenderFuncInfo is a named RenderFunc and its metadata. Escape is the
+ * per-point iteration the RenderFunc uses, if it has one; renderers that
+ * sample points individually, like adaptive anti-aliasing, need it. Step
+ * is the map it iterates, if it has one, for following orbits.
+ */
+type RenderFuncInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  []FuncParameter `json:"parameters"`
+	Powers      PowerRange      `json:"powers"`
+	Func        RenderFunc      `json:"-"`
+	Escape      EscapeFunc      `json:"-"`
+	Step        StepFunc        `json:"-"`
+}
+
+/*
+ * ColorFuncInfo is a named ColorFunc and its metadata.
+ */
+type ColorFuncInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  []FuncParameter `json:"parameters"`
+	Func        ColorFunc       `json:"-"`
+}
+
+var registry = struct {
+	sync.RWMutex
+	renderNames []string
+	render      map[string]RenderFuncInfo
+	colorNames  []string
+	color       map[string]ColorFuncInfo
+}{
+	render: make(map[string]RenderFuncInfo),
+	color:  make(map[string]ColorFuncInfo),
+}
+
+/*
+ * RegisterRenderFunc makes a RenderFunc available by name to
+ * RenderFuncFromString and anything that lists RenderFuncs.
+ */
+func RegisterRenderFunc(info RenderFuncInfo) error {
+	if info.Name == "" {
+		return fmt.Errorf("RenderFunc must have a name.")
+	}
+	if info.Func == nil {
+		return fmt.Errorf("RenderFunc %#v has no Func.", info.Name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, exists := registry.render[info.Name]; exists {
+		return fmt.Errorf("RenderFunc %#v is already registered.", info.Name)
+	}
+	registry.render[info.Name] = info
+	registry.renderNames = append(registry.renderNames, info.Name)
+
+	return nil
+}
+
+/*
+ * RegisterColorFunc makes a ColorFunc available by name to
+ * ColorFuncFromString and anything that lists ColorFuncs.
+ */
+func RegisterColorFunc(info ColorFuncInfo) error {
+	if info.Name == "" {
+		return fmt.Errorf("ColorFunc must have a name.")
+	}
+	if info.Func == nil {
+		return fmt.Errorf("ColorFunc %#v has no Func.", info.Name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, exists := registry.color[info.Name]; exists {
+		return fmt.Errorf("ColorFunc %#v is already registered.", info.Name)
+	}
+	registry.color[info.Name] = info
+	registry.colorNames = append(registry.colorNames, info.Name)
+
+	return nil
+}
+
+/*
+ * LookupRenderFunc returns the registered RenderFunc with the given
+ * name.
+ */
+func LookupRenderFunc(name string) (RenderFuncInfo, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	info, ok := registry.render[name]
+	return info, ok
+}
+
+/*
+ * LookupColorFunc returns the registered ColorFunc with the given name.
+ */
+func LookupColorFunc(name string) (ColorFuncInfo, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	info, ok := registry.color[name]
+	return info, ok
+}
+
+/*
+ * RenderFuncs lists the registered RenderFuncs in registration order.
+ */
+func RenderFuncs() []RenderFuncInfo {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	infos := make([]RenderFuncInfo, 0, len(registry.renderNames))
+	for _, name := range registry.renderNames {
+		infos = append(infos, registry.render[name])
+	}
+	return infos
+}
+
+/*
+ * ColorFuncs lists the registered ColorFuncs in registration order.
+ */
+func ColorFuncs() []ColorFuncInfo {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	infos := make([]ColorFuncInfo, 0, len(registry.colorNames))
+	for _, name := range registry.colorNames {
+		infos = append(infos, registry.color[name])
+	}
+	return infos
+}
+
+var (
+	escapeParameters = []FuncParameter{
+		{Field: "MaxI", Type: "int", Description: "maximum iterations", Default: 1000, Min: 1, Max: MaxIterations},
+		{Field: "EscapeRadius", Type: "float", Description: "escape radius", Default: 4, Min: 2, Max: 1e100},
+	}
+	powerParameter    = FuncParameter{Field: "Power", Type: "int", Description: "exponent of z", Default: 2, Min: 2, Max: 32}
+	memberParameter   = FuncParameter{Field: "MemberColor", Type: "color", Description: "color of points in the set"}
+	exponentParameter = FuncParameter{Field: "Exponent", Type: "float", Description: "real exponent of z", Default: 2, Min: MinExponent, Max: MaxExponent}
+	offsetParameter   = FuncParameter{Field: "PaletteOffset", Type: "float", Description: "shift along the palette in iterations", Default: 0, Min: -1e6, Max: 1e6}
+)
+
+func init() {
+	powered := append(append([]FuncParameter{}, escapeParameters...), powerParameter)
+	exponent := append(append([]FuncParameter{}, escapeParameters...), exponentParameter)
+
+	renderFuncs := []RenderFuncInfo{
+		{Name: "mandelbrot", Description: "Multibrot set: z = z^p + c", Parameters: powered, Powers: PowerRange{2, 32}, Func: Mandelbrot, Escape: Escape, Step: Step},
+		{Name: "ebrot", Description: "z = z^(e+ei) + c", Parameters: escapeParameters, Func: Ebrot, Escape: EBrotEscape, Step: EBrotStep},
+		{Name: "multibrot", Description: "Multibrot set of any real power: z = z^e + c", Parameters: exponent, Func: Multibrot, Escape: MultibrotEscape, Step: MultibrotStep},
+		{Name: "experimental", Description: "whatever is being tinkered with", Parameters: powered, Powers: PowerRange{2, 32}, Func: Experimental, Escape: Escape, Step: Step},
+	}
+
+	smooth := []FuncParameter{memberParameter, powerParameter, offsetParameter}
+	plain := []FuncParameter{memberParameter}
+	banded := []FuncParameter{memberParameter, offsetParameter}
+
+	colorFuncs := []ColorFuncInfo{
+		{Name: "mono", Description: "alternating black and white bands", Parameters: plain, Func: ColorMono},
+		{Name: "check", Description: "black and white by the sign of the final phase", Parameters: plain, Func: ColorCheck},
+		{Name: "stripe", Description: "mono with an accent stripe every ninth band", Parameters: plain, Func: ColorMonoStripe},
+		{Name: "gray", Description: "logarithmic grayscale", Parameters: plain, Func: ColorGray},
+		{Name: "bands", Description: "rgb bands by iteration count", Parameters: banded, Func: ColorBands},
+		{Name: "smooth", Description: "continuous rgb gradient", Parameters: smooth, Func: ColorSmooth},
+		{Name: "parti", Description: "four colors by the quadrant of the final phase", Parameters: plain, Func: ColorParti},
+		{Name: "superparti", Description: "eight colors by the octant of the final phase", Parameters: plain, Func: ColorSuperParti},
+		{Name: "softspectrum", Description: "continuous hcl gradient", Parameters: smooth, Func: ColorSoftSpectrum},
+		{Name: "fire", Description: "continuous warm hcl gradient", Parameters: smooth, Func: ColorFire},
+		{Name: "ice", Description: "continuous cool hcl gradient", Parameters: smooth, Func: ColorIce},
+		{Name: "unicornrainbow", Description: "saturated hcl gradient with highlights", Parameters: smooth, Func: ColorUnicornRainbow},
+		{Name: "e1", Description: "experimental hcl gradient with dark bands", Parameters: smooth, Func: ColorExperiment1},
+	}
+
+	for _, info := range renderFuncs {
+		if err := RegisterRenderFunc(info); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, info := range colorFuncs {
+		if err := RegisterColorFunc(info); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -1,53 +1,116 @@
 package gofr
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
+	"time"
 )
 
-type RenderFunc func(*Context, chan bool) int
+/*
+ * RenderFunc renders the part of an image described by a Context. It
+ * should give up and return ctx.Err() as soon as it notices that ctx is
+ * done.
+ */
+type RenderFunc func(context.Context, *Context) error
+
+/*
+ * EscapeFunc iterates a single point for at most maxI iterations and
+ * returns how many it took to escape, or maxI, and the last z.
+ */
+type EscapeFunc func(c *Context, z complex128, maxI int) (int, complex128)
+
+/*
+ * StepFunc is the map a RenderFunc iterates, before the constant is
+ * added: it returns f(z) and its derivative f'(z), computed the same way
+ * the RenderFunc's EscapeFunc computes f(z).
+ */
+type StepFunc func(c *Context, z complex128) (fz, dfz complex128)
 
 func RenderFuncFromString(name string) (RenderFunc, error) {
-	switch name {
-	case "mandelbrot":
-		return Mandelbrot, nil
-	case "ebrot":
-		return Ebrot, nil
-	case "experimental":
-		return Experimental, nil
-	default:
+	info, ok := LookupRenderFunc(name)
+	if !ok {
 		return nil, fmt.Errorf("Invalid RenderFunc name: %#v", name)
 	}
+	return info.Func, nil
+}
+
+/*
+ * Render runs each context's RenderFunc on a pool of threads and waits
+ * for all of them to finish. The first error returned by a RenderFunc
+ * cancels the rest of the work and is returned.
+ */
+func Render(ctx context.Context, threads int, contexts []*Context) error {
+	return RenderProgress(ctx, threads, contexts, nil)
 }
 
-func Render(threads int, contexts []*Context, cancel chan bool) error {
-	count := len(contexts)
-	jobs := make(chan *Context, count)
-	results := make(chan int, count)
+/*
+ * RenderProgress is Render, reporting progress to fn every
+ * ProgressInterval and whenever a context finishes. fn may be nil.
+ */
+func RenderProgress(ctx context.Context, threads int, contexts []*Context, fn ProgressFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
+	if threads < 1 {
+		threads = 1
+	}
+
+	start := time.Now()
+	pixels := int64(0)
+	progress := Progress{Tiles: len(contexts)}
+
+	jobs := make(chan *Context, len(contexts))
+	for _, c := range contexts {
+		progress.Pixels += int64(c.Image.Bounds().Dx() * c.Image.Bounds().Dy())
+		c.pixelsDone = &pixels
+		jobs <- c
+	}
+	close(jobs)
+
+	results := make(chan error, len(contexts))
 	for i := 0; i < threads; i++ {
 		go func() {
 			for job := range jobs {
-				results <- job.RenderFunc(job, cancel)
+				results <- job.RenderFunc(ctx, job)
 			}
 		}()
 	}
 
-	for _, context := range contexts {
-		jobs <- context
+	var ticks <-chan time.Time
+	if fn != nil {
+		ticker := time.NewTicker(ProgressInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
 	}
-	close(jobs)
 
-	r := 0
-	for {
+	report := func() {
+		if fn == nil {
+			return
+		}
+		progress.PixelsDone = atomic.LoadInt64(&pixels)
+		progress.estimate(start)
+		fn(progress)
+	}
+
+	var err error
+	for finished := 0; finished < len(contexts); {
 		select {
-		case <-results:
-			r++
-			if r == count {
-				return nil
+		case r := <-results:
+			finished++
+			if r != nil {
+				if err == nil {
+					err = r
+					cancel()
+				}
+				continue
 			}
-		case <-cancel:
-			return fmt.Errorf("Render job cancelled.")
-		default:
+			progress.TilesDone++
+			report()
+		case <-ticks:
+			report()
 		}
 	}
+
+	return err
 }
@@ -0,0 +1,351 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+/*
+ * AreaMethod is how EstimateArea picks the points it iterates.
+ */
+type AreaMethod int
+
+const (
+	/*
+	 * AreaPixels iterates the center of every pixel of the ImageWidth by
+	 * ImageHeight render and counts those that are members. The area
+	 * lies somewhere between the members that have no neighbors outside
+	 * the set and the members plus the pixels next to them, and the
+	 * Error is the farther of those from the count.
+	 */
+	AreaPixels AreaMethod = iota
+
+	/*
+	 * AreaMonteCarlo iterates points picked at random all over the view.
+	 * Its Error is twice the standard error of the estimate, so the area
+	 * is within it about 95% of the time.
+	 */
+	AreaMonteCarlo
+)
+
+/*
+ * AreaMethods are the names of the AreaMethods that AreaMethodFromString
+ * knows.
+ */
+var AreaMethods = map[string]AreaMethod{
+	"pixels":     AreaPixels,
+	"montecarlo": AreaMonteCarlo,
+}
+
+/*
+ * AreaMethodFromString looks up one of AreaMethods by name.
+ */
+func AreaMethodFromString(name string) (AreaMethod, error) {
+	if m, ok := AreaMethods[name]; ok {
+		return m, nil
+	}
+
+	names := []string{}
+	for n := range AreaMethods {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return AreaPixels, fmt.Errorf("Invalid area method name: %#v, expected one of %v", name, names)
+}
+
+func (self AreaMethod) String() string {
+	for name, m := range AreaMethods {
+		if m == self {
+			return name
+		}
+	}
+	return fmt.Sprintf("AreaMethod(%d)", int(self))
+}
+
+const (
+	/*
+	 * MaxHistogramBins is the most bins the histogram of an
+	 * AreaEstimate has.
+	 */
+	MaxHistogramBins = 1024
+
+	/*
+	 * monteCarloChunk is how many random points each of the streams
+	 * AreaMonteCarlo draws from makes, so that the points are the same
+	 * however many threads there are.
+	 */
+	monteCarloChunk = 4096
+)
+
+/*
+ * AreaEstimation estimates the area of the part of the set in the view
+ * of Parameters by Method, with Samples random points for
+ * AreaMonteCarlo, drawn from Seed. With Shortcuts, points that are known
+ * to be inside the main cardioid or period 2 bulb of the Mandelbrot set
+ * aren't iterated. The escape times of the points that escape are put
+ * in Bins bins of a histogram.
+ *
+ * Points that don't escape by MaxI count as members, so the area is
+ * overestimated by however many of them escape later; the Error doesn't
+ * take that into account.
+ */
+type AreaEstimation struct {
+	Parameters Parameters
+	Method     AreaMethod
+	Samples    int
+	Seed       int64
+	Shortcuts  bool
+	Bins       int
+}
+
+/*
+ * Validate returns an error if an AreaEstimation can't be made.
+ */
+func (self *AreaEstimation) Validate() error {
+	if self.Method < AreaPixels || self.Method > AreaMonteCarlo {
+		return fmt.Errorf("Invalid area method: %v", self.Method)
+	}
+	if self.Method == AreaMonteCarlo && self.Samples < 1 {
+		return fmt.Errorf("An estimate by Monte Carlo needs at least one sample: %d", self.Samples)
+	}
+	if self.Bins < 1 || self.Bins > MaxHistogramBins {
+		return fmt.Errorf("Invalid number of histogram bins: %d, expected 1 to %d", self.Bins, MaxHistogramBins)
+	}
+	info, ok := LookupRenderFunc(self.Parameters.RenderFunc)
+	if !ok {
+		return fmt.Errorf("Invalid RenderFunc: %#v", self.Parameters.RenderFunc)
+	}
+	if info.Escape == nil {
+		return fmt.Errorf("RenderFunc %#v can't iterate single points.", self.Parameters.RenderFunc)
+	}
+	return self.Parameters.Validate()
+}
+
+/*
+ * AreaEstimate is how big the part of the set in a view is, give or
+ * take Error, out of the ViewArea of the whole view.
+ *
+ * Of the Points iterated, Members didn't escape, and Shortcuts of those
+ * were known to be members without being iterated. For AreaPixels,
+ * Boundary is how many pixels have a neighbor on the other side of the
+ * set's boundary. Escaped points took MeanEscape iterations on average
+ * and MaxEscape at most, and Histogram counts them by how many they
+ * took, each of its bins covering an equal share of iterations up to
+ * MaxI.
+ */
+type AreaEstimate struct {
+	Method     string  `json:"method"`
+	Area       float64 `json:"area"`
+	Error      float64 `json:"error"`
+	ViewArea   float64 `json:"view_area"`
+	Points     int     `json:"points"`
+	Members    int     `json:"members"`
+	Shortcuts  int     `json:"shortcuts"`
+	Boundary   int     `json:"boundary"`
+	Escaped    int     `json:"escaped"`
+	MeanEscape float64 `json:"mean_escape"`
+	MaxEscape  int     `json:"max_escape"`
+	Histogram  []int   `json:"histogram"`
+}
+
+/*
+ * shortcut is an iteration count that marks a point known to be a member
+ * without iterating it.
+ */
+const shortcut = -1
+
+/*
+ * interior reports whether c is in the main cardioid or period 2 bulb
+ * of the Mandelbrot set, where most of its area is.
+ */
+func interior(c complex128) bool {
+	x, y := real(c), imag(c)
+	if (x+1)*(x+1)+y*y <= 1.0/16 {
+		return true
+	}
+	q := (x-0.25)*(x-0.25) + y*y
+	return q*(q+x-0.25) <= y*y/4
+}
+
+/*
+ * tally adds up the iteration counts of the Points of an AreaEstimate.
+ */
+func (self *AreaEstimate) tally(counts []int, maxI int) {
+	sum := 0
+	for _, i := range counts {
+		switch {
+		case i == shortcut:
+			self.Members++
+			self.Shortcuts++
+		case i >= maxI:
+			self.Members++
+		default:
+			self.Escaped++
+			sum += i
+			if i > self.MaxEscape {
+				self.MaxEscape = i
+			}
+			self.Histogram[i*len(self.Histogram)/maxI]++
+		}
+	}
+	self.Points = len(counts)
+	if self.Escaped > 0 {
+		self.MeanEscape = float64(sum) / float64(self.Escaped)
+	}
+}
+
+/*
+ * EstimateArea makes an AreaEstimation with up to threads goroutines,
+ * reporting the progress of AreaPixels to fn, which may be nil.
+ */
+func EstimateArea(ctx context.Context, e *AreaEstimation, threads int, fn ProgressFunc) (*AreaEstimate, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := e.Parameters
+	info, _ := LookupRenderFunc(p.RenderFunc)
+
+	// The known interior is only that of z^2 + c.
+	shortcuts := e.Shortcuts && info.Name == "mandelbrot" && !p.Julia && (p.Power == 2 || p.Power == 0)
+	escape := func(c *Context, z complex128) int {
+		if shortcuts && interior(z) {
+			return shortcut
+		}
+		i, _ := info.Escape(c, z, c.MaxI)
+		return i
+	}
+
+	t := p.Transform()
+	o := t.PixelToPoint(0, 0)
+	dx, dy := t.PixelToPoint(1, 0)-o, t.PixelToPoint(0, 1)-o
+	pixel := math.Abs(real(dx)*imag(dy) - imag(dx)*real(dy))
+
+	estimate := &AreaEstimate{
+		Method:    e.Method.String(),
+		ViewArea:  pixel * float64(p.ImageWidth) * float64(p.ImageHeight),
+		Histogram: make([]int, e.Bins),
+	}
+
+	if e.Method == AreaMonteCarlo {
+		counts, err := monteCarloCounts(ctx, &p, e.Samples, e.Seed, threads, escape)
+		if err != nil {
+			return nil, err
+		}
+		estimate.tally(counts, p.MaxI)
+
+		f := float64(estimate.Members) / float64(estimate.Points)
+		estimate.Area = f * estimate.ViewArea
+		estimate.Error = 2 * math.Sqrt(f*(1-f)/float64(estimate.Points)) * estimate.ViewArea
+		return estimate, nil
+	}
+
+	w, h := p.ImageWidth, p.ImageHeight
+	img := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	contexts, err := MakeContexts(img, gridSize(threads, img.Bounds()), &p)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int, w*h)
+	for _, c := range contexts {
+		c.RenderFunc = func(ctx context.Context, c *Context) error {
+			return c.EachPoint(ctx, func(x, y int, z complex128) {
+				counts[y*w+x] = escape(c, z)
+			})
+		}
+	}
+	if err := RenderProgress(ctx, threads, contexts, fn); err != nil {
+		return nil, err
+	}
+	estimate.tally(counts, p.MaxI)
+
+	// Pixels on either side of the boundary could be either.
+	member := func(x, y int) bool {
+		i := counts[y*w+x]
+		return i == shortcut || i >= p.MaxI
+	}
+	inner, outer := 0, 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m := member(x, y)
+			if (x > 0 && member(x-1, y) != m) || (x+1 < w && member(x+1, y) != m) ||
+				(y > 0 && member(x, y-1) != m) || (y+1 < h && member(x, y+1) != m) {
+				if m {
+					inner++
+				} else {
+					outer++
+				}
+			}
+		}
+	}
+
+	estimate.Boundary = inner + outer
+	estimate.Area = float64(estimate.Members) * pixel
+	estimate.Error = math.Max(float64(inner), float64(outer)) * pixel
+	return estimate, nil
+}
+
+/*
+ * monteCarloCounts are the iteration counts of samples points picked at
+ * random over the view of a set of Parameters, in chunks that each have
+ * their own stream of random numbers.
+ */
+func monteCarloCounts(ctx context.Context, p *Parameters, samples int, seed int64, threads int, escape func(*Context, complex128) int) ([]int, error) {
+	if threads < 1 {
+		threads = 1
+	}
+
+	c, err := pointContext(p)
+	if err != nil {
+		return nil, err
+	}
+	t := p.Transform()
+	w, h := float64(p.ImageWidth), float64(p.ImageHeight)
+
+	counts := make([]int, samples)
+	chunks := make(chan int, (samples+monteCarloChunk-1)/monteCarloChunk)
+	for start := 0; start < samples; start += monteCarloChunk {
+		chunks <- start
+	}
+	close(chunks)
+
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range chunks {
+				if ctx.Err() != nil {
+					return
+				}
+				r := rand.New(rand.NewSource(seed + int64(start/monteCarloChunk)))
+				for n := start; n < samples && n < start+monteCarloChunk; n++ {
+					counts[n] = escape(c, t.PixelToPoint(r.Float64()*w, r.Float64()*h))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return counts, ctx.Err()
+}
+
+/*
+ * pointContext is a Context of a single pixel for iterating points one
+ * at a time under a set of Parameters. Nothing is drawn on it, so it can
+ * be shared.
+ */
+func pointContext(p *Parameters) (*Context, error) {
+	img := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	cs, err := MakeContexts(img, 1, p)
+	if err != nil {
+		return nil, err
+	}
+	return cs[0], nil
+}
@@ -0,0 +1,84 @@
+package gofr
+
+import (
+	"fmt"
+)
+
+/*
+ * TileSize is the width and height in pixels of a Tile.
+ */
+const TileSize = 256
+
+/*
+ * MaxTileZoom is the deepest zoom level of Tiles. Deeper than this, the
+ * pixels of a tile are too close together to tell apart in a float64.
+ */
+const MaxTileZoom = 40
+
+/*
+ * Tile is a tile in the XYZ scheme that slippy map viewers use. At zoom
+ * level Z there are 2^Z by 2^Z tiles, numbered from the top left.
+ */
+type Tile struct {
+	Z, X, Y int
+}
+
+/*
+ * Validate returns an error if a Tile doesn't exist.
+ */
+func (self Tile) Validate() error {
+	if self.Z < 0 || self.Z > MaxTileZoom {
+		return fmt.Errorf("Tile zoom must be between 0 and %d: %d", MaxTileZoom, self.Z)
+	}
+
+	n := 1 << uint(self.Z)
+	if self.X < 0 || self.X >= n || self.Y < 0 || self.Y >= n {
+		return fmt.Errorf("Tile %d/%d is outside of zoom level %d.", self.X, self.Y, self.Z)
+	}
+
+	return nil
+}
+
+/*
+ * Bounds maps a Tile onto the complex plane. The single tile at zoom
+ * level 0 is a square span wide centered on origin, and every tile
+ * below it is a quarter of its parent. Rows run down from the top, as
+ * they do in a render, so row 0 is at the largest imaginary values.
+ */
+func (self Tile) Bounds(origin complex128, span float64) (min, max complex128) {
+	size := span / float64(uint64(1)<<uint(self.Z))
+	corner := origin + complex(-span/2, span/2)
+
+	min = corner + complex(float64(self.X)*size, -float64(self.Y+1)*size)
+	max = corner + complex(float64(self.X+1)*size, -float64(self.Y)*size)
+	return
+}
+
+/*
+ * TileParameters are a set of Parameters for rendering a Tile. Bounds and
+ * sizes come from the Tile; everything else comes from p. Tiles of a
+ * turned or transformed p are turned and transformed about origin, so
+ * that they still fit together. Tiles leave out the Overlay, which is
+ * laid out for a whole image.
+ */
+func TileParameters(p Parameters, tile Tile, origin complex128, span float64) (Parameters, error) {
+	if err := tile.Validate(); err != nil {
+		return p, err
+	}
+
+	s := p.Scaling
+	if s < 1 {
+		s = 1
+	}
+
+	min, max := tile.Bounds(origin, span)
+	p.Min, p.Max = p.crop(origin, min, max)
+	p.Width = TileSize
+	p.Height = TileSize
+	p.ImageWidth = TileSize * s
+	p.ImageHeight = TileSize * s
+	p.Scaling = s
+	p.Overlay = Overlay{}
+
+	return p, p.Validate()
+}
@@ -0,0 +1,91 @@
+package gofr
+
+/*
+ * Transform maps between the pixels of a render and the complex plane.
+ * Pixel coordinates are continuous: pixel x, y covers the square from x
+ * to x+1 and y to y+1, and is sampled at its center, x+0.5, y+0.5. Rows
+ * run down from imag(Max) at the top to imag(Min) at the bottom, the
+ * way the plane is drawn in math, and columns run across from real(Min)
+ * to real(Max). Angle and Affine then turn and transform the view about
+ * its center.
+ *
+ * Everything that places pixels on the plane, or the plane on pixels,
+ * should go through a Transform so that they all agree.
+ */
+type Transform struct {
+	origin complex128
+	u, v   complex128
+}
+
+/*
+ * NewTransform is the Transform of a width by height pixel render of
+ * min to max, turned by angle and transformed by affine, if it's set.
+ */
+func NewTransform(min, max complex128, width, height int, angle float64, affine *Affine) Transform {
+	dx := (real(max) - real(min)) / float64(width)
+	dy := (imag(max) - imag(min)) / float64(height)
+	c := (min + max) / 2
+
+	// The map is affine, so it's where the origin goes and where a step
+	// along each axis goes.
+	at := func(x, y float64) complex128 {
+		z := complex(real(min)+x*dx, imag(max)-y*dy)
+		return c + linear(z-c, angle, affine)
+	}
+
+	o := at(0, 0)
+	return Transform{
+		origin: o,
+		u:      at(1, 0) - o,
+		v:      at(0, 1) - o,
+	}
+}
+
+/*
+ * Transform is the Transform of the full ImageWidth by ImageHeight render
+ * of a set of Parameters.
+ */
+func (self *Parameters) Transform() Transform {
+	return NewTransform(self.Min, self.Max, self.ImageWidth, self.ImageHeight, self.Angle, self.Affine)
+}
+
+/*
+ * Transform is the Transform of the full ImageWidth by ImageHeight render
+ * that a Context is part of.
+ */
+func (self *Context) Transform() Transform {
+	return NewTransform(self.Min, self.Max, self.ImageWidth, self.ImageHeight, self.Angle, self.Affine)
+}
+
+/*
+ * PixelToPoint maps a position in pixel coordinates onto the complex
+ * plane.
+ */
+func (self Transform) PixelToPoint(x, y float64) complex128 {
+	return complex(
+		real(self.origin)+x*real(self.u)+y*real(self.v),
+		imag(self.origin)+x*imag(self.u)+y*imag(self.v),
+	)
+}
+
+/*
+ * PointToPixel maps a point on the complex plane back to pixel
+ * coordinates.
+ */
+func (self Transform) PointToPixel(z complex128) (x, y float64) {
+	w := z - self.origin
+	d := real(self.u)*imag(self.v) - real(self.v)*imag(self.u)
+	x = (real(w)*imag(self.v) - imag(w)*real(self.v)) / d
+	y = (imag(w)*real(self.u) - real(w)*imag(self.u)) / d
+	return
+}
+
+/*
+ * Direction is how far, in pixels, the step from a to b on the plane
+ * moves across the image.
+ */
+func (self Transform) Direction(a, b complex128) (dx, dy float64) {
+	ax, ay := self.PointToPixel(a)
+	bx, by := self.PointToPixel(b)
+	return bx - ax, by - ay
+}
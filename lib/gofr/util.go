@@ -6,6 +6,8 @@ import (
 	"log"
 	"math"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
 func Round(x, unit float64) float64 {
@@ -26,6 +28,31 @@ func PrintByteSize(s uint64) string {
 	return fmt.Sprintf("%10.4f %s", t, u)
 }
 
+/*
+ * ParseByteSize is the inverse of PrintByteSize: it reads a size like
+ * "512M" or "2G" in powers of 1024. A bare number is in bytes.
+ */
+func ParseByteSize(s string) (uint64, error) {
+	key := "BKMGTPEZY"
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+
+	l := 0
+	if n := len(t); n > 0 {
+		if i := strings.IndexByte(key, t[n-1]); i >= 0 {
+			l = i
+			t = strings.TrimSpace(t[:n-1])
+		}
+	}
+
+	f, err := strconv.ParseFloat(t, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("Invalid byte size: %#v", s)
+	}
+
+	return uint64(f * math.Pow(1024.0, float64(l))), nil
+}
+
 func logMemStats(l *log.Logger) {
 	stats := runtime.MemStats{}
 	runtime.ReadMemStats(&stats)
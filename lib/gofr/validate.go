@@ -0,0 +1,236 @@
+package gofr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+ * MaxIterations is the largest MaxI that Validate accepts.
+ */
+const MaxIterations = 10000000
+
+/*
+ * MinExponent and MaxExponent bound Parameters.Exponent for RenderFuncs
+ * that use it.
+ */
+const (
+	MinExponent = 1.1
+	MaxExponent = 32
+)
+
+/*
+ * FieldError describes what is wrong with one field of Parameters.
+ * Complex fields are reported by part, e.g. "real(Min)".
+ */
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (self FieldError) Error() string {
+	return fmt.Sprintf("%s %s", self.Field, self.Message)
+}
+
+/*
+ * ValidationError is every FieldError found in a set of Parameters.
+ */
+type ValidationError []FieldError
+
+func (self ValidationError) Error() string {
+	messages := make([]string, len(self))
+	for i, e := range self {
+		messages[i] = e.Error()
+	}
+	return "Invalid parameters: " + strings.Join(messages, "; ")
+}
+
+func (self *ValidationError) add(field, format string, args ...interface{}) {
+	*self = append(*self, FieldError{field, fmt.Sprintf(format, args...)})
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+/*
+ * Validate checks that a set of Parameters describes something that can
+ * be rendered. It returns a ValidationError listing every problem, or
+ * nil.
+ */
+func (self *Parameters) Validate() error {
+	var errs ValidationError
+
+	if self.Width == 0 {
+		errs.add("Width", "must be greater than zero")
+	}
+	if self.Height == 0 {
+		errs.add("Height", "must be greater than zero")
+	}
+	if self.ImageWidth <= 0 {
+		errs.add("ImageWidth", "must be greater than zero")
+	}
+	if self.ImageHeight <= 0 {
+		errs.add("ImageHeight", "must be greater than zero")
+	}
+	if self.Scaling < 0 {
+		errs.add("Scaling", "must not be negative")
+	} else if self.Scaling > 0 && (self.ImageWidth != int(self.Width)*self.Scaling || self.ImageHeight != int(self.Height)*self.Scaling) {
+		errs.add("Scaling", "must be the ratio of ImageWidth and ImageHeight to Width and Height")
+	}
+
+	bounds := []struct {
+		name  string
+		value float64
+	}{
+		{"real(Min)", real(self.Min)},
+		{"imag(Min)", imag(self.Min)},
+		{"real(Max)", real(self.Max)},
+		{"imag(Max)", imag(self.Max)},
+	}
+	inBounds := true
+	for _, b := range bounds {
+		if !finite(b.value) {
+			errs.add(b.name, "must be finite")
+			inBounds = false
+		}
+	}
+	if inBounds {
+		if real(self.Max) <= real(self.Min) {
+			errs.add("real(Max)", "must be greater than real(Min)")
+		}
+		if imag(self.Max) <= imag(self.Min) {
+			errs.add("imag(Max)", "must be greater than imag(Min)")
+		}
+	}
+
+	if !finite(self.EscapeRadius) || self.EscapeRadius < 2 {
+		errs.add("EscapeRadius", "must be a finite number no less than 2")
+	}
+
+	if self.MaxI <= 0 || self.MaxI > MaxIterations {
+		errs.add("MaxI", "must be between 1 and %d", MaxIterations)
+	}
+
+	if _, err := MemberColorFromString(self.MemberColor); err != nil {
+		errs.add("MemberColor", "must be a color like #rrggbb")
+	}
+
+	if _, ok := LookupColorFunc(self.ColorFunc); !ok {
+		errs.add("ColorFunc", "%#v is not a registered ColorFunc", self.ColorFunc)
+	}
+
+	// Zero is the RenderFuncs' default power of 2, as Escape treats it.
+	power := self.Power
+	if power == 0 {
+		power = 2
+	}
+	if info, ok := LookupRenderFunc(self.RenderFunc); !ok {
+		errs.add("RenderFunc", "%#v is not a registered RenderFunc", self.RenderFunc)
+	} else if !info.Powers.Contains(power) {
+		errs.add("Power", "must be between %d and %d for %s", info.Powers.Min, info.Powers.Max, info.Name)
+	}
+
+	if info, ok := LookupRenderFunc(self.RenderFunc); ok {
+		uses := false
+		for _, fp := range info.Parameters {
+			uses = uses || fp.Field == "Exponent"
+		}
+		switch {
+		case !uses && self.Exponent != 0:
+			errs.add("Exponent", "isn't used by %s", info.Name)
+		case self.Exponent != 0 && !(self.Exponent >= MinExponent && self.Exponent <= MaxExponent):
+			errs.add("Exponent", "must be between %g and %g", float64(MinExponent), float64(MaxExponent))
+		}
+	}
+
+	if !finite(real(self.Seed)) {
+		errs.add("real(Seed)", "must be finite")
+	}
+	if !finite(imag(self.Seed)) {
+		errs.add("imag(Seed)", "must be finite")
+	}
+	if !finite(self.PaletteOffset) {
+		errs.add("PaletteOffset", "must be finite")
+	}
+	if !finite(self.Angle) {
+		errs.add("Angle", "must be finite")
+	}
+	if a := self.Affine; a != nil {
+		d := a.Determinant()
+		if !finite(d) || !finite(real(a.Offset)) || !finite(imag(a.Offset)) {
+			errs.add("Affine", "must be finite")
+		} else if d == 0 {
+			errs.add("Affine", "must be invertible")
+		}
+	}
+
+	if _, _, err := overlayColor(self.Overlay.Color); err != nil {
+		errs.add("Overlay.Color", "must be empty or a color like #rrggbb or #rrggbbaa")
+	}
+	if _, _, err := overlayColor(self.Overlay.GridColor); err != nil {
+		errs.add("Overlay.GridColor", "must be empty or a color like #rrggbb or #rrggbbaa")
+	}
+	if !finite(self.Overlay.Spacing) || self.Overlay.Spacing < 0 {
+		errs.add("Overlay.Spacing", "must be a finite number no less than 0")
+	}
+	if !finite(real(self.Overlay.OrbitAt)) {
+		errs.add("real(Overlay.OrbitAt)", "must be finite")
+	}
+	if !finite(imag(self.Overlay.OrbitAt)) {
+		errs.add("imag(Overlay.OrbitAt)", "must be finite")
+	}
+	if info, ok := LookupRenderFunc(self.RenderFunc); ok && self.Overlay.Orbit && info.Step == nil {
+		errs.add("Overlay.Orbit", "isn't supported by %s", info.Name)
+	}
+	if !finite(self.Overlay.EquipotentialSpacing) || self.Overlay.EquipotentialSpacing < 0 {
+		errs.add("Overlay.EquipotentialSpacing", "must be a finite number no less than 0")
+	}
+	if info, ok := LookupRenderFunc(self.RenderFunc); ok && info.Step == nil {
+		if self.Overlay.Equipotentials {
+			errs.add("Overlay.Equipotentials", "aren't supported by %s", info.Name)
+		}
+		if self.Overlay.FieldLines {
+			errs.add("Overlay.FieldLines", "aren't supported by %s", info.Name)
+		}
+	}
+	for _, s := range self.Overlay.Rays {
+		if _, err := ParseAngle(s); err != nil {
+			errs.add("Overlay.Rays", "must be angles like 1/3 or 0.(01)")
+			break
+		}
+	}
+	if len(self.Overlay.Rays) > 0 {
+		if info, ok := LookupRenderFunc(self.RenderFunc); ok && info.Step == nil {
+			errs.add("Overlay.Rays", "aren't supported by %s", info.Name)
+		} else if self.Julia {
+			errs.add("Overlay.Rays", "aren't supported for Julia sets")
+		} else if self.Exponent != math.Trunc(self.Exponent) {
+			errs.add("Overlay.Rays", "need a whole exponent")
+		}
+	}
+
+	if self.AdaptiveSamples < 0 || self.AdaptiveSamples > MaxAdaptiveSamples {
+		errs.add("AdaptiveSamples", "must be between 0 and %d", MaxAdaptiveSamples)
+	}
+	if !finite(self.AdaptiveThreshold) || self.AdaptiveThreshold < 0 || self.AdaptiveThreshold > 1 {
+		errs.add("AdaptiveThreshold", "must be between 0 and 1")
+	}
+	if self.AdaptiveIterations < 0 {
+		errs.add("AdaptiveIterations", "must not be negative")
+	}
+	if self.AdaptiveSamples > 0 {
+		if self.ImageWidth != int(self.Width) || self.ImageHeight != int(self.Height) {
+			errs.add("Scaling", "must be 1 with adaptive anti-aliasing")
+		}
+		if info, ok := LookupRenderFunc(self.RenderFunc); ok && info.Escape == nil {
+			errs.add("AdaptiveSamples", "isn't supported by %s", info.Name)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
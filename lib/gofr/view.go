@@ -0,0 +1,285 @@
+package gofr
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+/*
+ * Affine is a linear map of the complex plane followed by a translation:
+ * a point re+im*i goes to (XX*re + XY*im) + (YX*re + YY*im)*i + Offset.
+ * It can stretch, shear or mirror a view as well as rotate it.
+ */
+type Affine struct {
+	XX, XY float64
+	YX, YY float64
+	Offset complex128
+}
+
+/*
+ * Apply maps z.
+ */
+func (self Affine) Apply(z complex128) complex128 {
+	re, im := real(z), imag(z)
+	return complex(self.XX*re+self.XY*im, self.YX*re+self.YY*im) + self.Offset
+}
+
+/*
+ * Determinant is how much an Affine scales areas by, negative if it
+ * mirrors them. Zero means it can't be inverted.
+ */
+func (self Affine) Determinant() float64 {
+	return self.XX*self.YY - self.XY*self.YX
+}
+
+/*
+ * Inverse undoes an Affine. It must have a non-zero Determinant.
+ */
+func (self Affine) Inverse() Affine {
+	d := self.Determinant()
+	inv := Affine{
+		XX: self.YY / d,
+		XY: -self.XY / d,
+		YX: -self.YX / d,
+		YY: self.XX / d,
+	}
+	inv.Offset = -inv.Apply(self.Offset)
+	return inv
+}
+
+/*
+ * ViewSpan is how much of the complex plane a View at magnification 1
+ * shows across the image: across its shorter side if it fits the image,
+ * and across its longer side if it fills it.
+ */
+const ViewSpan = 4.0
+
+/*
+ * Aspect is how a View is fitted to an image that isn't square.
+ */
+type Aspect int
+
+const (
+	/*
+	 * AspectFit shows all of the view, and more of the plane along the
+	 * longer side of the image.
+	 */
+	AspectFit Aspect = iota
+
+	/*
+	 * AspectFill fills the image with the view, cutting off some of it
+	 * along the shorter side of the image.
+	 */
+	AspectFill
+
+	/*
+	 * AspectStretch squashes the view to the shape of the image, so that
+	 * pixels aren't square.
+	 */
+	AspectStretch
+)
+
+/*
+ * Aspects are the names of the Aspects that AspectFromString knows.
+ */
+var Aspects = map[string]Aspect{
+	"fit":     AspectFit,
+	"fill":    AspectFill,
+	"stretch": AspectStretch,
+}
+
+/*
+ * AspectFromString looks up one of Aspects by name.
+ */
+func AspectFromString(name string) (Aspect, error) {
+	if a, ok := Aspects[name]; ok {
+		return a, nil
+	}
+
+	names := []string{}
+	for n := range Aspects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return AspectFit, fmt.Errorf("Invalid aspect name: %#v, expected one of %v", name, names)
+}
+
+func (self Aspect) String() string {
+	for name, a := range Aspects {
+		if a == self {
+			return name
+		}
+	}
+	return fmt.Sprintf("Aspect(%d)", int(self))
+}
+
+/*
+ * View places an image on the complex plane by its center, how far in
+ * it's zoomed, how far it's turned anticlockwise in radians and how it's
+ * fitted to the shape of the image, rather than by its corners.
+ */
+type View struct {
+	Center        complex128
+	Magnification float64
+	Angle         float64
+	Aspect        Aspect
+}
+
+/*
+ * Validate returns a ValidationError if a View can't be rendered.
+ */
+func (self View) Validate() error {
+	var errs ValidationError
+
+	if !finite(real(self.Center)) {
+		errs.add("real(Center)", "must be finite")
+	}
+	if !finite(imag(self.Center)) {
+		errs.add("imag(Center)", "must be finite")
+	}
+	if !finite(self.Magnification) || self.Magnification <= 0 {
+		errs.add("Magnification", "must be a finite number greater than zero")
+	}
+	if !finite(self.Angle) {
+		errs.add("Angle", "must be finite")
+	}
+	if self.Aspect < AspectFit || self.Aspect > AspectStretch {
+		errs.add("Aspect", "must be fit, fill or stretch")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+/*
+ * Corners are the corners of the unturned view at width by height.
+ */
+func (self View) Corners(width, height uint) (min, max complex128) {
+	w, h := float64(width), float64(height)
+	span := ViewSpan / self.Magnification
+
+	var half complex128
+	switch self.Aspect {
+	case AspectFill:
+		unit := span / math.Max(w, h)
+		half = complex(w*unit/2, h*unit/2)
+	case AspectStretch:
+		half = complex(span/2, span/2)
+	default:
+		unit := span / math.Min(w, h)
+		half = complex(w*unit/2, h*unit/2)
+	}
+
+	return self.Center - half, self.Center + half
+}
+
+/*
+ * ViewOfCorners is the View centered on min to max that, at width by
+ * height, shows all of it if aspect is AspectFit, or fills the image
+ * with it if aspect is AspectFill. A stretched View is square on the
+ * plane, so it covers min to max, but only shows exactly that when min
+ * to max is square too.
+ */
+func ViewOfCorners(min, max complex128, width, height uint, aspect Aspect) View {
+	w, h := float64(width), float64(height)
+	size := max - min
+
+	var mag float64
+	switch aspect {
+	case AspectFill:
+		mag = ViewSpan / (math.Min(real(size)/w, imag(size)/h) * math.Max(w, h))
+	case AspectStretch:
+		mag = ViewSpan / math.Max(real(size), imag(size))
+	default:
+		mag = ViewSpan / (math.Max(real(size)/w, imag(size)/h) * math.Min(w, h))
+	}
+
+	return View{Center: (min + max) / 2, Magnification: mag, Aspect: aspect}
+}
+
+/*
+ * SetView sets Min, Max and Angle to show a View at Width by Height.
+ */
+func (self *Parameters) SetView(v View) {
+	self.Min, self.Max = v.Corners(self.Width, self.Height)
+	self.Angle = v.Angle
+}
+
+/*
+ * View is the View that fits Min to Max into Width by Height, turned by
+ * Angle.
+ */
+func (self *Parameters) View() View {
+	v := ViewOfCorners(self.Min, self.Max, self.Width, self.Height, AspectFit)
+	v.Angle = self.Angle
+	return v
+}
+
+/*
+ * CorrectAspect widens or narrows Min to Max about its center so that
+ * pixels are square: to show all of it with AspectFit, or to fill the
+ * image with it with AspectFill. AspectStretch leaves it alone.
+ */
+func (self *Parameters) CorrectAspect(aspect Aspect) {
+	if aspect == AspectStretch {
+		return
+	}
+	v := ViewOfCorners(self.Min, self.Max, self.Width, self.Height, aspect)
+	self.Min, self.Max = v.Corners(self.Width, self.Height)
+}
+
+/*
+ * SquarePixels reports whether the pixels of a render are square on the
+ * complex plane, to within rounding.
+ */
+func (self *Parameters) SquarePixels() bool {
+	dx := real(self.Max-self.Min) / float64(self.ImageWidth)
+	dy := imag(self.Max-self.Min) / float64(self.ImageHeight)
+	return math.Abs(dx-dy) <= 1e-9*math.Max(math.Abs(dx), math.Abs(dy))
+}
+
+/*
+ * linear applies the rotation and Affine of a view to w, a point
+ * relative to the center of its Min to Max rectangle.
+ */
+func linear(w complex128, angle float64, a *Affine) complex128 {
+	if a != nil {
+		w = a.Apply(w)
+	}
+	if angle != 0 {
+		w *= cmplx.Rect(1, angle)
+	}
+	return w
+}
+
+/*
+ * unlinear undoes linear.
+ */
+func unlinear(w complex128, angle float64, a *Affine) complex128 {
+	if angle != 0 {
+		w *= cmplx.Rect(1, -angle)
+	}
+	if a != nil {
+		w = a.Inverse().Apply(w)
+	}
+	return w
+}
+
+/*
+ * crop returns the bounds that render the part of p's Min to Max
+ * between min and max exactly as p does, turned and transformed about
+ * pivot rather than about their own center.
+ */
+func (self *Parameters) crop(pivot, min, max complex128) (complex128, complex128) {
+	if self.Angle == 0 && self.Affine == nil {
+		return min, max
+	}
+
+	c := (min + max) / 2
+	shift := linear(c-pivot, self.Angle, self.Affine) - linear(0, self.Angle, self.Affine) - (c - pivot)
+	return min + shift, max + shift
+}
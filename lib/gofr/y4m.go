@@ -0,0 +1,73 @@
+package gofr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+/*
+ * Y4MWriter writes frames as a raw YUV4MPEG2 video stream, which ffmpeg
+ * and most other encoders read straight from a pipe. Frames are full
+ * range 4:4:4, so nothing is lost to chroma subsampling before the
+ * encoder gets them.
+ */
+type Y4MWriter struct {
+	w             io.Writer
+	width, height int
+	fps           int
+	header        bool
+	planes        []byte
+}
+
+/*
+ * NewY4MWriter returns a Y4MWriter for width by height frames played at
+ * fps frames per second.
+ */
+func NewY4MWriter(w io.Writer, width, height, fps int) *Y4MWriter {
+	return &Y4MWriter{
+		w:      w,
+		width:  width,
+		height: height,
+		fps:    fps,
+		planes: make([]byte, 3*width*height),
+	}
+}
+
+/*
+ * WriteFrame writes the next frame, after the stream header if it's the
+ * first. It must be the size the Y4MWriter was made for.
+ */
+func (self *Y4MWriter) WriteFrame(img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() != self.width || b.Dy() != self.height {
+		return fmt.Errorf("Frame is %v, not %dx%d", b.Size(), self.width, self.height)
+	}
+
+	if !self.header {
+		_, err := fmt.Fprintf(self.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C444 XCOLORRANGE=FULL\n", self.width, self.height, self.fps)
+		if err != nil {
+			return err
+		}
+		self.header = true
+	}
+
+	n := self.width * self.height
+	for y := 0; y < self.height; y++ {
+		for x := 0; x < self.width; x++ {
+			k := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			yy, cb, cr := color.RGBToYCbCr(k.R, k.G, k.B)
+			i := y*self.width + x
+			self.planes[i] = yy
+			self.planes[n+i] = cb
+			self.planes[2*n+i] = cr
+		}
+	}
+
+	if _, err := io.WriteString(self.w, "FRAME\n"); err != nil {
+		return err
+	}
+	_, err := self.w.Write(self.planes)
+	return err
+}
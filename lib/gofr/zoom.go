@@ -0,0 +1,317 @@
+package gofr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * Easing shapes how an animation moves over time. It maps the fraction
+ * of frames done, from 0 to 1, onto the fraction of the way there.
+ */
+type Easing func(t float64) float64
+
+/*
+ * Easings are the named Easings that EasingFromString knows.
+ */
+var Easings = map[string]Easing{
+	"linear": func(t float64) float64 {
+		return t
+	},
+	"ease-in": func(t float64) float64 {
+		return t * t
+	},
+	"ease-out": func(t float64) float64 {
+		return t * (2 - t)
+	},
+	"ease-in-out": func(t float64) float64 {
+		return (1 - math.Cos(math.Pi*t)) / 2
+	},
+}
+
+/*
+ * EasingFromString looks up one of Easings by name.
+ */
+func EasingFromString(name string) (Easing, error) {
+	if e, ok := Easings[name]; ok {
+		return e, nil
+	}
+
+	names := []string{}
+	for n := range Easings {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("Invalid easing name: %#v, expected one of %v", name, names)
+}
+
+/*
+ * Zoom is an exponential zoom from the view of Start to one centered on
+ * Center and Magnification times bigger, over Frames frames. Everything
+ * but the view stays as it is in Start. The zoom keeps one point of the
+ * plane still on screen, so that it looks like a smooth dive rather than
+ * a pan and a zoom at once.
+ */
+type Zoom struct {
+	Start         Parameters
+	Center        complex128
+	Magnification float64
+	Frames        int
+	Easing        Easing
+}
+
+/*
+ * Validate returns an error if a Zoom can't be rendered.
+ */
+func (self *Zoom) Validate() error {
+	if self.Frames < 1 {
+		return fmt.Errorf("A zoom needs at least one frame: %d", self.Frames)
+	}
+	if !finite(self.Magnification) || self.Magnification <= 0 {
+		return fmt.Errorf("Invalid zoom magnification: %v", self.Magnification)
+	}
+	if !finite(real(self.Center)) || !finite(imag(self.Center)) {
+		return fmt.Errorf("Invalid zoom center: %v", self.Center)
+	}
+	return self.Start.Validate()
+}
+
+/*
+ * Frame is the Parameters of frame n, counting from 0.
+ */
+func (self *Zoom) Frame(n int) Parameters {
+	t := 0.0
+	if self.Frames > 1 {
+		t = float64(n) / float64(self.Frames-1)
+	}
+	if self.Easing != nil {
+		t = self.Easing(t)
+	}
+
+	p := self.Start
+	c0 := (p.Min + p.Max) / 2
+	size := p.Max - p.Min
+
+	// The span shrinks exponentially, and the center moves so that the
+	// fixed point stays put.
+	f := math.Pow(self.Magnification, -t)
+	c := c0 + (self.Center-c0)*complex(t, 0)
+	if self.Magnification != 1 {
+		r := complex(1/self.Magnification, 0)
+		fixed := (self.Center - c0*r) / (1 - r)
+		c = fixed + (c0-fixed)*complex(f, 0)
+	}
+
+	half := size * complex(f/2, 0)
+	p.Min = c - half
+	p.Max = c + half
+	return p
+}
+
+/*
+ * FrameFunc receives each frame of an animation, counting from 0. The
+ * image is only good until FrameFunc returns.
+ */
+type FrameFunc func(n int, img *image.NRGBA64) error
+
+/*
+ * zoomReuseThreshold is how much the colors around a point of the last
+ * frame may differ for it to be resampled rather than iterated again.
+ */
+const zoomReuseThreshold = 1.0 / 64
+
+/*
+ * zoomRaster is the last frame of a Zoom, kept so that the next frame
+ * can reuse it.
+ */
+type zoomRaster struct {
+	adaptiveRaster
+	transform Transform
+}
+
+func newZoomRaster(bounds image.Rectangle) *zoomRaster {
+	r := &zoomRaster{}
+	r.image = image.NewNRGBA64(bounds)
+	r.iters = make([]int32, bounds.Dx()*bounds.Dy())
+	return r
+}
+
+/*
+ * place records where on the plane the raster's frame is.
+ */
+func (self *zoomRaster) place(p *Parameters) {
+	self.transform = p.Transform()
+}
+
+/*
+ * resample looks up z in the last frame. It succeeds only where the four
+ * samples around z escaped within an iteration of each other with nearly
+ * the same color, so that there's no new detail between them to find,
+ * and interpolates between them in linear light.
+ */
+func (self *zoomRaster) resample(z complex128) (int32, color.NRGBA64, bool) {
+	if self.image == nil {
+		return 0, color.NRGBA64{}, false
+	}
+
+	// Positions between pixel centers.
+	px, py := self.transform.PointToPixel(z)
+	px -= 0.5
+	py -= 0.5
+	x0 := int(math.Floor(px))
+	y0 := int(math.Floor(py))
+
+	b := self.image.Bounds()
+	if x0 < b.Min.X || y0 < b.Min.Y || x0+1 >= b.Max.X || y0+1 >= b.Max.Y {
+		return 0, color.NRGBA64{}, false
+	}
+
+	i := self.iters[self.offset(x0, y0)]
+	k := self.image.NRGBA64At(x0, y0)
+	corners := [4]color.NRGBA64{}
+	for n, pt := range []image.Point{{x0, y0}, {x0 + 1, y0}, {x0, y0 + 1}, {x0 + 1, y0 + 1}} {
+		if d := self.iters[self.offset(pt.X, pt.Y)] - i; d < -1 || d > 1 {
+			return 0, color.NRGBA64{}, false
+		}
+		corners[n] = self.image.NRGBA64At(pt.X, pt.Y)
+		if colorDistance(k, corners[n]) > zoomReuseThreshold {
+			return 0, color.NRGBA64{}, false
+		}
+	}
+
+	u := px - float64(x0)
+	v := py - float64(y0)
+	weights := [4]float64{(1 - u) * (1 - v), u * (1 - v), (1 - u) * v, u * v}
+
+	var r, g, bl, a float64
+	for n, c := range corners {
+		r += weights[n] * toLinear(c.R)
+		g += weights[n] * toLinear(c.G)
+		bl += weights[n] * toLinear(c.B)
+		a += weights[n] * float64(c.A)
+	}
+
+	return i, color.NRGBA64{fromLinear(r), fromLinear(g), fromLinear(bl), uint16(a + 0.5)}, true
+}
+
+/*
+ * renderFrame renders the raster of one frame into next, resampling what
+ * it can from the last frame, and returns how many pixels it reused.
+ */
+func (self *zoomRaster) renderFrame(ctx context.Context, p *Parameters, threads int, escape EscapeFunc, next *zoomRaster, fn ProgressFunc) (int64, error) {
+	contexts, err := MakeContexts(next.image, gridSize(threads, next.image.Bounds()), p)
+	if err != nil {
+		return 0, err
+	}
+
+	reused := int64(0)
+	for _, c := range contexts {
+		c.RenderFunc = func(ctx context.Context, c *Context) error {
+			n := int64(0)
+			err := c.EachPoint(ctx, func(x, y int, z complex128) {
+				if i, k, ok := self.resample(z); ok {
+					next.iters[next.offset(x, y)] = i
+					c.Image.SetNRGBA64(x, y, k)
+					n++
+					return
+				}
+
+				i, zn := escape(c, z, c.MaxI)
+				next.iters[next.offset(x, y)] = int32(i)
+				c.ColorFunc(c, zn, x, y, i, c.MaxI)
+			})
+			atomic.AddInt64(&reused, n)
+			return err
+		}
+	}
+
+	err = RenderProgress(ctx, threads, contexts, fn)
+	return reused, err
+}
+
+/*
+ * RenderZoom renders every frame of a Zoom in order and hands each to
+ * fn at Width by Height. Each frame resamples the pixels of the frame
+ * before it where nothing new can be found between them, and iterates
+ * only the rest.
+ */
+func RenderZoom(ctx context.Context, z *Zoom, threads int, progress ProgressFunc, fn FrameFunc) error {
+	if err := z.Validate(); err != nil {
+		return err
+	}
+
+	s, err := z.Start.Samples()
+	if err != nil {
+		return err
+	}
+
+	escape, err := adaptiveEscape(&z.Start)
+	if err != nil {
+		return err
+	}
+
+	bounds := image.Rect(0, 0, z.Start.ImageWidth, z.Start.ImageHeight)
+	last := &zoomRaster{}
+	next := newZoomRaster(bounds)
+
+	out := image.NewNRGBA64(image.Rect(0, 0, int(z.Start.Width), int(z.Start.Height)))
+	var shown *image.NRGBA64
+	overlay := traceOverlay(ctx, &z.Start, threads)
+	if overlay != nil {
+		shown = image.NewNRGBA64(out.Bounds())
+	}
+	bp := &bandProgress{fn: progress, start: time.Now()}
+	bp.progress.Tiles = z.Frames
+	bp.progress.Pixels = int64(z.Frames) * int64(bounds.Dx()) * int64(bounds.Dy())
+
+	for n := 0; n < z.Frames; n++ {
+		p := z.Frame(n)
+
+		_, err := last.renderFrame(ctx, &p, threads, escape, next, bp.band())
+		if err != nil {
+			return err
+		}
+		bp.finishBand()
+
+		next.place(&p)
+
+		frame := next.image
+		switch {
+		case p.AdaptiveSamples > 0:
+			draw.Draw(out, out.Bounds(), next.image, image.Point{}, draw.Src)
+			err = next.refine(ctx, &p, threads, escape, out)
+			if err != nil {
+				return err
+			}
+			frame = out
+		case s > 1:
+			downsample(out, next.image, s)
+			frame = out
+		}
+
+		frame, err = overlaid(&p, overlay, frame, shown, true)
+		if err != nil {
+			return err
+		}
+		err = fn(n, frame)
+		if err != nil {
+			return err
+		}
+
+		// Swap the rasters rather than allocate new ones for every
+		// frame.
+		if last.image == nil {
+			last = newZoomRaster(bounds)
+		}
+		last, next = next, last
+	}
+
+	return nil
+}